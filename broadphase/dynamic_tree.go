@@ -0,0 +1,438 @@
+package broadphase
+
+import (
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// How many pixels a proxy's box is fattened by on every side, so small movements don't have to touch the tree at all
+const DefaultMargin = 4
+
+const nullNode = -1
+
+// Return false to stop the query early
+type QueryCallback func(id int) bool
+
+// Called with every proxy whose box the ray passes through, closest boxes aren't guaranteed to come first
+// Return max_fraction to carry on, a smaller fraction to only look at proxies closer than that, or 0 to stop
+type RayCallback func(id int, max_fraction float64) float64
+
+type PairCallback func(a int, b int)
+
+type treeNode struct {
+	bounds shapes.AxisRect // Fattened, for leaves
+	data interface{}
+	parent int // Next free node while the node isn't being used
+	left, right int
+	height int // 0 for leaves and -1 for free nodes
+	moved bool // Leaves waiting in the move buffer
+}
+
+func (node treeNode) leaf() bool {
+	return node.left == nullNode
+}
+
+// Dynamic AABB tree, a binary tree of bounding boxes that stays balanced as things get added, moved and removed
+// Everything added gets a proxy id back, which is how you move it, remove it, and how queries tell you about it
+type DynamicTree struct {
+	nodes []treeNode
+	root int
+	free int
+	count int
+	margin int
+	move_buffer []int // Proxies added, moved or touched since the last Pairs
+}
+
+func NewDynamicTree() *DynamicTree {
+	tree := DynamicTree{}
+	tree.root = nullNode
+	tree.free = nullNode
+	tree.margin = DefaultMargin
+	return &tree
+}
+
+// Getters
+// Number of proxies in the tree
+func (tree DynamicTree) Count() int {
+	return tree.count
+}
+func (tree DynamicTree) Margin() int {
+	return tree.margin
+}
+// Whatever was passed to Insert along with the proxy
+func (tree DynamicTree) Data(id int) interface{} {
+	if !tree.valid(id) {
+		return nil
+	}
+	return tree.nodes[id].data
+}
+// The fattened box the tree keeps for the proxy, it always covers the last bounds it was given
+func (tree DynamicTree) FatBounds(id int) shapes.AxisRect {
+	if !tree.valid(id) {
+		return shapes.AxisRect{}
+	}
+	return tree.nodes[id].bounds
+}
+// 0 for an empty tree or one with a single proxy
+func (tree DynamicTree) Height() int {
+	if tree.root == nullNode {
+		return 0
+	}
+	return tree.nodes[tree.root].height
+}
+// Proxies the next Pairs will query, everything else is sitting still
+func (tree DynamicTree) MovedCount() int {
+	return len(tree.move_buffer)
+}
+// End getters
+
+// Only affects proxies inserted or moved after this
+func (tree *DynamicTree) SetMargin(margin int) {
+	tree.margin = utils.MaxInt(margin, 0)
+}
+
+func (tree DynamicTree) valid(id int) bool {
+	return id >= 0 && id < len(tree.nodes) && tree.nodes[id].height == 0
+}
+
+func fattened(bounds shapes.AxisRect, margin int) shapes.AxisRect {
+	return shapes.NewAxisRect(bounds.X() - margin, bounds.Y() - margin, bounds.W() + (2 * margin), bounds.H() + (2 * margin))
+}
+
+func (tree *DynamicTree) allocate() int {
+	if tree.free == nullNode {
+		tree.nodes = append(tree.nodes, treeNode{})
+		tree.free = len(tree.nodes) - 1
+		tree.nodes[tree.free].parent = nullNode
+	}
+	id := tree.free
+	tree.free = tree.nodes[id].parent
+	tree.nodes[id] = treeNode{parent: nullNode, left: nullNode, right: nullNode}
+	return id
+}
+
+func (tree *DynamicTree) release(id int) {
+	tree.nodes[id] = treeNode{parent: tree.free, left: nullNode, right: nullNode, height: -1}
+	tree.free = id
+}
+
+// Adds bounds to the tree and gives back the proxy id for it, data is kept alongside for looking up with Data
+func (tree *DynamicTree) Insert(bounds shapes.AxisRect, data interface{}) int {
+	id := tree.allocate()
+	tree.nodes[id].bounds = fattened(bounds, tree.margin)
+	tree.nodes[id].data = data
+	tree.insertLeaf(id)
+	tree.count += 1
+	tree.bufferMove(id)
+	return id
+}
+
+// The id can get handed out again by a later Insert
+func (tree *DynamicTree) Remove(id int) {
+	if !tree.valid(id) {
+		return
+	}
+	tree.unbufferMove(id)
+	tree.removeLeaf(id)
+	tree.release(id)
+	tree.count -= 1
+}
+
+// Updates the proxy's bounds, returns true if it had to be moved around in the tree
+// Nothing changes while the fat box still covers the new bounds and hasn't gotten far bigger than it needs to be
+func (tree *DynamicTree) Move(id int, bounds shapes.AxisRect) bool {
+	if !tree.valid(id) {
+		return false
+	}
+	fat := tree.nodes[id].bounds
+	if fat.EnclosesAxisRect(bounds) && fattened(bounds, 4 * tree.margin).EnclosesAxisRect(fat) {
+		return false
+	}
+
+	tree.removeLeaf(id)
+	tree.nodes[id].bounds = fattened(bounds, tree.margin)
+	tree.insertLeaf(id)
+	tree.bufferMove(id)
+	return true
+}
+
+// Makes the next Pairs look for everything touching the proxy again even though its box hasn't changed
+// For when whatever the proxy belongs to changes which pairs it cares about, like a body changing type
+func (tree *DynamicTree) Touch(id int) {
+	if tree.valid(id) {
+		tree.bufferMove(id)
+	}
+}
+
+func (tree *DynamicTree) bufferMove(id int) {
+	if !tree.nodes[id].moved {
+		tree.nodes[id].moved = true
+		tree.move_buffer = append(tree.move_buffer, id)
+	}
+}
+
+func (tree *DynamicTree) unbufferMove(id int) {
+	if !tree.nodes[id].moved {
+		return
+	}
+	tree.nodes[id].moved = false
+	for i, moved := range tree.move_buffer {
+		if moved == id {
+			tree.move_buffer = append(tree.move_buffer[:i], tree.move_buffer[i+1:]...)
+			return
+		}
+	}
+}
+
+// Calls back with every proxy whose fat box touches bounds
+func (tree DynamicTree) Query(bounds shapes.AxisRect, callback QueryCallback) {
+	if tree.root == nullNode {
+		return
+	}
+	stack := []int{tree.root}
+	for len(stack) > 0 {
+		index := stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
+		node := tree.nodes[index]
+		if !node.bounds.IntersectsAxisRect(bounds) {
+			continue
+		}
+		if node.leaf() {
+			if !callback(index) {
+				return
+			}
+		} else {
+			stack = append(stack, node.left, node.right)
+		}
+	}
+}
+
+// Calls back with every proxy whose fat box the line from start to end passes through
+func (tree DynamicTree) QueryRay(start utils.FloatPair, end utils.FloatPair, callback RayCallback) {
+	if tree.root == nullNode {
+		return
+	}
+	dir := end.Minus(start)
+	max_fraction := 1.0
+	stack := []int{tree.root}
+	for len(stack) > 0 {
+		index := stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
+		node := tree.nodes[index]
+		if !rayHitsBox(start, dir, node.bounds, max_fraction) {
+			continue
+		}
+		if node.leaf() {
+			fraction := callback(index, max_fraction)
+			if fraction <= 0 {
+				return
+			}
+			max_fraction = math.Min(fraction, max_fraction)
+		} else {
+			stack = append(stack, node.left, node.right)
+		}
+	}
+}
+
+// Calls back once for every pair of proxies whose fat boxes touch where at least one of them was added, moved or touched since the last call, with the lower id first
+// Pairs where neither proxy changed were already handed out before, so hang on to them until their fat boxes stop touching
+// Proxies that sit still cost nothing here
+func (tree *DynamicTree) Pairs(callback PairCallback) {
+	for _, id := range tree.move_buffer {
+		tree.Query(tree.nodes[id].bounds, func(other int) bool {
+			if other == id {
+				return true
+			}
+			if tree.nodes[other].moved && other > id {
+				return true // Both moved, the pair gets handed out when other does its own query
+			}
+			callback(utils.MinInt(id, other), utils.MaxInt(id, other))
+			return true
+		})
+	}
+	for _, id := range tree.move_buffer {
+		tree.nodes[id].moved = false
+	}
+	tree.move_buffer = tree.move_buffer[:0]
+}
+
+// Slab test for the part of the ray up to max_fraction
+func rayHitsBox(start, dir utils.FloatPair, box shapes.AxisRect, max_fraction float64) bool {
+	tmin := 0.0
+	tmax := max_fraction
+	starts := [2]float64{start.X, start.Y}
+	dirs := [2]float64{dir.X, dir.Y}
+	mins := [2]float64{float64(box.X()), float64(box.Y())}
+	maxs := [2]float64{float64(box.X2()), float64(box.Y2())}
+	for i := 0; i < 2; i++ {
+		if dirs[i] == 0 {
+			if starts[i] < mins[i] || starts[i] > maxs[i] {
+				return false
+			}
+			continue
+		}
+		t1 := (mins[i] - starts[i]) / dirs[i]
+		t2 := (maxs[i] - starts[i]) / dirs[i]
+		tmin = math.Max(tmin, math.Min(t1, t2))
+		tmax = math.Min(tmax, math.Max(t1, t2))
+		if tmin > tmax {
+			return false
+		}
+	}
+	return true
+}
+
+func perimeter(box shapes.AxisRect) int {
+	return 2 * (box.W() + box.H())
+}
+
+func (tree *DynamicTree) insertLeaf(leaf int) {
+	if tree.root == nullNode {
+		tree.root = leaf
+		tree.nodes[leaf].parent = nullNode
+		return
+	}
+
+	// Walk down to whichever spot makes the tree's boxes grow the least
+	bounds := tree.nodes[leaf].bounds
+	index := tree.root
+	for !tree.nodes[index].leaf() {
+		node := tree.nodes[index]
+		combined := perimeter(node.bounds.Union(bounds))
+		// Cost of making a new parent for this node and the leaf right here
+		cost := 2 * combined
+		// Anything further down also has to grow this node's box
+		inherited := 2 * (combined - perimeter(node.bounds))
+
+		cost_left := tree.descendCost(node.left, bounds) + inherited
+		cost_right := tree.descendCost(node.right, bounds) + inherited
+		if cost < cost_left && cost < cost_right {
+			break
+		}
+		if cost_left < cost_right {
+			index = node.left
+		} else {
+			index = node.right
+		}
+	}
+
+	sibling := index
+	old_parent := tree.nodes[sibling].parent
+	new_parent := tree.allocate()
+	tree.nodes[new_parent].parent = old_parent
+	tree.nodes[new_parent].bounds = bounds.Union(tree.nodes[sibling].bounds)
+	tree.nodes[new_parent].height = tree.nodes[sibling].height + 1
+	tree.nodes[new_parent].left = sibling
+	tree.nodes[new_parent].right = leaf
+	tree.nodes[sibling].parent = new_parent
+	tree.nodes[leaf].parent = new_parent
+
+	if old_parent == nullNode {
+		tree.root = new_parent
+	} else {
+		tree.replaceChild(old_parent, sibling, new_parent)
+	}
+	tree.refit(new_parent)
+}
+
+func (tree DynamicTree) descendCost(child int, bounds shapes.AxisRect) int {
+	node := tree.nodes[child]
+	combined := perimeter(node.bounds.Union(bounds))
+	if node.leaf() {
+		return combined
+	}
+	return combined - perimeter(node.bounds)
+}
+
+func (tree *DynamicTree) removeLeaf(leaf int) {
+	if leaf == tree.root {
+		tree.root = nullNode
+		return
+	}
+
+	// The parent goes away and the sibling takes its place
+	parent := tree.nodes[leaf].parent
+	grandparent := tree.nodes[parent].parent
+	sibling := tree.nodes[parent].left
+	if sibling == leaf {
+		sibling = tree.nodes[parent].right
+	}
+
+	tree.nodes[sibling].parent = grandparent
+	tree.release(parent)
+	if grandparent == nullNode {
+		tree.root = sibling
+	} else {
+		tree.replaceChild(grandparent, parent, sibling)
+		tree.refit(grandparent)
+	}
+	tree.nodes[leaf].parent = nullNode
+}
+
+func (tree *DynamicTree) replaceChild(parent int, old_child int, new_child int) {
+	if tree.nodes[parent].left == old_child {
+		tree.nodes[parent].left = new_child
+	} else {
+		tree.nodes[parent].right = new_child
+	}
+}
+
+// Walks from index up to the root, rebalancing and fixing up boxes and heights on the way
+func (tree *DynamicTree) refit(index int) {
+	for index != nullNode {
+		index = tree.balance(index)
+		tree.updateNode(index)
+		index = tree.nodes[index].parent
+	}
+}
+
+func (tree *DynamicTree) updateNode(index int) {
+	left := tree.nodes[tree.nodes[index].left]
+	right := tree.nodes[tree.nodes[index].right]
+	tree.nodes[index].height = 1 + utils.MaxInt(left.height, right.height)
+	tree.nodes[index].bounds = left.bounds.Union(right.bounds)
+}
+
+// If one child is more than a level taller than the other, rotate it up to take a's place
+// Gives back whichever node ends up where a was
+func (tree *DynamicTree) balance(a int) int {
+	node := tree.nodes[a]
+	if node.leaf() || node.height < 2 {
+		return a
+	}
+	diff := tree.nodes[node.right].height - tree.nodes[node.left].height
+	if diff > 1 {
+		return tree.rotateUp(a, node.right)
+	}
+	if diff < -1 {
+		return tree.rotateUp(a, node.left)
+	}
+	return a
+}
+
+// up becomes a's parent, keeping its taller child and handing the shorter one down to a in the spot up came from
+func (tree *DynamicTree) rotateUp(a int, up int) int {
+	parent := tree.nodes[a].parent
+	tree.nodes[up].parent = parent
+	tree.nodes[a].parent = up
+	if parent == nullNode {
+		tree.root = up
+	} else {
+		tree.replaceChild(parent, a, up)
+	}
+
+	keep := tree.nodes[up].left
+	give := tree.nodes[up].right
+	if tree.nodes[give].height > tree.nodes[keep].height {
+		keep, give = give, keep
+	}
+	tree.nodes[up].left = a
+	tree.nodes[up].right = keep
+	tree.replaceChild(a, up, give)
+	tree.nodes[give].parent = a
+
+	tree.updateNode(a)
+	tree.updateNode(up)
+	return up
+}
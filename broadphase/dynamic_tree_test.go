@@ -0,0 +1,245 @@
+package broadphase
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+)
+
+func randomBox(r *rand.Rand) shapes.AxisRect {
+	return shapes.NewAxisRect(r.Intn(1000), r.Intn(1000), 1 + r.Intn(40), 1 + r.Intn(40))
+}
+
+// Walks the whole tree checking parent links, heights, balance and that every box covers its children
+func checkTree(t *testing.T, tree *DynamicTree) {
+	t.Helper()
+	if tree.root == nullNode {
+		if tree.count != 0 {
+			t.Fatalf("empty tree with count %d", tree.count)
+		}
+		return
+	}
+	if tree.nodes[tree.root].parent != nullNode {
+		t.Fatalf("root has a parent")
+	}
+	leaves := 0
+	var walk func(index int) int
+	walk = func(index int) int {
+		node := tree.nodes[index]
+		if node.leaf() {
+			leaves += 1
+			if node.height != 0 {
+				t.Fatalf("leaf %d has height %d", index, node.height)
+			}
+			return 0
+		}
+		for _, child := range []int{node.left, node.right} {
+			if tree.nodes[child].parent != index {
+				t.Fatalf("node %d doesn't point back to its parent %d", child, index)
+			}
+			if !node.bounds.EnclosesAxisRect(tree.nodes[child].bounds) {
+				t.Fatalf("node %d doesn't cover its child %d", index, child)
+			}
+		}
+		left := walk(node.left)
+		right := walk(node.right)
+		if node.height != 1 + utils.MaxInt(left, right) {
+			t.Fatalf("node %d has height %d, expected %d", index, node.height, 1 + utils.MaxInt(left, right))
+		}
+		if left - right > 1 || right - left > 1 {
+			t.Fatalf("node %d is out of balance, %d against %d", index, left, right)
+		}
+		return node.height
+	}
+	walk(tree.root)
+	if leaves != tree.count {
+		t.Fatalf("found %d leaves but the count is %d", leaves, tree.count)
+	}
+}
+
+func sortedPairs(pairs [][2]int) [][2]int {
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	return pairs
+}
+
+func TestDynamicTreeMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := NewDynamicTree()
+	boxes := make(map[int]shapes.AxisRect)
+	for i := 0; i < 300; i++ {
+		box := randomBox(r)
+		id := tree.Insert(box, i)
+		boxes[id] = box
+		if tree.Data(id) != i {
+			t.Fatalf("proxy %d has data %v, expected %d", id, tree.Data(id), i)
+		}
+	}
+	checkTree(t, tree)
+
+	for round := 0; round < 200; round++ {
+		for id := range boxes {
+			switch r.Intn(10) {
+			case 0:
+				tree.Remove(id)
+				delete(boxes, id)
+			case 1, 2:
+				box := boxes[id]
+				moved := shapes.NewAxisRect(box.X() + r.Intn(21) - 10, box.Y() + r.Intn(21) - 10, box.W(), box.H())
+				tree.Move(id, moved)
+				boxes[id] = moved
+			}
+			break
+		}
+		box := randomBox(r)
+		boxes[tree.Insert(box, round)] = box
+	}
+	checkTree(t, tree)
+
+	for id, box := range boxes {
+		if !tree.FatBounds(id).EnclosesAxisRect(box) {
+			t.Fatalf("fat box of %d doesn't cover %v", id, box)
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		area := randomBox(r)
+		found := make(map[int]bool)
+		tree.Query(area, func(id int) bool {
+			found[id] = true
+			return true
+		})
+		for id := range boxes {
+			if tree.FatBounds(id).IntersectsAxisRect(area) != found[id] {
+				t.Fatalf("query %v: proxy %d found %v", area, id, found[id])
+			}
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		start := utils.FloatPair{X: r.Float64() * 1000, Y: r.Float64() * 1000}
+		end := utils.FloatPair{X: r.Float64() * 1000, Y: r.Float64() * 1000}
+		found := make(map[int]bool)
+		tree.QueryRay(start, end, func(id int, max_fraction float64) float64 {
+			found[id] = true
+			return max_fraction
+		})
+		for id := range boxes {
+			if rayHitsBox(start, end.Minus(start), tree.FatBounds(id), 1) != found[id] {
+				t.Fatalf("ray %v to %v: proxy %d found %v", start, end, id, found[id])
+			}
+		}
+	}
+}
+
+func TestDynamicTreeQueryRayClipping(t *testing.T) {
+	tree := NewDynamicTree()
+	tree.SetMargin(0)
+	near := tree.Insert(shapes.NewAxisRect(10, -5, 10, 10), nil)
+	far := tree.Insert(shapes.NewAxisRect(50, -5, 10, 10), nil)
+	found := []int{}
+	tree.QueryRay(utils.FloatPair{X: 0, Y: 0}, utils.FloatPair{X: 100, Y: 0}, func(id int, max_fraction float64) float64 {
+		found = append(found, id)
+		if id == near {
+			return 0.2 // Hit something at x 20, nothing past that counts
+		}
+		return max_fraction
+	})
+	clipped := false
+	for _, id := range found {
+		if id == far && clipped {
+			t.Errorf("far proxy reported after the ray was clipped short of it")
+		}
+		clipped = clipped || id == near
+	}
+	if !clipped {
+		t.Errorf("ray never found the near proxy, got %v", found)
+	}
+}
+
+func TestDynamicTreePairsOnlyReportsMovedProxies(t *testing.T) {
+	tree := NewDynamicTree()
+	collect := func() [][2]int {
+		pairs := [][2]int{}
+		tree.Pairs(func(a int, b int) {
+			if a >= b {
+				t.Errorf("pair %d %d isn't lowest id first", a, b)
+			}
+			pairs = append(pairs, [2]int{a, b})
+		})
+		return sortedPairs(pairs)
+	}
+
+	a := tree.Insert(shapes.NewAxisRect(0, 0, 10, 10), nil)
+	b := tree.Insert(shapes.NewAxisRect(5, 5, 10, 10), nil)
+	c := tree.Insert(shapes.NewAxisRect(100, 100, 10, 10), nil)
+	// Both a and b were just inserted, the pair still only comes back once
+	if pairs := collect(); len(pairs) != 1 || pairs[0] != [2]int{a, b} {
+		t.Fatalf("expected just %d %d, got %v", a, b, pairs)
+	}
+	if pairs := collect(); len(pairs) != 0 {
+		t.Fatalf("nothing moved but got %v", pairs)
+	}
+
+	// A move that stays inside the fat box doesn't touch the tree, so nothing new gets reported
+	if tree.Move(c, shapes.NewAxisRect(101, 101, 10, 10)) {
+		t.Fatalf("small move shouldn't have moved the proxy in the tree")
+	}
+	if pairs := collect(); len(pairs) != 0 {
+		t.Fatalf("small move got %v", pairs)
+	}
+
+	tree.Move(c, shapes.NewAxisRect(8, 8, 10, 10))
+	if pairs := collect(); len(pairs) != 2 || pairs[0] != [2]int{a, c} || pairs[1] != [2]int{b, c} {
+		t.Fatalf("expected %d %d and %d %d, got %v", a, c, b, c, pairs)
+	}
+
+	tree.Touch(a)
+	if pairs := collect(); len(pairs) != 2 || pairs[0] != [2]int{a, b} || pairs[1] != [2]int{a, c} {
+		t.Fatalf("touching %d should report its pairs again, got %v", a, pairs)
+	}
+
+	// Removed proxies drop out of the move buffer
+	tree.Touch(b)
+	tree.Remove(b)
+	if pairs := collect(); len(pairs) != 0 {
+		t.Fatalf("removed proxy still reported %v", pairs)
+	}
+	if len(tree.move_buffer) != 0 {
+		t.Fatalf("move buffer should be empty, got %v", tree.move_buffer)
+	}
+}
+
+func TestDynamicTreePairsMatchBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	tree := NewDynamicTree()
+	boxes := make(map[int]shapes.AxisRect)
+	for i := 0; i < 200; i++ {
+		box := randomBox(r)
+		boxes[tree.Insert(box, nil)] = box
+	}
+
+	// Every touching pair comes back exactly once the first time, since everything was just inserted
+	got := make(map[[2]int]int)
+	tree.Pairs(func(a int, b int) {
+		got[[2]int{a, b}] += 1
+	})
+	for a := range boxes {
+		for b := range boxes {
+			if a >= b {
+				continue
+			}
+			want := tree.FatBounds(a).IntersectsAxisRect(tree.FatBounds(b))
+			if count := got[[2]int{a, b}]; (count == 1) != want || count > 1 {
+				t.Fatalf("pair %d %d reported %d times, touching %v", a, b, count, want)
+			}
+		}
+	}
+}
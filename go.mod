@@ -3,7 +3,6 @@ module github.com/Yarnsh/hippo
 go 1.20
 
 require (
-	github.com/fzipp/astar v0.2.0
 	github.com/hajimehoshi/ebiten/v2 v2.5.2
 )
 
@@ -0,0 +1,70 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// How far a bullet gets pushed into whatever it hits, just enough for a contact to show up next step and stop it properly
+const bulletPenetration = 2 * positionSlop
+
+// Like integratePosition, but stops the body where its shapes first touch something solid instead of letting it skip past
+// Only the movement is swept, the rotation still happens in full
+func (world *World) integrateBullet(body *Body, dt float64) {
+	motion := body.velocity.Multiply(dt)
+	distance := motion.Length()
+	if distance == 0 {
+		world.integratePosition(body, dt)
+		return
+	}
+
+	swept := shapes.SweptBoundingBox(body.bounds, motion)
+	first := shapes.SweepHit{Time: 1}
+	world.tree.Query(swept, func(proxy int) bool {
+		other := world.tree.Data(proxy).(*Body)
+		if other == body {
+			return true
+		}
+		// Everything else moves at the same time, so sweep against where it's going too
+		other_motion := utils.FloatPair{}
+		if other.active() && !other.bullet {
+			other_motion = other.velocity.Multiply(dt)
+		}
+		hit := world.sweepBodies(body, motion, other, other_motion)
+		if hit.Hit && hit.Time < first.Time {
+			first = hit
+		}
+		return true
+	})
+
+	if !first.Hit {
+		world.integratePosition(body, dt)
+		return
+	}
+
+	travel := math.Min((first.Time * distance) + bulletPenetration, distance)
+	center := body.WorldCenterOfMass().Plus(motion.Multiply(travel / distance))
+	body.r += body.angular_velocity * dt
+	body.setWorldCenterOfMass(center)
+}
+
+// Earliest hit between any of a's solid shapes and any of b's
+func (world *World) sweepBodies(a *Body, motion_a utils.FloatPair, b *Body, motion_b utils.FloatPair) shapes.SweepHit {
+	first := shapes.SweepHit{Time: 1}
+	for i, shape_a := range a.world_shapes {
+		if a.sensors[i] {
+			continue
+		}
+		for j, shape_b := range b.world_shapes {
+			if b.sensors[j] || !world.shouldCollide(a, i, b, j) {
+				continue
+			}
+			hit := shapes.TimeOfImpact(shape_a, motion_a, shape_b, motion_b)
+			if hit.Hit && hit.Time < first.Time {
+				first = hit
+			}
+		}
+	}
+	return first
+}
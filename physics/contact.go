@@ -0,0 +1,300 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+const (
+	// Overlap we allow to stay unresolved so resting bodies don't jitter
+	positionSlop = 0.05
+	// Fraction of the remaining overlap pushed apart each step
+	positionCorrection = 0.4
+	// Closing speeds below this don't bounce, otherwise resting bodies never settle
+	// Units are pixels per second, it needs to be above what gravity adds in a single step
+	restitutionThreshold = 40.0
+	// How far a contact point can move between steps and still count as the same point for warm starting
+	warmStartDistance = 2.0
+	// Bodies overlapping more than this are still being pushed apart, so they can't fall asleep yet
+	restingOverlap = 0.25
+)
+
+type contactPoint struct {
+	offset_a, offset_b utils.FloatPair // From each body's center of mass
+	local_a, local_b utils.FloatPair // The contact point stuck to each body, for seeing how far they have moved apart later
+	depth float64
+	normal_mass, tangent_mass float64
+	normal_impulse, tangent_impulse float64
+	velocity_bias float64
+}
+
+// Two bodies whose fat boxes touch in the broad phase, kept from step to step until they stop touching
+// Holds the contacts between their shapes, which are left just as they are while both bodies sleep
+type bodyPair struct {
+	body_a, body_b *Body // Lower id first
+	contacts []*contact
+	collided bool // Contacts have been worked out at least once
+	removed bool
+}
+
+type pairKey struct {
+	body_a, body_b *Body
+}
+
+func (pair *bodyPair) other(body *Body) *Body {
+	if pair.body_a == body {
+		return pair.body_b
+	}
+	return pair.body_a
+}
+
+// Whether any of the contacts push the bodies apart
+func (pair *bodyPair) touching() bool {
+	for _, c := range pair.contacts {
+		if c.solid() {
+			return true
+		}
+	}
+	return false
+}
+
+type contact struct {
+	body_a, body_b *Body
+	shape_a, shape_b int // Indexes into each body's shape list
+	manifold shapes.Manifold
+	points [2]contactPoint
+	friction float64
+	restitution float64
+	sensor bool // Sensors only report events, they never push anything
+	enabled bool // Turned off for a step by the listener's PreSolve
+}
+
+func newContact(a *Body, shape_a int, b *Body, shape_b int, manifold shapes.Manifold) *contact {
+	c := contact{}
+	c.body_a = a
+	c.body_b = b
+	c.shape_a = shape_a
+	c.shape_b = shape_b
+	c.manifold = manifold
+	c.friction = math.Sqrt(a.friction * b.friction)
+	c.restitution = math.Max(a.restitution, b.restitution)
+	c.sensor = a.sensors[shape_a] || b.sensors[shape_b]
+	c.enabled = true
+	return &c
+}
+
+// Whether the solver should push the bodies apart
+func (c *contact) solid() bool {
+	return !c.sensor && c.enabled
+}
+
+// Same pair of shapes as other, which is what carries warm starting and events over from step to step
+func (c *contact) sameShapes(other *contact) bool {
+	return c.shape_a == other.shape_a && c.shape_b == other.shape_b
+}
+
+// Carries the impulses over from last step's contact between the same shapes, so the solver starts close to the answer
+// Points are matched up by whichever old point is closest
+func (c *contact) warmStartFrom(old *contact) {
+	for i := 0; i < c.manifold.ContactCount; i++ {
+		point := c.manifold.Contacts[i].Point
+		best := -1
+		best_dist := warmStartDistance
+		for j := 0; j < old.manifold.ContactCount; j++ {
+			dist := old.manifold.Contacts[j].Point.DistanceTo(point)
+			if dist < best_dist {
+				best_dist = dist
+				best = j
+			}
+		}
+		if best >= 0 {
+			c.points[i].normal_impulse = old.points[best].normal_impulse
+			c.points[i].tangent_impulse = old.points[best].tangent_impulse
+		}
+	}
+}
+
+func (c *contact) prepare() {
+	a := c.body_a
+	b := c.body_b
+	normal := c.manifold.Normal
+	tangent := normal.Perpendicular()
+	center_a := a.WorldCenterOfMass()
+	center_b := b.WorldCenterOfMass()
+
+	for i := 0; i < c.manifold.ContactCount; i++ {
+		p := &c.points[i]
+		point := c.manifold.Contacts[i].Point
+		p.depth = c.manifold.Contacts[i].Depth
+		p.offset_a = point.Minus(center_a)
+		p.offset_b = point.Minus(center_b)
+		p.local_a = a.toLocal(point)
+		p.local_b = b.toLocal(point)
+
+		rn_a := p.offset_a.Cross(normal)
+		rn_b := p.offset_b.Cross(normal)
+		k_normal := a.inv_mass + b.inv_mass + (a.inv_inertia * rn_a * rn_a) + (b.inv_inertia * rn_b * rn_b)
+		if k_normal > 0 {
+			p.normal_mass = 1 / k_normal
+		}
+
+		rt_a := p.offset_a.Cross(tangent)
+		rt_b := p.offset_b.Cross(tangent)
+		k_tangent := a.inv_mass + b.inv_mass + (a.inv_inertia * rt_a * rt_a) + (b.inv_inertia * rt_b * rt_b)
+		if k_tangent > 0 {
+			p.tangent_mass = 1 / k_tangent
+		}
+
+		closing := b.velocityAt(p.offset_b).Minus(a.velocityAt(p.offset_a)).Dot(normal)
+		p.velocity_bias = 0
+		if closing < -restitutionThreshold {
+			p.velocity_bias = -c.restitution * closing
+		}
+	}
+
+	for i := 0; i < c.manifold.ContactCount; i++ {
+		p := &c.points[i]
+		c.applyImpulse(normal.Multiply(p.normal_impulse).Plus(tangent.Multiply(p.tangent_impulse)), p)
+	}
+}
+
+func (c *contact) applyImpulse(impulse utils.FloatPair, p *contactPoint) {
+	c.body_a.applyImpulse(impulse.Negative(), p.offset_a)
+	c.body_b.applyImpulse(impulse, p.offset_b)
+}
+
+func (c *contact) solveVelocity() {
+	a := c.body_a
+	b := c.body_b
+	normal := c.manifold.Normal
+	tangent := normal.Perpendicular()
+
+	// Friction first, it is limited by how hard the normal impulse is pushing
+	for i := 0; i < c.manifold.ContactCount; i++ {
+		p := &c.points[i]
+		relative := b.velocityAt(p.offset_b).Minus(a.velocityAt(p.offset_a))
+		lambda := -p.tangent_mass * relative.Dot(tangent)
+		max_friction := c.friction * p.normal_impulse
+		new_impulse := utils.ClampFloat64(p.tangent_impulse + lambda, -max_friction, max_friction)
+		lambda = new_impulse - p.tangent_impulse
+		p.tangent_impulse = new_impulse
+		c.applyImpulse(tangent.Multiply(lambda), p)
+	}
+
+	if c.manifold.ContactCount == 2 && c.solveNormalBlock() {
+		return
+	}
+
+	for i := 0; i < c.manifold.ContactCount; i++ {
+		p := &c.points[i]
+		relative := b.velocityAt(p.offset_b).Minus(a.velocityAt(p.offset_a))
+		lambda := -p.normal_mass * (relative.Dot(normal) - p.velocity_bias)
+		new_impulse := math.Max(p.normal_impulse + lambda, 0)
+		lambda = new_impulse - p.normal_impulse
+		p.normal_impulse = new_impulse
+		c.applyImpulse(normal.Multiply(lambda), p)
+	}
+}
+
+// Solves both normal impulses of a two point contact together, solving them one at a time makes boxes rock and stacks topple
+// Tries each combination of the points pushing or not until one fits, returns false if the two points are too close to tell apart
+func (c *contact) solveNormalBlock() bool {
+	a := c.body_a
+	b := c.body_b
+	normal := c.manifold.Normal
+	p1 := &c.points[0]
+	p2 := &c.points[1]
+
+	rn1_a := p1.offset_a.Cross(normal)
+	rn1_b := p1.offset_b.Cross(normal)
+	rn2_a := p2.offset_a.Cross(normal)
+	rn2_b := p2.offset_b.Cross(normal)
+	k11 := a.inv_mass + b.inv_mass + (a.inv_inertia * rn1_a * rn1_a) + (b.inv_inertia * rn1_b * rn1_b)
+	k22 := a.inv_mass + b.inv_mass + (a.inv_inertia * rn2_a * rn2_a) + (b.inv_inertia * rn2_b * rn2_b)
+	k12 := a.inv_mass + b.inv_mass + (a.inv_inertia * rn1_a * rn2_a) + (b.inv_inertia * rn1_b * rn2_b)
+	det := (k11 * k22) - (k12 * k12)
+	if k11 * k11 >= 1000 * det {
+		return false
+	}
+
+	old1 := p1.normal_impulse
+	old2 := p2.normal_impulse
+	vn1 := b.velocityAt(p1.offset_b).Minus(a.velocityAt(p1.offset_a)).Dot(normal)
+	vn2 := b.velocityAt(p2.offset_b).Minus(a.velocityAt(p2.offset_a)).Dot(normal)
+	b1 := vn1 - p1.velocity_bias - ((k11 * old1) + (k12 * old2))
+	b2 := vn2 - p2.velocity_bias - ((k12 * old1) + (k22 * old2))
+
+	var x1, x2 float64
+	found := false
+	// Both pushing
+	x1 = -((k22 * b1) - (k12 * b2)) / det
+	x2 = -((k11 * b2) - (k12 * b1)) / det
+	if x1 >= 0 && x2 >= 0 {
+		found = true
+	}
+	// Only the first pushing
+	if !found {
+		x1 = -p1.normal_mass * b1
+		x2 = 0
+		found = x1 >= 0 && (k12 * x1) + b2 >= 0
+	}
+	// Only the second pushing
+	if !found {
+		x1 = 0
+		x2 = -p2.normal_mass * b2
+		found = x2 >= 0 && (k12 * x2) + b1 >= 0
+	}
+	// Neither, the bodies are already moving apart at both points
+	if !found {
+		x1 = 0
+		x2 = 0
+		found = b1 >= 0 && b2 >= 0
+	}
+	if !found {
+		// Shouldn't happen, but leave the impulses alone rather than guess
+		return true
+	}
+
+	p1.normal_impulse = x1
+	p2.normal_impulse = x2
+	c.applyImpulse(normal.Multiply(x1 - old1), p1)
+	c.applyImpulse(normal.Multiply(x2 - old2), p2)
+	return true
+}
+
+// Pushes the bodies apart directly, so overlap left over from the velocity solve doesn't build up
+// Each point is done on its own and can turn the bodies, so something resting crooked gets levelled out too
+func (c *contact) correctPositions() {
+	a := c.body_a
+	b := c.body_b
+	if a.inv_mass + b.inv_mass == 0 {
+		return
+	}
+	if c.manifold.Depth > restingOverlap {
+		a.sleep_time = 0
+		b.sleep_time = 0
+	}
+
+	normal := c.manifold.Normal
+	for i := 0; i < c.manifold.ContactCount; i++ {
+		p := &c.points[i]
+		// Whatever the bodies have moved apart along the normal since the contact was found no longer overlaps
+		point_a := a.toWorld(p.local_a)
+		point_b := b.toWorld(p.local_b)
+		depth := p.depth - point_b.Minus(point_a).Dot(normal)
+		amount := math.Max(depth - positionSlop, 0) * positionCorrection
+		if amount == 0 {
+			continue
+		}
+
+		offset_a := point_a.Minus(a.WorldCenterOfMass())
+		offset_b := point_b.Minus(b.WorldCenterOfMass())
+		rn_a := offset_a.Cross(normal)
+		rn_b := offset_b.Cross(normal)
+		k := a.inv_mass + b.inv_mass + (a.inv_inertia * rn_a * rn_a) + (b.inv_inertia * rn_b * rn_b)
+		impulse := normal.Multiply(amount / k)
+		a.nudge(impulse.Multiply(-a.inv_mass), -a.inv_inertia * offset_a.Cross(impulse))
+		b.nudge(impulse.Multiply(b.inv_mass), b.inv_inertia * offset_b.Cross(impulse))
+	}
+}
@@ -0,0 +1,198 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Keeps two anchor points a set distance apart, like a rigid rod
+// Widening the limits lets the length slide between them, and a spring pulls it back towards the rest length
+type DistanceJoint struct {
+	jointBase
+	length float64
+	min_length, max_length float64
+	frequency float64
+	damping_ratio float64
+
+	impulse float64
+	lower_impulse, upper_impulse float64
+
+	// Worked out in prepare
+	axis utils.FloatPair
+	current_length float64
+	mass float64
+	soft_mass float64
+	gamma, bias float64
+}
+
+// Anchors are in world space and the rest length is however far apart they start, b can be nil to tie a to the world
+func NewDistanceJoint(a *Body, b *Body, ax, ay, bx, by float64) *DistanceJoint {
+	anchor_a := utils.FloatPair{X: ax, Y: ay}
+	anchor_b := utils.FloatPair{X: bx, Y: by}
+	joint := DistanceJoint{jointBase: newJointBase(a, b, anchor_a, anchor_b)}
+	joint.length = anchor_a.DistanceTo(anchor_b)
+	joint.min_length = joint.length
+	joint.max_length = joint.length
+	return &joint
+}
+
+// A distance joint that acts like a spring, free to stretch and squash but always pulled back to its rest length
+// frequency is in hz, and a damping ratio of 1 stops it without any bounce
+func NewSpringJoint(a *Body, b *Body, ax, ay, bx, by float64, frequency float64, damping_ratio float64) *DistanceJoint {
+	joint := NewDistanceJoint(a, b, ax, ay, bx, by)
+	joint.min_length = 0
+	joint.max_length = math.Inf(1)
+	joint.SetSpring(frequency, damping_ratio)
+	return joint
+}
+
+// Getters
+func (joint DistanceJoint) Length() float64 {
+	return joint.length
+}
+func (joint DistanceJoint) MinLength() float64 {
+	return joint.min_length
+}
+func (joint DistanceJoint) MaxLength() float64 {
+	return joint.max_length
+}
+func (joint DistanceJoint) CurrentLength() float64 {
+	return joint.AnchorA().DistanceTo(joint.AnchorB())
+}
+// End getters
+
+// Rest length
+func (joint *DistanceJoint) SetLength(length float64) {
+	joint.length = math.Max(length, 0)
+	joint.wakeUp()
+}
+
+// When min and max are the same the joint is rigid, otherwise the length is free between them
+// Use math.Inf(1) for no maximum
+func (joint *DistanceJoint) SetLimits(min_length float64, max_length float64) {
+	joint.min_length = math.Max(math.Min(min_length, max_length), 0)
+	joint.max_length = math.Max(min_length, max_length)
+	joint.wakeUp()
+}
+
+// Only does anything when the limits leave the length some room to move, a frequency of 0 turns the spring off
+func (joint *DistanceJoint) SetSpring(frequency float64, damping_ratio float64) {
+	joint.frequency = math.Max(frequency, 0)
+	joint.damping_ratio = math.Max(damping_ratio, 0)
+	joint.wakeUp()
+}
+
+func (joint *DistanceJoint) rigid() bool {
+	return joint.min_length >= joint.max_length
+}
+
+func (joint *DistanceJoint) prepare(dt float64) {
+	joint.prepareOffsets()
+	a := joint.body_a
+	b := joint.body_b
+
+	d := b.WorldCenterOfMass().Plus(joint.offset_b).Minus(a.WorldCenterOfMass().Plus(joint.offset_a))
+	joint.current_length = d.Length()
+	if joint.current_length > 0.001 {
+		joint.axis = d.Multiply(1 / joint.current_length)
+	} else {
+		// Anchors on top of each other, pick any direction rather than dividing by zero
+		joint.axis = utils.FloatPair{X: 1, Y: 0}
+	}
+
+	cr_a := joint.offset_a.Cross(joint.axis)
+	cr_b := joint.offset_b.Cross(joint.axis)
+	inv_mass := a.inv_mass + b.inv_mass + (a.inv_inertia * cr_a * cr_a) + (b.inv_inertia * cr_b * cr_b)
+	joint.mass = 0
+	if inv_mass > 0 {
+		joint.mass = 1 / inv_mass
+	}
+
+	joint.gamma = 0
+	joint.bias = 0
+	joint.soft_mass = joint.mass
+	if joint.rigid() {
+		joint.lower_impulse = 0
+		joint.upper_impulse = 0
+	} else if joint.frequency > 0 {
+		gamma, beta := springCoefficients(joint.mass, joint.frequency, joint.damping_ratio, dt)
+		joint.gamma = gamma
+		joint.bias = (joint.current_length - joint.length) * beta
+		if inv_mass + gamma > 0 {
+			joint.soft_mass = 1 / (inv_mass + gamma)
+		}
+	} else {
+		joint.impulse = 0
+	}
+
+	joint.applyImpulse(joint.axis.Multiply(joint.impulse + joint.lower_impulse - joint.upper_impulse), 0)
+}
+
+func (joint *DistanceJoint) solveVelocity(dt float64) {
+	if joint.rigid() {
+		cdot := joint.axis.Dot(joint.relativeVelocity())
+		impulse := -joint.mass * cdot
+		joint.impulse += impulse
+		joint.applyImpulse(joint.axis.Multiply(impulse), 0)
+		return
+	}
+
+	if joint.frequency > 0 {
+		cdot := joint.axis.Dot(joint.relativeVelocity())
+		impulse := -joint.soft_mass * (cdot + joint.bias + (joint.gamma * joint.impulse))
+		joint.impulse += impulse
+		joint.applyImpulse(joint.axis.Multiply(impulse), 0)
+	}
+
+	// Lower limit
+	if joint.min_length > 0 {
+		c := joint.current_length - joint.min_length
+		cdot := joint.axis.Dot(joint.relativeVelocity())
+		impulse := -joint.mass * (cdot + limitBias(c, dt))
+		old := joint.lower_impulse
+		joint.lower_impulse = math.Max(old + impulse, 0)
+		joint.applyImpulse(joint.axis.Multiply(joint.lower_impulse - old), 0)
+	}
+
+	// Upper limit
+	if !math.IsInf(joint.max_length, 1) {
+		c := joint.max_length - joint.current_length
+		cdot := -joint.axis.Dot(joint.relativeVelocity())
+		impulse := -joint.mass * (cdot + limitBias(c, dt))
+		old := joint.upper_impulse
+		joint.upper_impulse = math.Max(old + impulse, 0)
+		joint.applyImpulse(joint.axis.Multiply(-(joint.upper_impulse - old)), 0)
+	}
+}
+
+func (joint *DistanceJoint) solvePosition() {
+	var c float64
+	if joint.rigid() {
+		c = utils.ClampFloat64(joint.CurrentLength() - joint.length, -maxJointCorrection, maxJointCorrection)
+	} else {
+		// Springs fix themselves, only the limits need help
+		c = limitError(joint.CurrentLength(), joint.min_length, joint.max_length, maxJointCorrection)
+	}
+	if c != 0 {
+		solveLengthPosition(&joint.jointBase, c)
+	}
+}
+
+// Pushes the anchors together or apart along the line between them by c
+func solveLengthPosition(joint *jointBase, c float64) {
+	joint.prepareOffsets()
+	d := joint.separation()
+	if d.Length() < 0.001 {
+		return
+	}
+	axis := d.Normalized()
+	a := joint.body_a
+	b := joint.body_b
+	cr_a := joint.offset_a.Cross(axis)
+	cr_b := joint.offset_b.Cross(axis)
+	inv_mass := a.inv_mass + b.inv_mass + (a.inv_inertia * cr_a * cr_a) + (b.inv_inertia * cr_b * cr_b)
+	if inv_mass == 0 {
+		return
+	}
+	joint.applyPositionImpulse(axis.Multiply(-c / inv_mass), 0)
+}
@@ -0,0 +1,284 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+const (
+	// Times the joints get to fix up positions each step, after the velocities are solved and bodies have moved
+	jointPositionIterations = 3
+	// Most a joint gets moved back together in one go, so a badly stretched joint snaps back over a few steps instead of flinging things
+	maxJointCorrection = 8.0
+	maxJointAngularCorrection = 0.14 // About 8 degrees
+)
+
+// A constraint between two bodies, or between a body and the world
+// Add them to the world with World.AddJoint, they get solved alongside the contacts
+type Joint interface {
+	BodyA() *Body
+	// nil when the joint is pinned to the world
+	BodyB() *Body
+	// World space anchor points on each body
+	AnchorA() utils.FloatPair
+	AnchorB() utils.FloatPair
+	// Whether the two bodies still collide with each other, off by default
+	CollideConnected() bool
+	SetCollideConnected(bool)
+
+	base() *jointBase
+	prepare(dt float64)
+	solveVelocity(dt float64)
+	solvePosition()
+}
+
+// What every joint has, anchors are kept in each body's local space
+// Joints pinned to the world keep the world in body_a, so the body moves the same way it would relative to another body
+type jointBase struct {
+	body_a, body_b *Body
+	local_a, local_b utils.FloatPair
+	grounded bool
+	collide_connected bool
+
+	// From each body's center of mass to its anchor, worked out in prepare
+	offset_a, offset_b utils.FloatPair
+}
+
+// b can be nil to pin a to the world, anchors are given in world space
+func newJointBase(a *Body, b *Body, anchor_a utils.FloatPair, anchor_b utils.FloatPair) jointBase {
+	joint := jointBase{}
+	if b == nil {
+		a, b = newGroundBody(), a
+		anchor_a, anchor_b = anchor_b, anchor_a
+		joint.grounded = true
+	}
+	joint.body_a = a
+	joint.body_b = b
+	joint.local_a = a.toLocal(anchor_a)
+	joint.local_b = b.toLocal(anchor_b)
+	return joint
+}
+
+// Static body with no shapes sitting at the origin, stands in for the world so joints don't need special cases
+func newGroundBody() *Body {
+	ground := NewBody(0, 0, 0)
+	ground.SetType(STATIC_BODY)
+	return ground
+}
+
+func (joint *jointBase) BodyA() *Body {
+	if joint.grounded {
+		return joint.body_b
+	}
+	return joint.body_a
+}
+
+func (joint *jointBase) BodyB() *Body {
+	if joint.grounded {
+		return nil
+	}
+	return joint.body_b
+}
+
+func (joint *jointBase) AnchorA() utils.FloatPair {
+	if joint.grounded {
+		return joint.body_b.toWorld(joint.local_b)
+	}
+	return joint.body_a.toWorld(joint.local_a)
+}
+
+func (joint *jointBase) AnchorB() utils.FloatPair {
+	if joint.grounded {
+		return joint.body_a.toWorld(joint.local_a)
+	}
+	return joint.body_b.toWorld(joint.local_b)
+}
+
+func (joint *jointBase) CollideConnected() bool {
+	return joint.collide_connected
+}
+
+func (joint *jointBase) SetCollideConnected(collide bool) {
+	joint.collide_connected = collide
+}
+
+func (joint *jointBase) base() *jointBase {
+	return joint
+}
+
+func (joint *jointBase) wakeUp() {
+	if !joint.grounded {
+		joint.body_a.WakeUp()
+	}
+	joint.body_b.WakeUp()
+}
+
+func (joint *jointBase) prepareOffsets() {
+	joint.offset_a = joint.local_a.Minus(joint.body_a.center_of_mass).Rotated(joint.body_a.r)
+	joint.offset_b = joint.local_b.Minus(joint.body_b.center_of_mass).Rotated(joint.body_b.r)
+}
+
+// Velocity of anchor b as seen from anchor a
+func (joint *jointBase) relativeVelocity() utils.FloatPair {
+	return joint.body_b.velocityAt(joint.offset_b).Minus(joint.body_a.velocityAt(joint.offset_a))
+}
+
+// Pushes the bodies in opposite directions at their anchors, body b gets the impulse as given and body a gets the opposite
+func (joint *jointBase) applyImpulse(impulse utils.FloatPair, angular float64) {
+	a := joint.body_a
+	b := joint.body_b
+	a.applyImpulse(impulse.Negative(), joint.offset_a)
+	a.angular_velocity -= a.inv_inertia * angular
+	b.applyImpulse(impulse, joint.offset_b)
+	b.angular_velocity += b.inv_inertia * angular
+}
+
+// Moves the bodies directly at their anchors for the position pass, body b gets the impulse as given and body a gets the opposite
+// Offsets need to be up to date with prepareOffsets first
+func (joint *jointBase) applyPositionImpulse(impulse utils.FloatPair, angular float64) {
+	a := joint.body_a
+	b := joint.body_b
+	a.nudge(impulse.Multiply(-a.inv_mass), -a.inv_inertia * (joint.offset_a.Cross(impulse) + angular))
+	b.nudge(impulse.Multiply(b.inv_mass), b.inv_inertia * (joint.offset_b.Cross(impulse) + angular))
+}
+
+// How far apart the two anchors have drifted, from a's to b's
+func (joint *jointBase) separation() utils.FloatPair {
+	return joint.body_b.WorldCenterOfMass().Plus(joint.offset_b).Minus(joint.body_a.WorldCenterOfMass().Plus(joint.offset_a))
+}
+
+// Pulls the two anchors back on top of each other, used by every joint that pins a point
+func (joint *jointBase) solvePointPosition() {
+	joint.prepareOffsets()
+	c := joint.separation()
+	if c.Length() > maxJointCorrection {
+		c = c.Normalized().Multiply(maxJointCorrection)
+	}
+	k11, k12, k22 := joint.pointMass()
+	joint.applyPositionImpulse(solve2x2(k11, k12, k22, c.Negative()), 0)
+}
+
+// Whether the joint is worth solving this step, nothing can move if both ends are asleep or static
+func (joint *jointBase) active() bool {
+	return joint.body_a.active() || joint.body_b.active()
+}
+
+// Effective mass matrix for holding two anchor points together, as k11, k12, k22
+func (joint *jointBase) pointMass() (float64, float64, float64) {
+	a := joint.body_a
+	b := joint.body_b
+	ra := joint.offset_a
+	rb := joint.offset_b
+	k11 := a.inv_mass + b.inv_mass + (a.inv_inertia * ra.Y * ra.Y) + (b.inv_inertia * rb.Y * rb.Y)
+	k12 := -(a.inv_inertia * ra.X * ra.Y) - (b.inv_inertia * rb.X * rb.Y)
+	k22 := a.inv_mass + b.inv_mass + (a.inv_inertia * ra.X * ra.X) + (b.inv_inertia * rb.X * rb.X)
+	return k11, k12, k22
+}
+
+// Bias for a one sided limit where C is how far inside the limit we are
+// When there is still a gap the bodies are allowed to close it in one step, anything past the limit is left for the position pass
+func limitBias(c float64, dt float64) float64 {
+	if c > 0 {
+		return c / dt
+	}
+	return 0
+}
+
+// How far past a lower and upper limit a value is, 0 when it is inside them
+func limitError(value, lower, upper, max_correction float64) float64 {
+	if value < lower {
+		return math.Max(value - lower, -max_correction)
+	}
+	if value > upper {
+		return math.Min(value - upper, max_correction)
+	}
+	return 0
+}
+
+// Soft constraint terms for a spring with the given frequency in hz and damping ratio, 1 being critically damped
+// The impulse is then -soft_mass * (velocity error + beta * position error + gamma * accumulated impulse), with soft_mass = 1 / (1 / mass + gamma)
+func springCoefficients(mass, frequency, damping_ratio, dt float64) (float64, float64) {
+	omega := 2 * math.Pi * frequency
+	d := 2 * mass * damping_ratio * omega
+	k := mass * omega * omega
+	h := dt * (d + (dt * k))
+	if h == 0 {
+		return 0, 0
+	}
+	gamma := 1 / h
+	return gamma, dt * k * gamma
+}
+
+// Solves the 2x2 system k * x = rhs, gives back zero if k can't be inverted
+func solve2x2(k11, k12, k22 float64, rhs utils.FloatPair) utils.FloatPair {
+	det := (k11 * k22) - (k12 * k12)
+	if det == 0 {
+		return utils.FloatPair{}
+	}
+	det = 1 / det
+	return utils.FloatPair{X: det * ((k22 * rhs.X) - (k12 * rhs.Y)), Y: det * ((k11 * rhs.Y) - (k12 * rhs.X))}
+}
+
+// Solves the symmetric 3x3 system k * x = rhs with Cramer's rule, gives back zero if k can't be inverted
+func solve3x3(k [3][3]float64, rhs [3]float64) [3]float64 {
+	det3 := func(c0, c1, c2 [3]float64) float64 {
+		return (c0[0] * ((c1[1] * c2[2]) - (c1[2] * c2[1]))) -
+			(c1[0] * ((c0[1] * c2[2]) - (c0[2] * c2[1]))) +
+			(c2[0] * ((c0[1] * c1[2]) - (c0[2] * c1[1])))
+	}
+	// Columns, but k is symmetric so they are the same as the rows
+	col0 := k[0]
+	col1 := k[1]
+	col2 := k[2]
+	det := det3(col0, col1, col2)
+	if det == 0 {
+		return [3]float64{}
+	}
+	det = 1 / det
+	return [3]float64{
+		det * det3(rhs, col1, col2),
+		det * det3(col0, rhs, col2),
+		det * det3(col0, col1, rhs),
+	}
+}
+
+func (world *World) AddJoint(joint Joint) {
+	world.joints = append(world.joints, joint)
+	base := joint.base()
+	if !base.grounded {
+		base.body_a.joints = append(base.body_a.joints, joint)
+	}
+	base.body_b.joints = append(base.body_b.joints, joint)
+	base.wakeUp()
+}
+
+func (world *World) RemoveJoint(joint Joint) {
+	for i, j := range world.joints {
+		if j == joint {
+			world.joints = append(world.joints[:i], world.joints[i+1:]...)
+			break
+		}
+	}
+	base := joint.base()
+	base.body_a.removeJoint(joint)
+	base.body_b.removeJoint(joint)
+	base.wakeUp()
+}
+
+func (world World) Joints() []Joint {
+	return append([]Joint{}, world.joints...)
+}
+
+// Whether a joint between the two bodies stops them from colliding
+func jointedWithoutCollision(a *Body, b *Body) bool {
+	for _, joint := range a.joints {
+		base := joint.base()
+		if base.collide_connected {
+			continue
+		}
+		if (base.body_a == a && base.body_b == b) || (base.body_a == b && base.body_b == a) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// Everything about one contact between two shapes, handed to the contact listener
+type ContactEvent struct {
+	BodyA, BodyB *Body
+	// Indexes into each body's Shapes()
+	ShapeA, ShapeB int
+	// Normal points from shape A to shape B
+	Manifold shapes.Manifold
+	// Impulse applied at each contact point this step, along the normal and along the surface
+	// Only filled in for PostSolve, sensors never get any
+	NormalImpulses [2]float64
+	TangentImpulses [2]float64
+	// Whether either shape is a sensor
+	Sensor bool
+}
+
+// Callbacks for things touching, any of them can be left nil
+// These get called in the middle of a step, so don't add or remove bodies from inside them
+type ContactListener struct {
+	// Two shapes started touching this step
+	BeginContact func(ContactEvent)
+	// Called every step two shapes are touching, before the solver runs
+	// Return false to skip the collision response for this step, for things like one way platforms
+	PreSolve func(ContactEvent) bool
+	// Called after the solver with the impulses it used, good for damage from hard hits
+	PostSolve func(ContactEvent)
+	// Two shapes stopped touching, or one of their bodies got removed from the world
+	EndContact func(ContactEvent)
+}
+
+func (c *contact) event() ContactEvent {
+	event := ContactEvent{
+		BodyA: c.body_a,
+		BodyB: c.body_b,
+		ShapeA: c.shape_a,
+		ShapeB: c.shape_b,
+		Manifold: c.manifold,
+		Sensor: c.sensor,
+	}
+	for i := 0; i < c.manifold.ContactCount; i++ {
+		event.NormalImpulses[i] = c.points[i].normal_impulse
+		event.TangentImpulses[i] = c.points[i].tangent_impulse
+	}
+	return event
+}
+
+// Sends whatever started and stopped touching since the last step, findContacts and RemoveBody queue them up
+func (world *World) sendBeginAndEndEvents() {
+	if world.listener.BeginContact != nil {
+		for _, c := range world.began {
+			world.listener.BeginContact(c.event())
+		}
+	}
+	if world.listener.EndContact != nil {
+		for _, c := range world.ended {
+			world.listener.EndContact(c.event())
+		}
+	}
+	world.began = world.began[:0]
+	world.ended = world.ended[:0]
+}
+
+// Gives the listener a chance to turn off contacts for this step
+func (world *World) preSolve() {
+	for _, c := range world.contacts {
+		c.enabled = true
+		if c.sensor || world.listener.PreSolve == nil {
+			continue
+		}
+		c.enabled = world.listener.PreSolve(c.event())
+	}
+}
+
+func (world *World) postSolve(solving []*contact) {
+	if world.listener.PostSolve == nil {
+		return
+	}
+	for _, c := range solving {
+		world.listener.PostSolve(c.event())
+	}
+}
@@ -0,0 +1,63 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+type massData struct {
+	mass float64
+	center utils.FloatPair
+	inertia float64 // around center
+}
+
+func massDataFor(shape shapes.Shape, density float64) massData {
+	switch s := shape.(type) {
+	case shapes.Circle:
+		mass := density * math.Pi * s.Radius() * s.Radius()
+		return massData{mass: mass, center: s.Center(), inertia: mass * s.Radius() * s.Radius() / 2}
+	case *shapes.Circle:
+		return massDataFor(*s, density)
+	case shapes.AxisRect:
+		return boxMassData(float64(s.W()), float64(s.H()), s.Center(), density)
+	case *shapes.AxisRect:
+		return massDataFor(*s, density)
+	case shapes.Rect:
+		return boxMassData(s.W(), s.H(), s.Center(), density)
+	case *shapes.Rect:
+		return massDataFor(*s, density)
+	case shapes.Polygon:
+		mass := density * s.Area()
+		return massData{mass: mass, center: s.Centroid(), inertia: s.MomentOfInertia(mass)}
+	case *shapes.Polygon:
+		return massDataFor(*s, density)
+	case shapes.Capsule:
+		return capsuleMassData(s, density)
+	case *shapes.Capsule:
+		return massDataFor(*s, density)
+	}
+	// Lines and anything we don't know about have no area, so they add no mass
+	return massData{center: shape.Center()}
+}
+
+func boxMassData(w, h float64, center utils.FloatPair, density float64) massData {
+	mass := density * w * h
+	return massData{mass: mass, center: center, inertia: mass * ((w * w) + (h * h)) / 12}
+}
+
+// Box in the middle plus a half circle on each end
+func capsuleMassData(capsule shapes.Capsule, density float64) massData {
+	r := capsule.Radius()
+	length := capsule.Start().DistanceTo(capsule.End())
+	box_mass := density * length * 2 * r
+	circle_mass := density * math.Pi * r * r
+
+	box_inertia := box_mass * ((length * length) + (4 * r * r)) / 12
+	// Each half circle has its own center of mass 4r/3pi out from the flat side
+	half_offset := (length / 2) + ((4 * r) / (3 * math.Pi))
+	half_centroid := (4 * r) / (3 * math.Pi)
+	circle_inertia := circle_mass * ((r * r / 2) - (half_centroid * half_centroid) + (half_offset * half_offset))
+
+	return massData{mass: box_mass + circle_mass, center: capsule.Center(), inertia: box_inertia + circle_inertia}
+}
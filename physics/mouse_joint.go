@@ -0,0 +1,96 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Drags a point on a body towards a target with a soft spring, for picking things up with the mouse
+type MouseJoint struct {
+	jointBase
+	target utils.FloatPair
+	max_force float64
+	frequency float64
+	damping_ratio float64
+
+	impulse utils.FloatPair
+
+	// Worked out in prepare
+	k11, k12, k22 float64
+	gamma float64
+	bias utils.FloatPair
+}
+
+// Grabs body at world point x, y, which also starts out as the target
+// max_force should be a good bit more than the body's weight, or it won't be able to lift it
+func NewMouseJoint(body *Body, x float64, y float64, max_force float64) *MouseJoint {
+	point := utils.FloatPair{X: x, Y: y}
+	joint := MouseJoint{jointBase: newJointBase(body, nil, point, point)}
+	joint.target = point
+	joint.max_force = math.Abs(max_force)
+	joint.frequency = 5.0
+	joint.damping_ratio = 0.7
+	return &joint
+}
+
+// Getters
+func (joint MouseJoint) Target() utils.FloatPair {
+	return joint.target
+}
+func (joint MouseJoint) MaxForce() float64 {
+	return joint.max_force
+}
+// End getters
+
+func (joint *MouseJoint) SetTarget(x float64, y float64) {
+	joint.target = utils.FloatPair{X: x, Y: y}
+	joint.wakeUp()
+}
+
+func (joint *MouseJoint) SetMaxForce(max_force float64) {
+	joint.max_force = math.Abs(max_force)
+}
+
+// How stiff the drag is, frequency in hz and a damping ratio of 1 stops without overshooting
+func (joint *MouseJoint) SetSpring(frequency float64, damping_ratio float64) {
+	joint.frequency = math.Max(frequency, 0)
+	joint.damping_ratio = math.Max(damping_ratio, 0)
+}
+
+// The world is a and the body is b, the target stands in for the world's anchor
+func (joint *MouseJoint) prepare(dt float64) {
+	joint.prepareOffsets()
+	body := joint.body_b
+
+	joint.gamma = 0
+	beta := 0.0
+	if joint.frequency > 0 {
+		joint.gamma, beta = springCoefficients(body.mass, joint.frequency, joint.damping_ratio, dt)
+	}
+	joint.k11, joint.k12, joint.k22 = joint.pointMass()
+	joint.k11 += joint.gamma
+	joint.k22 += joint.gamma
+
+	separation := body.WorldCenterOfMass().Plus(joint.offset_b).Minus(joint.target)
+	joint.bias = separation.Multiply(beta)
+
+	body.applyImpulse(joint.impulse, joint.offset_b)
+}
+
+func (joint *MouseJoint) solveVelocity(dt float64) {
+	body := joint.body_b
+	cdot := body.velocityAt(joint.offset_b)
+	impulse := solve2x2(joint.k11, joint.k12, joint.k22, cdot.Plus(joint.bias).Plus(joint.impulse.Multiply(joint.gamma)).Negative())
+
+	old := joint.impulse
+	joint.impulse = joint.impulse.Plus(impulse)
+	max_impulse := joint.max_force * dt
+	if joint.impulse.Length() > max_impulse {
+		joint.impulse = joint.impulse.Normalized().Multiply(max_impulse)
+	}
+	body.applyImpulse(joint.impulse.Minus(old), joint.offset_b)
+}
+
+// Nothing to do, the spring already pulls the body along
+func (joint *MouseJoint) solvePosition() {
+}
@@ -1,10 +1,460 @@
 package physics
 
 import (
+	"github.com/Yarnsh/hippo/broadphase"
 	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+	"math"
 )
 
+const (
+	// Simulated, pushed around by gravity, forces and collisions
+	DYNAMIC_BODY = 1
+	// Never moves, like walls and floors
+	STATIC_BODY = 2
+	// Moved by script through its velocity, pushes dynamic bodies around but nothing pushes it back
+	KINEMATIC_BODY = 3
+)
+
+const (
+	// How long a body needs to stay below the sleep tolerances before it can fall asleep, in seconds
+	TimeToSleep = 0.5
+	// Pixels per second
+	LinearSleepTolerance = 2.0
+	// Radians per second
+	AngularSleepTolerance = 0.035
+)
+
+// A rigid body made out of one or more shapes
+// Shapes are given in the body's local space, with x, y, r moving and rotating all of them together
 type Body struct {
+	id int // Set by the world the body gets added to
+	tree *broadphase.DynamicTree // The world's broad phase, nil until the body is added to one
+	proxy int
+	body_type int
 	x, y, r float64
-	shapes []*shapes.Shape
+	shapes []shapes.Shape
+	filters []shapes.Filter // One for each shape
+	sensors []bool
+	joints []Joint
+	pairs []*bodyPair // Every broad phase pair the body is in
+
+	world_shapes []shapes.Shape
+	bounds shapes.AxisRect
+
+	velocity utils.FloatPair
+	angular_velocity float64
+	force utils.FloatPair
+	torque float64
+
+	density float64
+	mass, inv_mass float64
+	inertia, inv_inertia float64
+	center_of_mass utils.FloatPair // local space
+
+	restitution float64
+	friction float64
+	gravity_scale float64
+	linear_damping float64
+	angular_damping float64
+
+	awake bool
+	sleeping_allowed bool
+	sleep_time float64
+	island_flag bool // Scratch space for building islands
+	bullet bool
+}
+
+func NewBody(x, y, r float64, shape_list ...shapes.Shape) *Body {
+	body := Body{}
+	body.x = x
+	body.y = y
+	body.r = r
+	body.density = 1.0
+	body.friction = 0.3
+	body.gravity_scale = 1.0
+	body.body_type = DYNAMIC_BODY
+	body.awake = true
+	body.sleeping_allowed = true
+	body.shapes = append(body.shapes, shape_list...)
+	for range shape_list {
+		body.filters = append(body.filters, shapes.DefaultFilter)
+		body.sensors = append(body.sensors, false)
+	}
+	body.updateMass()
+	body.updateWorldShapes()
+	return &body
+}
+
+// Getters
+func (body Body) Type() int {
+	return body.body_type
+}
+func (body Body) Awake() bool {
+	return body.awake
+}
+func (body Body) X() float64 {
+	return body.x
+}
+func (body Body) Y() float64 {
+	return body.y
+}
+func (body Body) R() float64 {
+	return body.r
+}
+func (body Body) Velocity() utils.FloatPair {
+	return body.velocity
+}
+func (body Body) AngularVelocity() float64 {
+	return body.angular_velocity
+}
+func (body Body) Mass() float64 {
+	return body.mass
+}
+func (body Body) Inertia() float64 {
+	return body.inertia
+}
+func (body Body) Restitution() float64 {
+	return body.restitution
+}
+func (body Body) Friction() float64 {
+	return body.friction
+}
+// Shapes in the body's local space
+func (body Body) Shapes() []shapes.Shape {
+	return append([]shapes.Shape{}, body.shapes...)
+}
+// Shapes moved to where the body currently is
+func (body Body) WorldShapes() []shapes.Shape {
+	return append([]shapes.Shape{}, body.world_shapes...)
+}
+func (body Body) BoundingBox() shapes.AxisRect {
+	return body.bounds
+}
+// Filter for the shape at the given index in Shapes()
+func (body Body) Filter(index int) shapes.Filter {
+	return body.filters[index]
+}
+func (body Body) IsSensor(index int) bool {
+	return body.sensors[index]
+}
+func (body Body) IsBullet() bool {
+	return body.bullet
+}
+// End getters
+
+func (body *Body) AddShape(shape shapes.Shape) {
+	body.shapes = append(body.shapes, shape)
+	body.filters = append(body.filters, shapes.DefaultFilter)
+	body.sensors = append(body.sensors, false)
+	body.updateMass()
+	body.updateWorldShapes()
+}
+
+// Index into the list given by Shapes()
+func (body *Body) RemoveShape(index int) {
+	if index < 0 || index >= len(body.shapes) {
+		return
+	}
+	body.shapes = append(body.shapes[:index], body.shapes[index+1:]...)
+	body.filters = append(body.filters[:index], body.filters[index+1:]...)
+	body.sensors = append(body.sensors[:index], body.sensors[index+1:]...)
+	body.updateMass()
+	body.updateWorldShapes()
+}
+
+// Sets the collision filter of every shape on the body
+func (body *Body) SetFilter(filter shapes.Filter) {
+	for i := range body.filters {
+		body.filters[i] = filter
+	}
+	body.WakeUp()
+}
+
+// Index into the list given by Shapes()
+func (body *Body) SetShapeFilter(index int, filter shapes.Filter) {
+	if index < 0 || index >= len(body.filters) {
+		return
+	}
+	body.filters[index] = filter
+	body.WakeUp()
+}
+
+// Sensor shapes still send contact events, but pass through everything like a trigger area
+// Index into the list given by Shapes()
+func (body *Body) SetSensor(index int, sensor bool) {
+	if index < 0 || index >= len(body.sensors) {
+		return
+	}
+	body.sensors[index] = sensor
+	body.WakeUp()
+}
+
+// One of DYNAMIC_BODY, STATIC_BODY or KINEMATIC_BODY
+func (body *Body) SetType(body_type int) {
+	body.body_type = body_type
+	if body_type == STATIC_BODY {
+		body.velocity = utils.FloatPair{}
+		body.angular_velocity = 0
+	}
+	body.updateMass()
+	body.WakeUp()
+	if body.tree != nil {
+		// Pairs between two bodies that can't touch were never kept, so they need finding again
+		body.tree.Touch(body.proxy)
+	}
+}
+
+// Sleeping bodies aren't simulated until something touches them or they get pushed by script
+func (body *Body) SetAwake(awake bool) {
+	if awake {
+		body.WakeUp()
+		return
+	}
+	body.awake = false
+	body.sleep_time = 0
+	body.velocity = utils.FloatPair{}
+	body.angular_velocity = 0
+	body.force = utils.FloatPair{}
+	body.torque = 0
+}
+
+func (body *Body) WakeUp() {
+	if !body.awake && body.tree != nil {
+		body.tree.Touch(body.proxy)
+	}
+	body.awake = true
+	body.sleep_time = 0
+}
+
+// Things like the player character should never fall asleep
+func (body *Body) SetSleepingAllowed(allowed bool) {
+	body.sleeping_allowed = allowed
+	if !allowed {
+		body.WakeUp()
+	}
+}
+
+// Bullets sweep their shapes along each step's motion so they can't tunnel through thin bodies when moving fast
+// Sweeping costs more than a normal step, so save it for small fast things like projectiles
+func (body *Body) SetBullet(bullet bool) {
+	body.bullet = bullet
+}
+
+func (body *Body) SetPosition(x float64, y float64) {
+	body.x = x
+	body.y = y
+	body.updateWorldShapes()
+	body.WakeUp()
+}
+
+func (body *Body) SetRotation(r float64) {
+	body.r = r
+	body.updateWorldShapes()
+	body.WakeUp()
+}
+
+// Ignored for static bodies
+func (body *Body) SetVelocity(x float64, y float64) {
+	if body.body_type == STATIC_BODY {
+		return
+	}
+	body.velocity = utils.FloatPair{X: x, Y: y}
+	body.WakeUp()
+}
+
+// Ignored for static bodies
+func (body *Body) SetAngularVelocity(w float64) {
+	if body.body_type == STATIC_BODY {
+		return
+	}
+	body.angular_velocity = w
+	body.WakeUp()
+}
+
+// Mass comes from the area of the shapes times the density, only dynamic bodies use it
+func (body *Body) SetDensity(density float64) {
+	body.density = density
+	body.updateMass()
+}
+
+// Bounciness, 0 is no bounce and 1 keeps all of the speed
+func (body *Body) SetRestitution(restitution float64) {
+	body.restitution = restitution
+}
+
+func (body *Body) SetFriction(friction float64) {
+	body.friction = friction
+}
+
+func (body *Body) SetGravityScale(scale float64) {
+	body.gravity_scale = scale
+}
+
+func (body *Body) SetDamping(linear float64, angular float64) {
+	body.linear_damping = linear
+	body.angular_damping = angular
+}
+
+// Applied over the next step, then cleared
+// Forces and impulses only do anything to dynamic bodies, and wake them up
+func (body *Body) ApplyForce(x float64, y float64) {
+	if body.body_type != DYNAMIC_BODY {
+		return
+	}
+	body.force = body.force.Plus(utils.FloatPair{X: x, Y: y})
+	body.WakeUp()
+}
+
+// Force at a world space point, which also spins the body if it is off center
+func (body *Body) ApplyForceAtPoint(x, y, px, py float64) {
+	if body.body_type != DYNAMIC_BODY {
+		return
+	}
+	f := utils.FloatPair{X: x, Y: y}
+	body.force = body.force.Plus(f)
+	body.torque += utils.FloatPair{X: px, Y: py}.Minus(body.WorldCenterOfMass()).Cross(f)
+	body.WakeUp()
+}
+
+func (body *Body) ApplyTorque(torque float64) {
+	if body.body_type != DYNAMIC_BODY {
+		return
+	}
+	body.torque += torque
+	body.WakeUp()
+}
+
+// Instant change in momentum at a world space point
+func (body *Body) ApplyImpulse(x, y, px, py float64) {
+	if body.body_type != DYNAMIC_BODY {
+		return
+	}
+	impulse := utils.FloatPair{X: x, Y: y}
+	body.applyImpulse(impulse, utils.FloatPair{X: px, Y: py}.Minus(body.WorldCenterOfMass()))
+	body.WakeUp()
+}
+
+func (body *Body) ApplyAngularImpulse(impulse float64) {
+	if body.body_type != DYNAMIC_BODY {
+		return
+	}
+	body.angular_velocity += body.inv_inertia * impulse
+	body.WakeUp()
+}
+
+// Impulse at an offset from the center of mass
+func (body *Body) applyImpulse(impulse utils.FloatPair, offset utils.FloatPair) {
+	body.velocity = body.velocity.Plus(impulse.Multiply(body.inv_mass))
+	body.angular_velocity += body.inv_inertia * offset.Cross(impulse)
+}
+
+// Body space point to world space
+func (body Body) toWorld(point utils.FloatPair) utils.FloatPair {
+	return point.Rotated(body.r).Plus(utils.FloatPair{X: body.x, Y: body.y})
+}
+
+// World space point to body space
+func (body Body) toLocal(point utils.FloatPair) utils.FloatPair {
+	return point.Minus(utils.FloatPair{X: body.x, Y: body.y}).Rotated(-body.r)
+}
+
+func (body *Body) removeJoint(joint Joint) {
+	for i, j := range body.joints {
+		if j == joint {
+			body.joints = append(body.joints[:i], body.joints[i+1:]...)
+			return
+		}
+	}
+}
+
+// Moves the center of mass by offset and turns the body by r, for fixing up positions after the velocity solve
+func (body *Body) nudge(offset utils.FloatPair, r float64) {
+	center := body.WorldCenterOfMass().Plus(offset)
+	body.r += r
+	body.setWorldCenterOfMass(center)
+}
+
+func (body Body) WorldCenterOfMass() utils.FloatPair {
+	return body.center_of_mass.Rotated(body.r).Plus(utils.FloatPair{X: body.x, Y: body.y})
+}
+
+// Velocity of a point on the body, given as an offset from the center of mass
+func (body Body) velocityAt(offset utils.FloatPair) utils.FloatPair {
+	return body.velocity.Plus(offset.Perpendicular().Multiply(body.angular_velocity))
+}
+
+func (body *Body) updateMass() {
+	body.mass = 0
+	body.inertia = 0
+	body.center_of_mass = utils.FloatPair{}
+
+	weighted_center := utils.FloatPair{}
+	for _, shape := range body.shapes {
+		data := massDataFor(shape, body.density)
+		body.mass += data.mass
+		weighted_center = weighted_center.Plus(data.center.Multiply(data.mass))
+	}
+	if body.mass > 0 {
+		body.center_of_mass = weighted_center.Multiply(1 / body.mass)
+	}
+	for _, shape := range body.shapes {
+		// Parallel axis theorem to move every shape's inertia to the shared center of mass
+		data := massDataFor(shape, body.density)
+		offset := data.center.Minus(body.center_of_mass)
+		body.inertia += data.inertia + (data.mass * offset.Dot(offset))
+	}
+
+	body.inv_mass = 0
+	body.inv_inertia = 0
+	if body.body_type != DYNAMIC_BODY {
+		// Nothing can push static or kinematic bodies around, which is the same as infinite mass
+		body.mass = 0
+		body.inertia = 0
+		return
+	}
+	if body.mass <= 0 {
+		// Dynamic bodies made of only lines still need some mass to fall
+		body.mass = 1
+	}
+	body.inv_mass = 1 / body.mass
+	if body.inertia > 0 {
+		body.inv_inertia = 1 / body.inertia
+	}
+}
+
+// Whether the body needs stepping at all, sleeping bodies and static ones don't
+func (body Body) active() bool {
+	return body.awake && body.body_type != STATIC_BODY
+}
+
+func (body *Body) updateWorldShapes() {
+	body.world_shapes = body.world_shapes[:0]
+	// With no shapes left the box shrinks down to the body's position, so nothing in the broad phase still thinks it's touching the old shapes
+	body.bounds = shapes.NewAxisRect(int(math.Floor(body.x)), int(math.Floor(body.y)), 0, 0)
+	for i, shape := range body.shapes {
+		world_shape := shapes.Transformed(shape, body.x, body.y, body.r)
+		body.world_shapes = append(body.world_shapes, world_shape)
+		if i == 0 {
+			body.bounds = world_shape.BoundingBox()
+		} else {
+			body.bounds = unionAxisRects(body.bounds, world_shape.BoundingBox())
+		}
+	}
+	if body.tree != nil {
+		body.tree.Move(body.proxy, body.bounds)
+	}
+}
+
+// Moves the body so that its center of mass ends up at the given world position
+func (body *Body) setWorldCenterOfMass(center utils.FloatPair) {
+	origin := center.Minus(body.center_of_mass.Rotated(body.r))
+	body.x = origin.X
+	body.y = origin.Y
+}
+
+func unionAxisRects(a, b shapes.AxisRect) shapes.AxisRect {
+	x := utils.MinInt(a.X(), b.X())
+	y := utils.MinInt(a.Y(), b.Y())
+	return shapes.NewAxisRect(x, y, utils.MaxInt(a.X2(), b.X2()) - x, utils.MaxInt(a.Y2(), b.Y2()) - y)
 }
@@ -0,0 +1,239 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Lets b slide along an axis fixed to a without turning, like a piston, an elevator or a suspension strut
+type PrismaticJoint struct {
+	jointBase
+	local_axis utils.FloatPair // In a's local space
+	reference_angle float64
+
+	limit_enabled bool
+	lower_translation, upper_translation float64
+	motor_enabled bool
+	motor_speed float64
+	max_motor_force float64
+
+	impulse utils.FloatPair // Across the axis and around the angle
+	motor_impulse float64
+	lower_impulse, upper_impulse float64
+
+	// Worked out in prepare
+	axis, perp utils.FloatPair
+	a1, a2, s1, s2 float64
+	axial_mass float64
+	k11, k12, k22 float64
+	translation float64
+}
+
+// Anchored at world point x, y and sliding along the world direction axis_x, axis_y, b can be nil to slide a along the world
+func NewPrismaticJoint(a *Body, b *Body, x, y, axis_x, axis_y float64) *PrismaticJoint {
+	anchor := utils.FloatPair{X: x, Y: y}
+	joint := PrismaticJoint{jointBase: newJointBase(a, b, anchor, anchor)}
+	joint.local_axis = utils.FloatPair{X: axis_x, Y: axis_y}.Normalized().Rotated(-joint.body_a.r)
+	joint.reference_angle = joint.body_b.r - joint.body_a.r
+	return &joint
+}
+
+// Getters
+// How far b has slid along the axis since the joint was made
+func (joint PrismaticJoint) Translation() float64 {
+	axis := joint.local_axis.Rotated(joint.body_a.r)
+	return joint.body_b.toWorld(joint.local_b).Minus(joint.body_a.toWorld(joint.local_a)).Dot(axis)
+}
+func (joint PrismaticJoint) Axis() utils.FloatPair {
+	return joint.local_axis.Rotated(joint.body_a.r)
+}
+func (joint PrismaticJoint) LimitEnabled() bool {
+	return joint.limit_enabled
+}
+func (joint PrismaticJoint) LowerTranslation() float64 {
+	return joint.lower_translation
+}
+func (joint PrismaticJoint) UpperTranslation() float64 {
+	return joint.upper_translation
+}
+func (joint PrismaticJoint) MotorEnabled() bool {
+	return joint.motor_enabled
+}
+func (joint PrismaticJoint) MotorSpeed() float64 {
+	return joint.motor_speed
+}
+// End getters
+
+// Distances along the axis from where b started
+func (joint *PrismaticJoint) SetLimits(lower float64, upper float64) {
+	joint.lower_translation = math.Min(lower, upper)
+	joint.upper_translation = math.Max(lower, upper)
+	joint.limit_enabled = true
+	joint.wakeUp()
+}
+
+func (joint *PrismaticJoint) EnableLimit(enabled bool) {
+	joint.limit_enabled = enabled
+	if !enabled {
+		joint.lower_impulse = 0
+		joint.upper_impulse = 0
+	}
+	joint.wakeUp()
+}
+
+// Slides b along the axis at speed pixels per second, using up to max_force to do it
+func (joint *PrismaticJoint) SetMotor(speed float64, max_force float64) {
+	joint.motor_speed = speed
+	joint.max_motor_force = math.Abs(max_force)
+	joint.motor_enabled = true
+	joint.wakeUp()
+}
+
+func (joint *PrismaticJoint) EnableMotor(enabled bool) {
+	joint.motor_enabled = enabled
+	if !enabled {
+		joint.motor_impulse = 0
+	}
+	joint.wakeUp()
+}
+
+// Works out the axis and effective masses from where the bodies are right now
+func (joint *PrismaticJoint) updateFrame() {
+	joint.prepareOffsets()
+	a := joint.body_a
+	b := joint.body_b
+	ra := joint.offset_a
+	rb := joint.offset_b
+
+	d := joint.separation()
+	joint.axis = joint.local_axis.Rotated(a.r)
+	joint.perp = joint.axis.Perpendicular()
+	joint.a1 = d.Plus(ra).Cross(joint.axis)
+	joint.a2 = rb.Cross(joint.axis)
+	joint.s1 = d.Plus(ra).Cross(joint.perp)
+	joint.s2 = rb.Cross(joint.perp)
+	joint.translation = d.Dot(joint.axis)
+
+	axial := a.inv_mass + b.inv_mass + (a.inv_inertia * joint.a1 * joint.a1) + (b.inv_inertia * joint.a2 * joint.a2)
+	joint.axial_mass = 0
+	if axial > 0 {
+		joint.axial_mass = 1 / axial
+	}
+
+	joint.k11 = a.inv_mass + b.inv_mass + (a.inv_inertia * joint.s1 * joint.s1) + (b.inv_inertia * joint.s2 * joint.s2)
+	joint.k12 = (a.inv_inertia * joint.s1) + (b.inv_inertia * joint.s2)
+	joint.k22 = a.inv_inertia + b.inv_inertia
+	if joint.k22 == 0 {
+		// Neither body can turn, so the angle is already held and this just keeps the matrix invertible
+		joint.k22 = 1
+	}
+
+}
+
+func (joint *PrismaticJoint) prepare(dt float64) {
+	joint.updateFrame()
+
+	if !joint.limit_enabled {
+		joint.lower_impulse = 0
+		joint.upper_impulse = 0
+	}
+	if !joint.motor_enabled {
+		joint.motor_impulse = 0
+	}
+
+	joint.applyAxial(joint.motor_impulse + joint.lower_impulse - joint.upper_impulse)
+	joint.applyAcross(joint.impulse)
+}
+
+// Impulse along the axis
+func (joint *PrismaticJoint) applyAxial(impulse float64) {
+	a := joint.body_a
+	b := joint.body_b
+	p := joint.axis.Multiply(impulse)
+	a.velocity = a.velocity.Minus(p.Multiply(a.inv_mass))
+	a.angular_velocity -= a.inv_inertia * impulse * joint.a1
+	b.velocity = b.velocity.Plus(p.Multiply(b.inv_mass))
+	b.angular_velocity += b.inv_inertia * impulse * joint.a2
+}
+
+// Impulse across the axis, and around the angle
+func (joint *PrismaticJoint) applyAcross(impulse utils.FloatPair) {
+	a := joint.body_a
+	b := joint.body_b
+	p := joint.perp.Multiply(impulse.X)
+	a.velocity = a.velocity.Minus(p.Multiply(a.inv_mass))
+	a.angular_velocity -= a.inv_inertia * ((impulse.X * joint.s1) + impulse.Y)
+	b.velocity = b.velocity.Plus(p.Multiply(b.inv_mass))
+	b.angular_velocity += b.inv_inertia * ((impulse.X * joint.s2) + impulse.Y)
+}
+
+// How fast b is sliding along the axis
+func (joint *PrismaticJoint) axialVelocity() float64 {
+	a := joint.body_a
+	b := joint.body_b
+	return joint.axis.Dot(b.velocity.Minus(a.velocity)) + (joint.a2 * b.angular_velocity) - (joint.a1 * a.angular_velocity)
+}
+
+func (joint *PrismaticJoint) solveVelocity(dt float64) {
+	a := joint.body_a
+	b := joint.body_b
+
+	if joint.motor_enabled {
+		impulse := joint.axial_mass * (joint.motor_speed - joint.axialVelocity())
+		old := joint.motor_impulse
+		max_impulse := joint.max_motor_force * dt
+		joint.motor_impulse = utils.ClampFloat64(old + impulse, -max_impulse, max_impulse)
+		joint.applyAxial(joint.motor_impulse - old)
+	}
+
+	if joint.limit_enabled {
+		// Lower limit
+		c := joint.translation - joint.lower_translation
+		impulse := -joint.axial_mass * (joint.axialVelocity() + limitBias(c, dt))
+		old := joint.lower_impulse
+		joint.lower_impulse = math.Max(old + impulse, 0)
+		joint.applyAxial(joint.lower_impulse - old)
+
+		// Upper limit
+		c = joint.upper_translation - joint.translation
+		impulse = -joint.axial_mass * (-joint.axialVelocity() + limitBias(c, dt))
+		old = joint.upper_impulse
+		joint.upper_impulse = math.Max(old + impulse, 0)
+		joint.applyAxial(-(joint.upper_impulse - old))
+	}
+
+	cdot := utils.FloatPair{
+		X: joint.perp.Dot(b.velocity.Minus(a.velocity)) + (joint.s2 * b.angular_velocity) - (joint.s1 * a.angular_velocity),
+		Y: b.angular_velocity - a.angular_velocity,
+	}
+	impulse := solve2x2(joint.k11, joint.k12, joint.k22, cdot.Negative())
+	joint.impulse = joint.impulse.Plus(impulse)
+	joint.applyAcross(impulse)
+}
+
+func (joint *PrismaticJoint) solvePosition() {
+	a := joint.body_a
+	b := joint.body_b
+
+	if joint.limit_enabled && joint.axial_mass > 0 {
+		joint.updateFrame()
+		c := limitError(joint.translation, joint.lower_translation, joint.upper_translation, maxJointCorrection)
+		if c != 0 {
+			impulse := -joint.axial_mass * c
+			p := joint.axis.Multiply(impulse)
+			a.nudge(p.Multiply(-a.inv_mass), -a.inv_inertia * impulse * joint.a1)
+			b.nudge(p.Multiply(b.inv_mass), b.inv_inertia * impulse * joint.a2)
+		}
+	}
+
+	joint.updateFrame()
+	d := joint.separation()
+	c := utils.FloatPair{
+		X: utils.ClampFloat64(d.Dot(joint.perp), -maxJointCorrection, maxJointCorrection),
+		Y: utils.ClampFloat64(b.r - a.r - joint.reference_angle, -maxJointAngularCorrection, maxJointAngularCorrection),
+	}
+	impulse := solve2x2(joint.k11, joint.k12, joint.k22, c.Negative())
+	p := joint.perp.Multiply(impulse.X)
+	a.nudge(p.Multiply(-a.inv_mass), -a.inv_inertia * ((impulse.X * joint.s1) + impulse.Y))
+	b.nudge(p.Multiply(b.inv_mass), b.inv_inertia * ((impulse.X * joint.s2) + impulse.Y))
+}
@@ -0,0 +1,110 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+	"sort"
+)
+
+// Result of one of the world's ray, shape cast or overlap queries
+type QueryHit struct {
+	Body *Body
+	Shape int // Index into the body's Shapes()
+	Point utils.FloatPair
+	Normal utils.FloatPair // Surface normal of the shape that got hit, facing whatever hit it
+	Fraction float64 // How far along the ray or motion the hit is, from 0 to 1. Always 0 for overlaps
+}
+
+// Queries only see shapes whose filters collide with the one they're given, and never see sensors
+func queryable(body *Body, index int, filter shapes.Filter) bool {
+	return !body.sensors[index] && filter.ShouldCollide(body.filters[index])
+}
+
+// Closest shape hit by the line from start to end, false if it doesn't hit anything
+func (world World) RayCast(start utils.FloatPair, end utils.FloatPair, filter shapes.Filter) (QueryHit, bool) {
+	best := QueryHit{}
+	found := false
+	world.tree.QueryRay(start, end, func(proxy int, max_fraction float64) float64 {
+		body := world.tree.Data(proxy).(*Body)
+		for i, shape := range body.world_shapes {
+			if !queryable(body, i, filter) {
+				continue
+			}
+			hit := shapes.RayCast(shape, start, end)
+			if hit.Hit && hit.Fraction <= max_fraction && (!found || hit.Fraction < best.Fraction) {
+				best = QueryHit{Body: body, Shape: i, Point: hit.Point, Normal: hit.Normal, Fraction: hit.Fraction}
+				found = true
+			}
+		}
+		if found {
+			// Nothing further away than this can be the closest anymore
+			return best.Fraction
+		}
+		return max_fraction
+	})
+	return best, found
+}
+
+// Every shape hit by the line from start to end, closest first
+func (world World) RayCastAll(start utils.FloatPair, end utils.FloatPair, filter shapes.Filter) []QueryHit {
+	result := []QueryHit{}
+	world.tree.QueryRay(start, end, func(proxy int, max_fraction float64) float64 {
+		body := world.tree.Data(proxy).(*Body)
+		for i, shape := range body.world_shapes {
+			if !queryable(body, i, filter) {
+				continue
+			}
+			hit := shapes.RayCast(shape, start, end)
+			if hit.Hit {
+				result = append(result, QueryHit{Body: body, Shape: i, Point: hit.Point, Normal: hit.Normal, Fraction: hit.Fraction})
+			}
+		}
+		return max_fraction
+	})
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Fraction < result[j].Fraction
+	})
+	return result
+}
+
+// First shape hit by sweeping shape along motion, the shape is in world space and doesn't rotate while it moves
+// False if it makes the whole move without hitting anything
+func (world World) ShapeCast(shape shapes.Shape, motion utils.FloatPair, filter shapes.Filter) (QueryHit, bool) {
+	best := QueryHit{}
+	found := false
+	world.tree.Query(shapes.SweptBoundingBox(shape.BoundingBox(), motion), func(proxy int) bool {
+		body := world.tree.Data(proxy).(*Body)
+		for i, other := range body.world_shapes {
+			if !queryable(body, i, filter) {
+				continue
+			}
+			hit := shapes.Sweep(shape, motion, other)
+			if hit.Hit && (!found || hit.Time < best.Fraction) {
+				best = QueryHit{Body: body, Shape: i, Point: hit.Point, Normal: hit.Normal, Fraction: hit.Time}
+				found = true
+			}
+		}
+		return true
+	})
+	return best, found
+}
+
+// Every shape overlapping the given one, which is in world space
+func (world World) OverlapShape(shape shapes.Shape, filter shapes.Filter) []QueryHit {
+	result := []QueryHit{}
+	bounds := shape.BoundingBox()
+	world.tree.Query(bounds, func(proxy int) bool {
+		body := world.tree.Data(proxy).(*Body)
+		for i, other := range body.world_shapes {
+			if !queryable(body, i, filter) || !bounds.IntersectsAxisRect(other.BoundingBox()) {
+				continue
+			}
+			manifold := shapes.Collide(shape, other)
+			if manifold.Colliding() {
+				result = append(result, QueryHit{Body: body, Shape: i, Point: manifold.Contacts[0].Point, Normal: manifold.Normal.Negative()})
+			}
+		}
+		return true
+	})
+	return result
+}
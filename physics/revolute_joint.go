@@ -0,0 +1,161 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Pins two bodies together at a point they can both spin around, like a door hinge or a wheel axle
+type RevoluteJoint struct {
+	jointBase
+	reference_angle float64
+
+	limit_enabled bool
+	lower_angle, upper_angle float64
+	motor_enabled bool
+	motor_speed float64
+	max_motor_torque float64
+
+	impulse utils.FloatPair
+	motor_impulse float64
+	lower_impulse, upper_impulse float64
+
+	// Worked out in prepare
+	k11, k12, k22 float64
+	axial_mass float64
+	angle float64
+}
+
+// Pin at world point x, y, b can be nil to pin a to the world
+func NewRevoluteJoint(a *Body, b *Body, x float64, y float64) *RevoluteJoint {
+	anchor := utils.FloatPair{X: x, Y: y}
+	joint := RevoluteJoint{jointBase: newJointBase(a, b, anchor, anchor)}
+	joint.reference_angle = joint.body_b.r - joint.body_a.r
+	return &joint
+}
+
+// Getters
+// How far b has turned relative to a since the joint was made
+func (joint RevoluteJoint) Angle() float64 {
+	return joint.body_b.r - joint.body_a.r - joint.reference_angle
+}
+func (joint RevoluteJoint) LimitEnabled() bool {
+	return joint.limit_enabled
+}
+func (joint RevoluteJoint) LowerAngle() float64 {
+	return joint.lower_angle
+}
+func (joint RevoluteJoint) UpperAngle() float64 {
+	return joint.upper_angle
+}
+func (joint RevoluteJoint) MotorEnabled() bool {
+	return joint.motor_enabled
+}
+func (joint RevoluteJoint) MotorSpeed() float64 {
+	return joint.motor_speed
+}
+// End getters
+
+// Angles in radians relative to where the bodies were when the joint was made
+func (joint *RevoluteJoint) SetLimits(lower float64, upper float64) {
+	joint.lower_angle = math.Min(lower, upper)
+	joint.upper_angle = math.Max(lower, upper)
+	joint.limit_enabled = true
+	joint.wakeUp()
+}
+
+func (joint *RevoluteJoint) EnableLimit(enabled bool) {
+	joint.limit_enabled = enabled
+	if !enabled {
+		joint.lower_impulse = 0
+		joint.upper_impulse = 0
+	}
+	joint.wakeUp()
+}
+
+// Turns b relative to a at speed radians per second, using up to max_torque to do it
+func (joint *RevoluteJoint) SetMotor(speed float64, max_torque float64) {
+	joint.motor_speed = speed
+	joint.max_motor_torque = math.Abs(max_torque)
+	joint.motor_enabled = true
+	joint.wakeUp()
+}
+
+func (joint *RevoluteJoint) EnableMotor(enabled bool) {
+	joint.motor_enabled = enabled
+	if !enabled {
+		joint.motor_impulse = 0
+	}
+	joint.wakeUp()
+}
+
+func (joint *RevoluteJoint) prepare(dt float64) {
+	joint.prepareOffsets()
+	a := joint.body_a
+	b := joint.body_b
+
+	joint.k11, joint.k12, joint.k22 = joint.pointMass()
+	joint.axial_mass = 0
+	if a.inv_inertia + b.inv_inertia > 0 {
+		joint.axial_mass = 1 / (a.inv_inertia + b.inv_inertia)
+	}
+	joint.angle = joint.Angle()
+
+	if !joint.limit_enabled {
+		joint.lower_impulse = 0
+		joint.upper_impulse = 0
+	}
+	if !joint.motor_enabled {
+		joint.motor_impulse = 0
+	}
+
+	joint.applyImpulse(joint.impulse, joint.motor_impulse + joint.lower_impulse - joint.upper_impulse)
+}
+
+func (joint *RevoluteJoint) solveVelocity(dt float64) {
+	a := joint.body_a
+	b := joint.body_b
+
+	if joint.motor_enabled && joint.axial_mass > 0 {
+		cdot := b.angular_velocity - a.angular_velocity - joint.motor_speed
+		impulse := -joint.axial_mass * cdot
+		old := joint.motor_impulse
+		max_impulse := joint.max_motor_torque * dt
+		joint.motor_impulse = utils.ClampFloat64(old + impulse, -max_impulse, max_impulse)
+		joint.applyImpulse(utils.FloatPair{}, joint.motor_impulse - old)
+	}
+
+	if joint.limit_enabled && joint.axial_mass > 0 {
+		// Lower limit
+		c := joint.angle - joint.lower_angle
+		cdot := b.angular_velocity - a.angular_velocity
+		impulse := -joint.axial_mass * (cdot + limitBias(c, dt))
+		old := joint.lower_impulse
+		joint.lower_impulse = math.Max(old + impulse, 0)
+		joint.applyImpulse(utils.FloatPair{}, joint.lower_impulse - old)
+
+		// Upper limit, same thing flipped around
+		c = joint.upper_angle - joint.angle
+		cdot = a.angular_velocity - b.angular_velocity
+		impulse = -joint.axial_mass * (cdot + limitBias(c, dt))
+		old = joint.upper_impulse
+		joint.upper_impulse = math.Max(old + impulse, 0)
+		joint.applyImpulse(utils.FloatPair{}, -(joint.upper_impulse - old))
+	}
+
+	cdot := joint.relativeVelocity()
+	impulse := solve2x2(joint.k11, joint.k12, joint.k22, cdot.Negative())
+	joint.impulse = joint.impulse.Plus(impulse)
+	joint.applyImpulse(impulse, 0)
+}
+
+func (joint *RevoluteJoint) solvePosition() {
+	if joint.limit_enabled && joint.axial_mass > 0 {
+		c := limitError(joint.Angle(), joint.lower_angle, joint.upper_angle, maxJointAngularCorrection)
+		if c != 0 {
+			joint.prepareOffsets()
+			joint.applyPositionImpulse(utils.FloatPair{}, -joint.axial_mass * c)
+		}
+	}
+	joint.solvePointPosition()
+}
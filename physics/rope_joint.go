@@ -0,0 +1,83 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Stops two anchor points from getting further apart than a max length, but lets them get as close as they like
+type RopeJoint struct {
+	jointBase
+	max_length float64
+
+	impulse float64
+
+	// Worked out in prepare
+	axis utils.FloatPair
+	current_length float64
+	mass float64
+}
+
+// Anchors are in world space, b can be nil to hang a from the world
+func NewRopeJoint(a *Body, b *Body, ax, ay, bx, by float64, max_length float64) *RopeJoint {
+	joint := RopeJoint{jointBase: newJointBase(a, b, utils.FloatPair{X: ax, Y: ay}, utils.FloatPair{X: bx, Y: by})}
+	joint.max_length = math.Max(max_length, 0)
+	return &joint
+}
+
+// Getters
+func (joint RopeJoint) MaxLength() float64 {
+	return joint.max_length
+}
+// Whether the rope is pulled tight
+func (joint RopeJoint) Taut() bool {
+	return joint.AnchorA().DistanceTo(joint.AnchorB()) >= joint.max_length
+}
+// End getters
+
+func (joint *RopeJoint) SetMaxLength(max_length float64) {
+	joint.max_length = math.Max(max_length, 0)
+	joint.wakeUp()
+}
+
+func (joint *RopeJoint) prepare(dt float64) {
+	joint.prepareOffsets()
+	a := joint.body_a
+	b := joint.body_b
+
+	d := b.WorldCenterOfMass().Plus(joint.offset_b).Minus(a.WorldCenterOfMass().Plus(joint.offset_a))
+	joint.current_length = d.Length()
+	if joint.current_length > 0.001 {
+		joint.axis = d.Multiply(1 / joint.current_length)
+	} else {
+		joint.axis = utils.FloatPair{}
+		joint.impulse = 0
+	}
+
+	cr_a := joint.offset_a.Cross(joint.axis)
+	cr_b := joint.offset_b.Cross(joint.axis)
+	inv_mass := a.inv_mass + b.inv_mass + (a.inv_inertia * cr_a * cr_a) + (b.inv_inertia * cr_b * cr_b)
+	joint.mass = 0
+	if inv_mass > 0 {
+		joint.mass = 1 / inv_mass
+	}
+
+	joint.applyImpulse(joint.axis.Multiply(-joint.impulse), 0)
+}
+
+func (joint *RopeJoint) solveVelocity(dt float64) {
+	// Slack rope does nothing, this is the same as the upper limit on a distance joint
+	c := joint.max_length - joint.current_length
+	cdot := -joint.axis.Dot(joint.relativeVelocity())
+	impulse := -joint.mass * (cdot + limitBias(c, dt))
+	old := joint.impulse
+	joint.impulse = math.Max(old + impulse, 0)
+	joint.applyImpulse(joint.axis.Multiply(-(joint.impulse - old)), 0)
+}
+
+func (joint *RopeJoint) solvePosition() {
+	c := limitError(joint.AnchorA().DistanceTo(joint.AnchorB()), 0, joint.max_length, maxJointCorrection)
+	if c > 0 {
+		solveLengthPosition(&joint.jointBase, c)
+	}
+}
@@ -0,0 +1,130 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Glues two bodies together so they move as one, a spring on the angle makes it bendy instead
+type WeldJoint struct {
+	jointBase
+	reference_angle float64
+	frequency float64
+	damping_ratio float64
+
+	impulse utils.FloatPair
+	angular_impulse float64
+
+	// Worked out in prepare
+	k [3][3]float64
+	angle_bias float64
+	angular_mass float64
+	gamma float64
+}
+
+// Weld at world point x, y, b can be nil to weld a to the world
+func NewWeldJoint(a *Body, b *Body, x float64, y float64) *WeldJoint {
+	anchor := utils.FloatPair{X: x, Y: y}
+	joint := WeldJoint{jointBase: newJointBase(a, b, anchor, anchor)}
+	joint.reference_angle = joint.body_b.r - joint.body_a.r
+	return &joint
+}
+
+// A frequency above 0 lets the angle flex like a spring, position stays rigid either way
+func (joint *WeldJoint) SetSpring(frequency float64, damping_ratio float64) {
+	joint.frequency = math.Max(frequency, 0)
+	joint.damping_ratio = math.Max(damping_ratio, 0)
+	joint.wakeUp()
+}
+
+// Effective mass for holding the anchors together and the angle fixed all at once
+func (joint *WeldJoint) fullMass() [3][3]float64 {
+	ra := joint.offset_a
+	rb := joint.offset_b
+	ia := joint.body_a.inv_inertia
+	ib := joint.body_b.inv_inertia
+	k11, k12, k22 := joint.pointMass()
+	k13 := -(ra.Y * ia) - (rb.Y * ib)
+	k23 := (ra.X * ia) + (rb.X * ib)
+	return [3][3]float64{
+		{k11, k12, k13},
+		{k12, k22, k23},
+		{k13, k23, ia + ib},
+	}
+}
+
+func (joint *WeldJoint) angle() float64 {
+	return joint.body_b.r - joint.body_a.r - joint.reference_angle
+}
+
+func (joint *WeldJoint) prepare(dt float64) {
+	joint.prepareOffsets()
+	joint.k = joint.fullMass()
+	k33 := joint.k[2][2]
+
+	joint.angle_bias = 0
+	joint.gamma = 0
+	joint.angular_mass = 0
+	if k33 > 0 {
+		joint.angular_mass = 1 / k33
+	}
+	if joint.frequency > 0 && k33 > 0 {
+		gamma, beta := springCoefficients(joint.angular_mass, joint.frequency, joint.damping_ratio, dt)
+		joint.gamma = gamma
+		joint.angle_bias = joint.angle() * beta
+		joint.angular_mass = 1 / (k33 + gamma)
+	}
+
+	joint.applyImpulse(joint.impulse, joint.angular_impulse)
+}
+
+func (joint *WeldJoint) solveVelocity(dt float64) {
+	a := joint.body_a
+	b := joint.body_b
+
+	if joint.frequency > 0 || joint.k[2][2] == 0 {
+		// Angle and position solved one after the other, the angle is soft so it doesn't need to be exact
+		if joint.k[2][2] > 0 {
+			cdot := b.angular_velocity - a.angular_velocity
+			impulse := -joint.angular_mass * (cdot + joint.angle_bias + (joint.gamma * joint.angular_impulse))
+			joint.angular_impulse += impulse
+			joint.applyImpulse(utils.FloatPair{}, impulse)
+		}
+
+		cdot := joint.relativeVelocity()
+		impulse := solve2x2(joint.k[0][0], joint.k[0][1], joint.k[1][1], cdot.Negative())
+		joint.impulse = joint.impulse.Plus(impulse)
+		joint.applyImpulse(impulse, 0)
+		return
+	}
+
+	// Rigid, so solve everything together, one at a time makes a chain of welds sag a lot more
+	cdot := joint.relativeVelocity()
+	cdot_angle := b.angular_velocity - a.angular_velocity
+	impulse := solve3x3(joint.k, [3]float64{-cdot.X, -cdot.Y, -cdot_angle})
+	joint.impulse = joint.impulse.Plus(utils.FloatPair{X: impulse[0], Y: impulse[1]})
+	joint.angular_impulse += impulse[2]
+	joint.applyImpulse(utils.FloatPair{X: impulse[0], Y: impulse[1]}, impulse[2])
+}
+
+func (joint *WeldJoint) solvePosition() {
+	if joint.frequency > 0 {
+		// The angle is a spring so only the point is rigid
+		joint.solvePointPosition()
+		return
+	}
+
+	joint.prepareOffsets()
+	k := joint.fullMass()
+	if k[2][2] == 0 {
+		joint.solvePointPosition()
+		return
+	}
+	c := joint.separation()
+	if c.Length() > maxJointCorrection {
+		c = c.Normalized().Multiply(maxJointCorrection)
+	}
+	c_angle := utils.ClampFloat64(joint.angle(), -maxJointAngularCorrection, maxJointAngularCorrection)
+	impulse := solve3x3(k, [3]float64{-c.X, -c.Y, -c_angle})
+	joint.applyPositionImpulse(utils.FloatPair{X: impulse[0], Y: impulse[1]}, impulse[2])
+}
@@ -0,0 +1,484 @@
+package physics
+
+import (
+	"github.com/Yarnsh/hippo/broadphase"
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+)
+
+const (
+	DefaultTimestep = 1.0 / 60.0
+	DefaultIterations = 8
+	// Most fixed steps we take in one Update, so a long frame doesn't snowball into even longer ones
+	MaxStepsPerUpdate = 8
+)
+
+type World struct {
+	gravity utils.FloatPair
+	bodies []*Body
+	tree *broadphase.DynamicTree
+	contacts []*contact
+	joints []Joint
+	pairs []*bodyPair
+	pair_keys map[pairKey]*bodyPair
+	began []*contact // Waiting to be sent to the listener
+	ended []*contact
+	listener ContactListener
+
+	timestep float64
+	accumulator float64
+	iterations int
+	next_id int
+	sleeping_enabled bool
+	contact_filter ContactFilter
+}
+
+// Called for every pair of shapes whose filters say they should collide, return false to let them pass through each other anyway
+// Shapes are given as indexes into each body's Shapes()
+type ContactFilter func(a *Body, shape_a int, b *Body, shape_b int) bool
+
+func NewWorld(gravity_x float64, gravity_y float64) *World {
+	world := World{}
+	world.gravity = utils.FloatPair{X: gravity_x, Y: gravity_y}
+	world.timestep = DefaultTimestep
+	world.iterations = DefaultIterations
+	world.tree = broadphase.NewDynamicTree()
+	world.sleeping_enabled = true
+	world.pair_keys = make(map[pairKey]*bodyPair)
+	return &world
+}
+
+// Getters
+func (world World) Gravity() utils.FloatPair {
+	return world.gravity
+}
+func (world World) Timestep() float64 {
+	return world.timestep
+}
+func (world World) Bodies() []*Body {
+	return append([]*Body{}, world.bodies...)
+}
+// End getters
+
+func (world *World) SetGravity(x float64, y float64) {
+	world.gravity = utils.FloatPair{X: x, Y: y}
+}
+
+func (world *World) SetTimestep(timestep float64) {
+	world.timestep = timestep
+}
+
+// More iterations makes stacks and piles more stable at the cost of speed
+func (world *World) SetIterations(iterations int) {
+	world.iterations = iterations
+}
+
+// With sleeping off every body gets simulated every step, even ones that have come to rest
+func (world *World) SetSleepingEnabled(enabled bool) {
+	world.sleeping_enabled = enabled
+	if !enabled {
+		for _, body := range world.bodies {
+			if body.body_type != STATIC_BODY {
+				body.WakeUp()
+			}
+		}
+	}
+}
+
+// nil removes the filter
+func (world *World) SetContactFilter(filter ContactFilter) {
+	world.contact_filter = filter
+}
+
+// Whether two shapes are allowed to touch, going by their filters and the world's contact filter
+func (world World) shouldCollide(a *Body, shape_a int, b *Body, shape_b int) bool {
+	if !a.filters[shape_a].ShouldCollide(b.filters[shape_b]) {
+		return false
+	}
+	if jointedWithoutCollision(a, b) {
+		return false
+	}
+	if world.contact_filter != nil && !world.contact_filter(a, shape_a, b, shape_b) {
+		return false
+	}
+	return true
+}
+
+// Replaces any listener set before, pass an empty ContactListener to stop getting events
+func (world *World) SetContactListener(listener ContactListener) {
+	world.listener = listener
+}
+
+func (world *World) AddBody(body *Body) {
+	world.next_id += 1
+	body.id = world.next_id
+	body.tree = world.tree
+	body.proxy = world.tree.Insert(body.bounds, body)
+	world.bodies = append(world.bodies, body)
+}
+
+// Also removes any joints attached to the body, and its contacts end on the next step
+// Anything that was resting on the body wakes up so it doesn't hang in the air
+func (world *World) RemoveBody(body *Body) {
+	for _, joint := range append([]Joint{}, body.joints...) {
+		world.RemoveJoint(joint)
+	}
+	for _, pair := range append([]*bodyPair{}, body.pairs...) {
+		if pair.touching() {
+			pair.other(body).WakeUp()
+		}
+		world.removePair(pair)
+	}
+	for i, b := range world.bodies {
+		if b == body {
+			world.tree.Remove(body.proxy)
+			body.tree = nil
+			world.bodies = append(world.bodies[:i], world.bodies[i+1:]...)
+			return
+		}
+	}
+}
+
+// Advances the world by dt seconds in fixed size steps, any leftover time carries over to the next call
+func (world *World) Update(dt float64) {
+	world.accumulator += dt
+	steps := 0
+	for world.accumulator >= world.timestep {
+		if steps >= MaxStepsPerUpdate {
+			world.accumulator = 0
+			break
+		}
+		world.Step()
+		world.accumulator -= world.timestep
+		steps += 1
+	}
+}
+
+// A single fixed step
+func (world *World) Step() {
+	dt := world.timestep
+
+	for _, body := range world.bodies {
+		if body.active() {
+			world.integrateVelocity(body, dt)
+		}
+	}
+
+	world.findContacts()
+	world.sendBeginAndEndEvents()
+	world.preSolve()
+	islands := world.buildIslands()
+
+	// Islands have woken up anything that got touched, so whatever is still asleep can be left alone
+	// Bodies that just woke up bring along the contacts they fell asleep with, which still hold since neither has moved
+	solving := []*contact{}
+	for _, pair := range world.pairs {
+		if pair.removed || (!pair.body_a.active() && !pair.body_b.active()) {
+			continue
+		}
+		for _, c := range pair.contacts {
+			if c.solid() {
+				solving = append(solving, c)
+			}
+		}
+	}
+
+	joints := []Joint{}
+	for _, joint := range world.joints {
+		if joint.base().active() {
+			joints = append(joints, joint)
+		}
+	}
+
+	for _, joint := range joints {
+		joint.prepare(dt)
+	}
+	for _, c := range solving {
+		c.prepare()
+	}
+	for i := 0; i < world.iterations; i++ {
+		for _, joint := range joints {
+			joint.solveVelocity(dt)
+		}
+		for _, c := range solving {
+			c.solveVelocity()
+		}
+	}
+	world.postSolve(solving)
+
+	for _, body := range world.bodies {
+		if body.active() && body.bullet {
+			world.integrateBullet(body, dt)
+		} else if body.active() {
+			world.integratePosition(body, dt)
+		}
+	}
+	for i := 0; i < jointPositionIterations; i++ {
+		for _, joint := range joints {
+			joint.solvePosition()
+		}
+	}
+	for _, c := range solving {
+		c.correctPositions()
+	}
+	for _, body := range world.bodies {
+		if body.active() {
+			body.updateWorldShapes()
+		}
+	}
+
+	if world.sleeping_enabled {
+		world.updateSleep(islands, dt)
+	}
+}
+
+func (world *World) integrateVelocity(body *Body, dt float64) {
+	if body.body_type != DYNAMIC_BODY {
+		// Kinematic bodies keep whatever velocity they were given
+		body.force = utils.FloatPair{}
+		body.torque = 0
+		return
+	}
+
+	acceleration := world.gravity.Multiply(body.gravity_scale).Plus(body.force.Multiply(body.inv_mass))
+	body.velocity = body.velocity.Plus(acceleration.Multiply(dt))
+	body.angular_velocity += body.torque * body.inv_inertia * dt
+
+	body.velocity = body.velocity.Multiply(1 / (1 + (dt * body.linear_damping)))
+	body.angular_velocity *= 1 / (1 + (dt * body.angular_damping))
+
+	body.force = utils.FloatPair{}
+	body.torque = 0
+}
+
+func (world *World) integratePosition(body *Body, dt float64) {
+	if body.velocity.X == 0 && body.velocity.Y == 0 && body.angular_velocity == 0 {
+		return
+	}
+	center := body.WorldCenterOfMass().Plus(body.velocity.Multiply(dt))
+	body.r += body.angular_velocity * dt
+	body.setWorldCenterOfMass(center)
+}
+
+// Groups the dynamic bodies that touch or are jointed to each other, starting from the awake ones
+// Sleeping bodies that got touched are pulled into the island and woken, without resetting their sleep timers
+// Static and kinematic bodies don't join islands, otherwise everything sitting on the same floor would be one big island
+func (world *World) buildIslands() [][]*Body {
+	for _, c := range world.contacts {
+		if !c.solid() {
+			continue
+		}
+		a := c.body_a
+		b := c.body_b
+		if a.body_type == KINEMATIC_BODY && !b.awake {
+			b.WakeUp()
+		} else if b.body_type == KINEMATIC_BODY && !a.awake {
+			a.WakeUp()
+		}
+	}
+
+	for _, body := range world.bodies {
+		body.island_flag = false
+	}
+
+	islands := [][]*Body{}
+	stack := []*Body{}
+	visit := func(other *Body) {
+		if other.body_type == DYNAMIC_BODY && !other.island_flag {
+			other.island_flag = true
+			stack = append(stack, other)
+		}
+	}
+	for _, seed := range world.bodies {
+		if seed.island_flag || !seed.awake || seed.body_type != DYNAMIC_BODY {
+			continue
+		}
+		island := []*Body{}
+		seed.island_flag = true
+		stack = append(stack[:0], seed)
+		for len(stack) > 0 {
+			body := stack[len(stack) - 1]
+			stack = stack[:len(stack) - 1]
+			body.awake = true
+			island = append(island, body)
+			// Pairs of sleeping bodies still have the contacts they fell asleep with, so a whole sleeping pile wakes up at once
+			for _, pair := range body.pairs {
+				if pair.touching() {
+					visit(pair.other(body))
+				}
+			}
+			for _, joint := range body.joints {
+				base := joint.base()
+				if base.body_a == body {
+					visit(base.body_b)
+				} else {
+					visit(base.body_a)
+				}
+			}
+		}
+		islands = append(islands, island)
+	}
+	return islands
+}
+
+// Islands fall asleep all at once when every body in them has been resting long enough
+// Putting bodies to sleep one at a time would leave a sleeping box stuck under one that is still settling
+func (world *World) updateSleep(islands [][]*Body, dt float64) {
+	for _, body := range world.bodies {
+		if body.body_type == KINEMATIC_BODY {
+			// Kinematic bodies sleep whenever they aren't being moved
+			body.awake = body.velocity.X != 0 || body.velocity.Y != 0 || body.angular_velocity != 0
+		}
+	}
+
+	for _, island := range islands {
+		min_sleep_time := TimeToSleep
+		for _, body := range island {
+			resting := body.velocity.Dot(body.velocity) <= LinearSleepTolerance * LinearSleepTolerance &&
+				body.angular_velocity * body.angular_velocity <= AngularSleepTolerance * AngularSleepTolerance
+			if !body.sleeping_allowed || !resting {
+				body.sleep_time = 0
+			} else {
+				body.sleep_time += dt
+			}
+			if body.sleep_time < min_sleep_time {
+				min_sleep_time = body.sleep_time
+			}
+		}
+		if min_sleep_time >= TimeToSleep {
+			for _, body := range island {
+				body.SetAwake(false)
+			}
+		}
+	}
+}
+
+// New pairs come from the broad phase, which only looks at proxies that were added, moved or woke up since last step
+// Pairs stay until their fat boxes stop touching, and pairs where both bodies are asleep keep their contacts without being looked at again
+func (world *World) findContacts() {
+	world.tree.Pairs(func(proxy_a int, proxy_b int) {
+		a := world.tree.Data(proxy_a).(*Body)
+		b := world.tree.Data(proxy_b).(*Body)
+		if a.body_type != DYNAMIC_BODY && b.body_type != DYNAMIC_BODY {
+			return // Static and kinematic bodies pass through each other
+		}
+		// Keep pairs in a stable order so contacts line up from step to step
+		if b.id < a.id {
+			a, b = b, a
+		}
+		key := pairKey{body_a: a, body_b: b}
+		if _, ok := world.pair_keys[key]; ok {
+			return
+		}
+		pair := &bodyPair{body_a: a, body_b: b}
+		world.pair_keys[key] = pair
+		world.pairs = append(world.pairs, pair)
+		a.pairs = append(a.pairs, pair)
+		b.pairs = append(b.pairs, pair)
+	})
+
+	world.contacts = world.contacts[:0]
+	kept := world.pairs[:0]
+	for _, pair := range world.pairs {
+		if pair.removed {
+			continue
+		}
+		a := pair.body_a
+		b := pair.body_b
+		if a.body_type != DYNAMIC_BODY && b.body_type != DYNAMIC_BODY {
+			world.removePair(pair)
+			continue
+		}
+		if pair.collided && !a.active() && !b.active() {
+			// Neither one is going anywhere, so whatever was touching when they fell asleep still is
+			kept = append(kept, pair)
+			continue
+		}
+		if !world.tree.FatBounds(a.proxy).IntersectsAxisRect(world.tree.FatBounds(b.proxy)) {
+			world.removePair(pair)
+			continue
+		}
+		world.collidePair(pair)
+		world.contacts = append(world.contacts, pair.contacts...)
+		kept = append(kept, pair)
+	}
+	for i := len(kept); i < len(world.pairs); i++ {
+		world.pairs[i] = nil
+	}
+	world.pairs = kept
+}
+
+// Queues the pair's contacts up to end, it gets taken out of world.pairs on the next findContacts
+func (world *World) removePair(pair *bodyPair) {
+	if pair.removed {
+		return
+	}
+	pair.removed = true
+	world.ended = append(world.ended, pair.contacts...)
+	delete(world.pair_keys, pairKey{body_a: pair.body_a, body_b: pair.body_b})
+	for _, body := range []*Body{pair.body_a, pair.body_b} {
+		for i, other := range body.pairs {
+			if other == pair {
+				body.pairs = append(body.pairs[:i], body.pairs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Runs the narrow phase for the pair, carrying impulses over from last step and queueing up begin and end events
+func (world *World) collidePair(pair *bodyPair) {
+	old := pair.contacts
+	pair.contacts = nil
+	pair.collided = true
+	if pair.body_a.bounds.IntersectsAxisRect(pair.body_b.bounds) {
+		// Otherwise only the fattened boxes touch
+		pair.contacts = world.collideBodies(pair.body_a, pair.body_b, old)
+	}
+
+	for _, c := range pair.contacts {
+		if !containsShapes(old, c) {
+			world.began = append(world.began, c)
+		}
+	}
+	for _, c := range old {
+		if !containsShapes(pair.contacts, c) {
+			world.ended = append(world.ended, c)
+		}
+	}
+}
+
+func containsShapes(contacts []*contact, c *contact) bool {
+	for _, other := range contacts {
+		if other.sameShapes(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (world *World) collideBodies(a, b *Body, old []*contact) []*contact {
+	result := []*contact{}
+	for ia, shape_a := range a.world_shapes {
+		bounds_a := shape_a.BoundingBox()
+		for ib, shape_b := range b.world_shapes {
+			if !bounds_a.IntersectsAxisRect(shape_b.BoundingBox()) {
+				continue
+			}
+			if !world.shouldCollide(a, ia, b, ib) {
+				continue
+			}
+			manifold := shapes.Collide(shape_a, shape_b)
+			if manifold.Colliding() {
+				c := newContact(a, ia, b, ib, manifold)
+				for _, previous := range old {
+					if previous.sameShapes(c) {
+						c.warmStartFrom(previous)
+					}
+				}
+				result = append(result, c)
+			}
+		}
+	}
+	return result
+}
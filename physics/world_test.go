@@ -0,0 +1,121 @@
+package physics
+
+import (
+	"testing"
+
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// Columns of boxes sitting on a static floor, stepped until every box has fallen asleep
+func sleepingPile(t testing.TB, columns, rows int) (*World, []*Body) {
+	world := NewWorld(0, 500)
+	floor := NewBody(0, 400, 0, shapes.NewAxisRect(-100, 0, (columns * 40) + 200, 50))
+	floor.SetType(STATIC_BODY)
+	world.AddBody(floor)
+	boxes := []*Body{}
+	for col := 0; col < columns; col++ {
+		for row := 0; row < rows; row++ {
+			box := NewBody(float64(col * 40), 390 - (float64(row) * 20.5), 0, shapes.NewRectCentered(0, 0, 20, 20, 0))
+			world.AddBody(box)
+			boxes = append(boxes, box)
+		}
+	}
+	for i := 0; i < 600; i++ {
+		world.Step()
+		if allAsleep(boxes) {
+			return world, boxes
+		}
+	}
+	t.Fatalf("pile never fell asleep")
+	return nil, nil
+}
+
+func allAsleep(bodies []*Body) bool {
+	for _, body := range bodies {
+		if body.Awake() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSleepingBodiesAreSkipped(t *testing.T) {
+	world, boxes := sleepingPile(t, 5, 4)
+	pairs := len(world.pairs)
+	if pairs == 0 {
+		t.Fatalf("pile has no pairs")
+	}
+	positions := make([][3]float64, len(boxes))
+	for i, box := range boxes {
+		positions[i] = [3]float64{box.X(), box.Y(), box.R()}
+	}
+
+	narrow := 0
+	world.SetContactFilter(func(a *Body, shape_a int, b *Body, shape_b int) bool {
+		narrow += 1
+		return true
+	})
+	for i := 0; i < 10; i++ {
+		world.Step()
+		if world.tree.MovedCount() != 0 {
+			t.Fatalf("sleeping bodies left %d proxies to query", world.tree.MovedCount())
+		}
+	}
+	if narrow != 0 {
+		t.Errorf("sleeping pairs went through the narrow phase %d times", narrow)
+	}
+	if len(world.contacts) != 0 {
+		t.Errorf("expected no contacts to be collided, got %d", len(world.contacts))
+	}
+	if len(world.pairs) != pairs {
+		t.Errorf("pairs went from %d to %d while asleep", pairs, len(world.pairs))
+	}
+	for i, box := range boxes {
+		if positions[i] != [3]float64{box.X(), box.Y(), box.R()} {
+			t.Errorf("sleeping box %d moved", i)
+		}
+		touching := false
+		for _, pair := range box.pairs {
+			touching = touching || pair.touching()
+		}
+		if !touching {
+			t.Errorf("sleeping box %d lost the contacts it fell asleep with", i)
+		}
+	}
+}
+
+func TestWakingOneBodyWakesItsPile(t *testing.T) {
+	world, boxes := sleepingPile(t, 3, 4)
+	// Bottom box of the middle column, everything stacked on it has to wake with it
+	boxes[4].ApplyImpulse(0, -1, boxes[4].X(), boxes[4].Y())
+	world.Step()
+	for i := 4; i < 8; i++ {
+		if !boxes[i].Awake() {
+			t.Errorf("box %d in the nudged column is still asleep", i)
+		}
+	}
+}
+
+func TestRemovingABodyWakesWhatRestsOnIt(t *testing.T) {
+	world, boxes := sleepingPile(t, 1, 3)
+	top := boxes[2]
+	y := top.Y()
+	world.RemoveBody(boxes[0])
+	if !boxes[1].Awake() {
+		t.Fatalf("box resting on the removed one is still asleep")
+	}
+	for i := 0; i < 30; i++ {
+		world.Step()
+	}
+	if top.Y() <= y + 5 {
+		t.Errorf("stack didn't fall after its bottom box was removed, top went from %v to %v", y, top.Y())
+	}
+}
+
+func BenchmarkStepSleepingPile(b *testing.B) {
+	world, _ := sleepingPile(b, 100, 5)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		world.Step()
+	}
+}
@@ -1,5 +1,10 @@
 package shapes
 
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
 type AxisRect struct {
 	x int
 	y int
@@ -62,9 +67,6 @@ func (rect *AxisRect) SetPosition(x int, y int) {
 	rect.y2 = rect.y + rect.h
 }
 
-func (rect AxisRect) Translated(x int, y int) AxisRect {
-	return NewAxisRect(rect.x + x, rect.y + y, rect.w, rect.h)
-}
 
 func (rect *AxisRect) SetSize(w int, h int) {
 	rect.w = w
@@ -84,34 +86,6 @@ func (rect *AxisRect) SetSize(w int, h int) {
 	rect.y2 = rect.y + rect.h
 }
 
-/*func (rect AxisRect) Intersects(other Shape) bool { // TODO: handle pointer types too
-	switch other.(type) {
-		case AxisRect:
-			return rect.IntersectsAxisRect(other.(AxisRect))
-		case Circle:
-			return rect.IntersectsCircle(other.(Circle))
-		case Ray:
-			return other.(Ray).Intersects(rect)
-		default:
-		    // Don't know how to handle this
-		    return false
-	}
-}
-
-func (rect AxisRect) Encloses(other Shape) bool { // TODO: handle pointer types too
-	switch other.(type) {
-		case AxisRect:
-			return rect.EnclosesAxisRect(other.(AxisRect))
-		case Circle:
-			return rect.EnclosesCircle(other.(Circle))
-		case Ray:
-			return other.(Ray).Encloses(rect)
-		default:
-		    // Don't know how to handle this
-		    return false
-	}
-}*/
-
 func (rect AxisRect) IntersectsAxisRect(other AxisRect) bool {
 	bigx := other.x2 + rect.w
 	if (rect.x2 >= other.x && rect.x2 <= bigx) {
@@ -125,61 +99,107 @@ func (rect AxisRect) EnclosesAxisRect(other AxisRect) bool {
 	return (other.x >= rect.x && other.x2 <= rect.x2 && other.y >= rect.y && other.y2 <= rect.y2)
 }
 
-/*func (rect AxisRect) IntersectsCircle(other Circle) bool {
-	return other.Intersects(rect)
+// Smallest AxisRect containing both rects
+func (rect AxisRect) Union(other AxisRect) AxisRect {
+	x := utils.MinInt(rect.x, other.x)
+	y := utils.MinInt(rect.y, other.y)
+	return NewAxisRect(x, y, utils.MaxInt(rect.x2, other.x2) - x, utils.MaxInt(rect.y2, other.y2) - y)
 }
 
-func (rect AxisRect) EnclosesCircle(other Circle) bool {
-	return (other.x - other.r >= float64(rect.x) && other.x + other.r <= float64(rect.x2) && other.y - other.r >= float64(rect.y) && other.y + other.r <= float64(rect.y2))
-}*/
-
 func (rect AxisRect) ContainsPoint(x float64, y float64) bool {
 	return x >= float64(rect.x) && x <= float64(rect.x2) && y >= float64(rect.y) && y <= float64(rect.y2)
 }
 
-/*func (rect AxisRect) SweepAxisRect(dirx float64, diry float64, other AxisRect) (float64, float64, float64) {
+// Builds the smallest AxisRect on the integer grid that contains the given float bounds
+func boundingBoxFromFloats(minx, miny, maxx, maxy float64) AxisRect {
+	x := int(math.Floor(minx))
+	y := int(math.Floor(miny))
+	return NewAxisRect(x, y, int(math.Ceil(maxx)) - x, int(math.Ceil(maxy)) - y)
+}
+
+// SHAPE INTERFACE METHODS
+func (rect AxisRect) BoundingBox() AxisRect {
+	return rect
+}
+func (rect AxisRect) Center() utils.FloatPair {
+	return utils.FloatPair{
+		X: float64(rect.x) + (float64(rect.w) / 2),
+		Y: float64(rect.y) + (float64(rect.h) / 2),
+	}
+}
+// Moving by whole pixels keeps it an AxisRect, anything else gives back an unrotated Rect so the sub pixel part isn't lost
+func (rect AxisRect) Translated(x, y float64) Shape {
+	if x == math.Trunc(x) && y == math.Trunc(y) {
+		return NewAxisRect(rect.x + int(x), rect.y + int(y), rect.w, rect.h)
+	}
+	return NewRect(float64(rect.x) + x, float64(rect.y) + y, float64(rect.w), float64(rect.h), 0)
+}
+// A rotated AxisRect generally isn't axis aligned anymore, so this always gives back a Rect
+func (rect AxisRect) Rotated(r float64) Shape {
+	return NewRect(float64(rect.x), float64(rect.y), float64(rect.w), float64(rect.h), r)
+}
+func (rect AxisRect) TestCollision(o Shape) Manifold {
+	return Collide(rect, o)
+}
+func (rect AxisRect) Intersects(o Shape) bool {
+	return Intersects(rect, o)
+}
+func (rect AxisRect) Encloses(o Shape) bool {
+	return Encloses(rect, o)
+}
+
+// Slides the rect along dirx, diry and finds when during that move it first touches other
+// Rects that are touching or already overlapping only hit if they're moving further into each other
+func (rect AxisRect) SweepAxisRect(dirx float64, diry float64, other AxisRect) SweepHit {
+	x, y := float64(rect.x), float64(rect.y)
+	x2, y2 := float64(rect.x2), float64(rect.y2)
+	ox, oy := float64(other.x), float64(other.y)
+	ox2, oy2 := float64(other.x2), float64(other.y2)
+
 	// Check if its already inside
-	if rect.IntersectsAxisRect(other) {
-		return 0.0, 0.0, 0.0
+	overlap_x := x < ox2 && x2 > ox
+	overlap_y := y < oy2 && y2 > oy
+	if overlap_x && overlap_y {
+		return overlapHit(collideAxisRects(rect, other), utils.FloatPair{X: dirx, Y: diry})
 	}
 
-	// returns time of collision, and collision normal (x, y)
 	var dxEntry, dxExit, dyEntry, dyExit float64
 	var txEntry, txExit, tyEntry, tyExit float64
 
 	if dirx > 0.0 {
-		dxEntry = other.x - rect.x2
-		dxExit = other.x2 - rect.x
+		dxEntry = ox - x2
+		dxExit = ox2 - x
 	} else {
-		dxEntry = other.x2 - rect.x
-		dxExit = other.x - rect.x2
+		dxEntry = ox2 - x
+		dxExit = ox - x2
 	}
 	if diry > 0.0 {
-		dyEntry = other.y - rect.y2
-		dyExit = other.y2 - rect.y
+		dyEntry = oy - y2
+		dyExit = oy2 - y
 	} else {
-		dyEntry = other.y2 - rect.y
-		dyExit = other.y - rect.y2
+		dyEntry = oy2 - y
+		dyExit = oy - y2
 	}
 
+	// Not moving on an axis means we're either always inside that slab or never
 	if dirx == 0.0 {
-		if !(rect.x2 < other.x || rect.x > other.x) {
-			txEntry = 0.0
+		if overlap_x {
+			txEntry = math.Inf(-1)
 		} else {
-			txEntry = 2.0
+			txEntry = math.Inf(1)
 		}
-		txExit = 2.0
+		txExit = math.Inf(1)
 	} else {
 		txEntry = dxEntry / dirx
 		txExit = dxExit / dirx
 	}
 	if diry == 0.0 {
-		if !(rect.y2 < other.y || rect.y > other.y) {
-			tyEntry = 0.0
+		if overlap_y {
+			tyEntry = math.Inf(-1)
 		} else {
-			tyEntry = 2.0
+			tyEntry = math.Inf(1)
 		}
-		tyExit = 2.0
+		tyExit = math.Inf(1)
 	} else {
 		tyEntry = dyEntry / diry
 		tyExit = dyExit / diry
@@ -188,26 +208,29 @@ func (rect AxisRect) ContainsPoint(x float64, y float64) bool {
 	tEntry := math.Max(txEntry, tyEntry)
 	tExit := math.Min(txExit, tyExit)
 
-	if tEntry > tExit || tEntry < 0.0 || txEntry > 1.0 || tyEntry > 1.0{
-		return 2.0, 0.0, 0.0
+	if tEntry >= tExit || tEntry < 0.0 || tEntry > 1.0 {
+		return missedSweep()
 	}
 
-	normalX := 0.0
-	normalY := 0.0
-	if txEntry < tyEntry {
-		if dyEntry > 0.0 {
-			normalY = -1.0
-		} else {
-			normalY = 1.0
+	// Hit on whichever face we crossed into last, with the point in the middle of where the faces meet
+	result := SweepHit{Hit: true, Time: tEntry}
+	mx := x + (dirx * tEntry)
+	my := y + (diry * tEntry)
+	if txEntry > tyEntry {
+		result.Normal.X = -math.Copysign(1, dirx)
+		result.Point.X = ox
+		if dirx < 0 {
+			result.Point.X = ox2
 		}
+		result.Point.Y = (math.Max(my, oy) + math.Min(my + float64(rect.h), oy2)) / 2
 	} else {
-		if dxEntry > 0.0 {
-			normalX = -1.0
-		} else {
-			normalX = 1.0
+		result.Normal.Y = -math.Copysign(1, diry)
+		result.Point.Y = oy
+		if diry < 0 {
+			result.Point.Y = oy2
 		}
+		result.Point.X = (math.Max(mx, ox) + math.Min(mx + float64(rect.w), ox2)) / 2
 	}
-
-	return tEntry, normalX, normalY
-}*/
+	return result
+}
 
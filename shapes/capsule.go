@@ -0,0 +1,128 @@
+package shapes
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// A segment grown by a radius, good for characters since the round ends slide over ledges instead of snagging on them
+type Capsule struct {
+	start utils.FloatPair
+	end utils.FloatPair
+	radius float64
+}
+
+// Getters
+func (capsule Capsule) Start() utils.FloatPair {
+	return capsule.start
+}
+func (capsule Capsule) End() utils.FloatPair {
+	return capsule.end
+}
+func (capsule Capsule) Radius() float64 {
+	return capsule.radius
+}
+// End getters
+
+func NewCapsule(x1, y1, x2, y2, r float64) Capsule {
+	return Capsule{
+		start: utils.FloatPair{X: x1, Y: y1},
+		end: utils.FloatPair{X: x2, Y: y2},
+		radius: math.Abs(r),
+	}
+}
+
+// Standing capsule that fills the box at x, y with size w, h, the radius is half the width
+func NewUprightCapsule(x, y, w, h float64) Capsule {
+	r := w / 2
+	if h < w {
+		// Too short to be anything but a circle
+		return NewCapsule(x + r, y + (h / 2), x + r, y + (h / 2), r)
+	}
+	return NewCapsule(x + r, y + r, x + r, y + h - r, r)
+}
+
+func (capsule *Capsule) SetPosition(x float64, y float64) {
+	// Moves the capsule so its center ends up at x, y
+	offset := utils.FloatPair{X: x, Y: y}.Minus(capsule.Center())
+	capsule.start = capsule.start.Plus(offset)
+	capsule.end = capsule.end.Plus(offset)
+}
+
+func (capsule *Capsule) Translate(x float64, y float64) {
+	offset := utils.FloatPair{X: x, Y: y}
+	capsule.start = capsule.start.Plus(offset)
+	capsule.end = capsule.end.Plus(offset)
+}
+
+func (capsule *Capsule) SetRadius(r float64) {
+	capsule.radius = math.Abs(r)
+}
+
+func (capsule Capsule) convex() convex {
+	return convex{points: []utils.FloatPair{capsule.start, capsule.end}, radius: capsule.radius}
+}
+
+func (capsule Capsule) BBIntersectsAxisRect(other AxisRect) bool {
+	// Quick check to see if the bounding box of the capsule intersects another rect, for faster pre-checks in quad trees
+	minx := math.Min(capsule.start.X, capsule.end.X) - capsule.radius
+	maxx := math.Max(capsule.start.X, capsule.end.X) + capsule.radius
+	miny := math.Min(capsule.start.Y, capsule.end.Y) - capsule.radius
+	maxy := math.Max(capsule.start.Y, capsule.end.Y) + capsule.radius
+	return !((maxx < float64(other.x)) || (minx > float64(other.x2)) || (maxy < float64(other.y)) || (miny > float64(other.y2)))
+}
+
+// Vector that moves the capsule out of the other shape, and how far that is
+func (capsule Capsule) SeparationFor(other Shape) (utils.FloatPair, float64) {
+	m := Collide(capsule, other)
+	if !m.Colliding() {
+		return utils.FloatPair{}, 0
+	}
+	return m.Normal.Multiply(-m.Depth), m.Depth
+}
+
+func (capsule Capsule) SeparationForAxisRect(other AxisRect) (utils.FloatPair, float64) {
+	if !capsule.BBIntersectsAxisRect(other) {
+		return utils.FloatPair{}, 0
+	}
+	return capsule.SeparationFor(other)
+}
+
+func (capsule Capsule) SeparationForCircle(other Circle) (utils.FloatPair, float64) {
+	return capsule.SeparationFor(other)
+}
+
+// SHAPE INTERFACE METHODS
+func (capsule Capsule) BoundingBox() AxisRect {
+	return boundingBoxFromFloats(
+		math.Min(capsule.start.X, capsule.end.X) - capsule.radius,
+		math.Min(capsule.start.Y, capsule.end.Y) - capsule.radius,
+		math.Max(capsule.start.X, capsule.end.X) + capsule.radius,
+		math.Max(capsule.start.Y, capsule.end.Y) + capsule.radius)
+}
+func (capsule Capsule) Center() utils.FloatPair {
+	return capsule.start.Plus(capsule.end).Multiply(0.5)
+}
+func (capsule Capsule) Translated(x, y float64) Shape {
+	capsule.Translate(x, y)
+	return capsule
+}
+func (capsule Capsule) Rotated(r float64) Shape {
+	center := capsule.Center()
+	capsule.start = capsule.start.Minus(center).Rotated(r).Plus(center)
+	capsule.end = capsule.end.Minus(center).Rotated(r).Plus(center)
+	return capsule
+}
+func (capsule Capsule) ContainsPoint(x float64, y float64) bool {
+	p := utils.FloatPair{X: x, Y: y}
+	return closestPointOnSegment(capsule.start, capsule.end, p).DistanceTo(p) <= capsule.radius
+}
+func (capsule Capsule) TestCollision(o Shape) Manifold {
+	return Collide(capsule, o)
+}
+func (capsule Capsule) Intersects(o Shape) bool {
+	return Intersects(capsule, o)
+}
+func (capsule Capsule) Encloses(o Shape) bool {
+	return Encloses(capsule, o)
+}
@@ -12,6 +12,18 @@ type Circle struct {
 	radius_squared float64
 }
 
+// Getters
+func (circ Circle) X() float64 {
+	return circ.pos.X
+}
+func (circ Circle) Y() float64 {
+	return circ.pos.Y
+}
+func (circ Circle) Radius() float64 {
+	return circ.radius
+}
+// End getters
+
 func (circ *Circle) Init(x float64, y float64, r float64) {
 	circ.pos = utils.FloatPair {
 		X: x,
@@ -56,6 +68,26 @@ func (circ Circle) SeparationForAxisRect(other AxisRect) (utils.FloatPair, float
 		return utils.FloatPair{}, 0
 	}
 
+	if squared_dist_to_closest == 0 {
+		// The center is inside the rect, so push out through whichever edge is nearest
+		left := circ.pos.X - float64(other.x)
+		right := float64(other.x2) - circ.pos.X
+		top := circ.pos.Y - float64(other.y)
+		bottom := float64(other.y2) - circ.pos.Y
+		nearest := math.Min(math.Min(left, right), math.Min(top, bottom))
+		depth := nearest + circ.radius
+		switch nearest {
+		case left:
+			return utils.FloatPair{X: -depth}, depth
+		case right:
+			return utils.FloatPair{X: depth}, depth
+		case top:
+			return utils.FloatPair{Y: -depth}, depth
+		default:
+			return utils.FloatPair{Y: depth}, depth
+		}
+	}
+
 	dist := math.Sqrt(squared_dist_to_closest)
 	closest := utils.FloatPair{X: closest_x, Y: closest_y}
 	return closest.Minus(circ.pos).Normalized().Multiply(-(circ.radius - dist)), math.Abs(circ.radius - dist)
@@ -67,16 +99,30 @@ func (circ Circle) BBIntersectsAxisRect(other AxisRect) bool {
 }
 
 // SHAPE INTERFACE METHODS
+func (circ Circle) BoundingBox() AxisRect {
+	return boundingBoxFromFloats(circ.pos.X - circ.radius, circ.pos.Y - circ.radius, circ.pos.X + circ.radius, circ.pos.Y + circ.radius)
+}
+func (circ Circle) Center() utils.FloatPair {
+	return circ.pos
+}
 func (circ Circle) Translated(x, y float64) Shape {
-	return NewCircle(circ.x + x, circ.y + y, circ.r)
+	return NewCircle(circ.pos.X + x, circ.pos.Y + y, circ.radius)
 }
 func (circ Circle) Rotated(r float64) Shape {
-	return NewCircle(circ.x, circ.y, circ.r + r)
-}
-func (circ Circle) TestCollision(o Shape) (float64, utils.FloatPair, utils.FloatPair) {
-	// TODO: for now just against other circles
-	var depth = -(circ.pos.DistanceTo(o.pos) - circ.radius - o.radius)
-	var dir = o.pos.Minus(circ.pos).Normalized()
-	var p1 = circ.pos.Plus(dir.Multiply(circ.r))
-	var p1 = o.pos.Plus(dir.Negative().Multiply(o.r))
+	// Rotating a circle around its own center doesn't change it
+	return circ
+}
+func (circ Circle) ContainsPoint(x float64, y float64) bool {
+	dx := x - circ.pos.X
+	dy := y - circ.pos.Y
+	return (dx * dx) + (dy * dy) <= circ.radius_squared
+}
+func (circ Circle) TestCollision(o Shape) Manifold {
+	return Collide(circ, o)
+}
+func (circ Circle) Intersects(o Shape) bool {
+	return Intersects(circ, o)
+}
+func (circ Circle) Encloses(o Shape) bool {
+	return Encloses(circ, o)
 }
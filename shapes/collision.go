@@ -0,0 +1,156 @@
+package shapes
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+type Contact struct {
+	Point utils.FloatPair
+	Depth float64
+}
+
+// Result of a narrow phase test between two shapes
+// Moving the second shape along Normal by Depth (or the first one the opposite way) separates them
+type Manifold struct {
+	Normal utils.FloatPair // Points from the first shape towards the second
+	Depth float64 // Deepest of the contacts
+	Contacts [2]Contact
+	ContactCount int
+}
+
+func (m Manifold) Colliding() bool {
+	return m.ContactCount > 0
+}
+
+// The same manifold from the point of view of the second shape
+func (m Manifold) Flipped() Manifold {
+	m.Normal = m.Normal.Negative()
+	return m
+}
+
+func (m *Manifold) addContact(point utils.FloatPair, depth float64) {
+	if m.ContactCount >= len(m.Contacts) {
+		return
+	}
+	m.Contacts[m.ContactCount] = Contact{Point: point, Depth: depth}
+	m.ContactCount += 1
+	if depth > m.Depth {
+		m.Depth = depth
+	}
+}
+
+// Narrow phase test between any two shapes
+// Pairs with a cheap exact test get it, everything else goes through the general convex test
+func Collide(a, b Shape) Manifold {
+	a = shapeValue(a)
+	b = shapeValue(b)
+
+	switch sa := a.(type) {
+	case Circle:
+		switch sb := b.(type) {
+		case Circle:
+			return collideCircles(sa, sb)
+		case AxisRect:
+			return collideCircleAxisRect(sa, sb)
+		case Rect:
+			return collideCircleRect(sa, sb)
+		}
+	case AxisRect:
+		switch sb := b.(type) {
+		case Circle:
+			return collideCircleAxisRect(sb, sa).Flipped()
+		case AxisRect:
+			return collideAxisRects(sa, sb)
+		case Rect:
+			return collideRects(NewRectFromAxisRect(sa), sb)
+		}
+	case Rect:
+		switch sb := b.(type) {
+		case Circle:
+			return collideCircleRect(sb, sa).Flipped()
+		case AxisRect:
+			return collideRects(sa, NewRectFromAxisRect(sb))
+		case Rect:
+			return collideRects(sa, sb)
+		}
+	}
+
+	ca, ok := convexOf(a)
+	if !ok {
+		// Don't know how to handle this
+		return Manifold{}
+	}
+	cb, ok := convexOf(b)
+	if !ok {
+		return Manifold{}
+	}
+	return collideConvex(ca, cb)
+}
+
+func collideCircles(a, b Circle) Manifold {
+	result := Manifold{}
+	depth := -(a.pos.DistanceTo(b.pos) - a.radius - b.radius)
+	if depth <= 0 {
+		return result
+	}
+	dir := b.pos.Minus(a.pos).Normalized()
+	if dir.X == 0 && dir.Y == 0 {
+		// Same center, any direction is as good as any other
+		dir = utils.FloatPair{X: 1}
+	}
+	result.Normal = dir
+	// Contact sits halfway between the two surfaces
+	surface := a.pos.Plus(dir.Multiply(a.radius))
+	result.addContact(surface.Minus(dir.Multiply(depth / 2)), depth)
+	return result
+}
+
+func collideCircleAxisRect(circ Circle, rect AxisRect) Manifold {
+	result := Manifold{}
+	if !circ.BBIntersectsAxisRect(rect) {
+		return result
+	}
+	sep, depth := circ.SeparationForAxisRect(rect)
+	if depth <= 0 {
+		return result
+	}
+	// The separation pushes the circle out of the rect, so the rect is in the opposite direction
+	result.Normal = sep.Normalized().Negative()
+	surface := circ.pos.Plus(result.Normal.Multiply(circ.radius))
+	result.addContact(surface.Minus(result.Normal.Multiply(depth / 2)), depth)
+	return result
+}
+
+func collideAxisRects(a, b AxisRect) Manifold {
+	result := Manifold{}
+	overlap_x := math.Min(float64(a.x2), float64(b.x2)) - math.Max(float64(a.x), float64(b.x))
+	overlap_y := math.Min(float64(a.y2), float64(b.y2)) - math.Max(float64(a.y), float64(b.y))
+	if overlap_x <= 0 || overlap_y <= 0 {
+		return result
+	}
+
+	// Resolve along whichever axis has the least overlap, with contacts at both ends of the overlapping edges
+	center := a.Center()
+	other_center := b.Center()
+	if overlap_x < overlap_y {
+		mid_x := (math.Max(float64(a.x), float64(b.x)) + math.Min(float64(a.x2), float64(b.x2))) / 2
+		start_y := math.Max(float64(a.y), float64(b.y))
+		result.Normal = utils.FloatPair{X: 1}
+		if other_center.X < center.X {
+			result.Normal = utils.FloatPair{X: -1}
+		}
+		result.addContact(utils.FloatPair{X: mid_x, Y: start_y}, overlap_x)
+		result.addContact(utils.FloatPair{X: mid_x, Y: start_y + overlap_y}, overlap_x)
+		return result
+	}
+	mid_y := (math.Max(float64(a.y), float64(b.y)) + math.Min(float64(a.y2), float64(b.y2))) / 2
+	start_x := math.Max(float64(a.x), float64(b.x))
+	result.Normal = utils.FloatPair{Y: 1}
+	if other_center.Y < center.Y {
+		result.Normal = utils.FloatPair{Y: -1}
+	}
+	result.addContact(utils.FloatPair{X: start_x, Y: mid_y}, overlap_y)
+	result.addContact(utils.FloatPair{X: start_x + overlap_x, Y: mid_y}, overlap_y)
+	return result
+}
@@ -0,0 +1,101 @@
+package shapes
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+)
+
+// Slack for enclosing tests, so shapes sharing an edge still count as inside each other
+const enclosesTolerance = 1e-9
+
+// True if the two shapes overlap, just touching along an edge doesn't count
+func Intersects(a, b Shape) bool {
+	return Collide(a, b).Colliding()
+}
+
+// True if every part of b is inside a
+func Encloses(a, b Shape) bool {
+	a = shapeValue(a)
+	b = shapeValue(b)
+
+	if ra, ok := a.(AxisRect); ok {
+		if rb, ok := b.(AxisRect); ok {
+			return ra.EnclosesAxisRect(rb)
+		}
+	}
+
+	ca, ok := convexOf(a)
+	if !ok || len(ca.points) == 0 {
+		return false
+	}
+	cb, ok := convexOf(b)
+	if !ok || len(cb.points) == 0 {
+		return false
+	}
+	return enclosesConvex(ca, cb)
+}
+
+// b's core has to fit inside a once a has been shrunk by b's radius
+// Distance to a convex core is convex too, so only b's corners need checking
+func enclosesConvex(a, b convex) bool {
+	if a.radius >= b.radius {
+		for _, p := range b.points {
+			if a.distanceToCore(p) > a.radius - b.radius + enclosesTolerance {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Shrinking a by more than its own radius eats into the core, which only a polygon has room for
+	if len(a.points) < 3 {
+		return false
+	}
+	shrink := b.radius - a.radius
+	center := a.center()
+	for i := range a.points {
+		normal := a.outwardNormal(i, center)
+		for _, p := range b.points {
+			if normal.Dot(p.Minus(a.points[i])) > -shrink + enclosesTolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Middle of the core's points, always inside the core
+func (c convex) center() utils.FloatPair {
+	center := utils.FloatPair{}
+	for _, p := range c.points {
+		center = center.Plus(p)
+	}
+	return center.Multiply(1 / float64(len(c.points)))
+}
+
+// Normal of the edge starting at point i, facing away from center whichever way the points wind
+func (c convex) outwardNormal(i int, center utils.FloatPair) utils.FloatPair {
+	start, end := c.edge(i)
+	normal := end.Minus(start).Perpendicular().Normalized()
+	if normal.Dot(center.Minus(start)) > 0 {
+		return normal.Negative()
+	}
+	return normal
+}
+
+// How far p is from the core, 0 if it's inside a polygon core
+func (c convex) distanceToCore(p utils.FloatPair) float64 {
+	if len(c.points) >= 3 {
+		inside := true
+		center := c.center()
+		for i := range c.points {
+			if c.outwardNormal(i, center).Dot(p.Minus(c.points[i])) > 0 {
+				inside = false
+				break
+			}
+		}
+		if inside {
+			return 0
+		}
+	}
+	return c.closestCorePoint(p).DistanceTo(p)
+}
@@ -0,0 +1,322 @@
+package shapes
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Sine of the angle between two edges under which we treat them as lying flat against each other
+const flatEdgeTolerance = 0.1
+
+// Every shape we collide generically boils down to a convex core (a point, a segment or a convex polygon) grown by a radius
+type convex struct {
+	points []utils.FloatPair
+	radius float64
+}
+
+func convexOf(shape Shape) (convex, bool) {
+	switch s := shapeValue(shape).(type) {
+	case Circle:
+		return convex{points: []utils.FloatPair{s.pos}, radius: s.radius}, true
+	case AxisRect:
+		return convex{points: []utils.FloatPair{
+			{X: float64(s.x), Y: float64(s.y)},
+			{X: float64(s.x2), Y: float64(s.y)},
+			{X: float64(s.x2), Y: float64(s.y2)},
+			{X: float64(s.x), Y: float64(s.y2)},
+		}}, true
+	case Rect:
+		return s.convex(), true
+	case Polygon:
+		return convex{points: s.points}, true
+	case Capsule:
+		return s.convex(), true
+	case Line:
+		return convex{points: []utils.FloatPair{
+			{X: float64(s.x), Y: float64(s.y)},
+			{X: float64(s.x + s.dirx), Y: float64(s.y + s.diry)},
+		}}, true
+	case Segment:
+		return convex{points: []utils.FloatPair{s.start, s.end}}, true
+	case Ray:
+		return convex{points: []utils.FloatPair{s.origin, s.PointAt(rayReach)}}, true
+	}
+	return convex{}, false
+}
+
+// Projection of the whole shape, radius included, onto the axis
+func (c convex) project(axis utils.FloatPair) (float64, float64) {
+	min := math.Inf(1)
+	max := math.Inf(-1)
+	for _, p := range c.points {
+		d := p.Dot(axis)
+		min = math.Min(min, d)
+		max = math.Max(max, d)
+	}
+	return min - c.radius, max + c.radius
+}
+
+func (c convex) edgeCount() int {
+	switch len(c.points) {
+	case 0, 1:
+		return 0
+	case 2:
+		return 1
+	}
+	return len(c.points)
+}
+
+func (c convex) edge(i int) (utils.FloatPair, utils.FloatPair) {
+	return c.points[i], c.points[(i + 1) % len(c.points)]
+}
+
+func (c convex) normals() []utils.FloatPair {
+	result := make([]utils.FloatPair, 0, c.edgeCount())
+	for i := 0; i < c.edgeCount(); i++ {
+		start, end := c.edge(i)
+		normal := end.Minus(start).Perpendicular().Normalized()
+		if normal.X != 0 || normal.Y != 0 {
+			result = append(result, normal)
+		}
+	}
+	return result
+}
+
+func closestPointOnSegment(start, end, p utils.FloatPair) utils.FloatPair {
+	dir := end.Minus(start)
+	len_squared := dir.Dot(dir)
+	if len_squared == 0 {
+		return start
+	}
+	t := utils.ClampFloat64(p.Minus(start).Dot(dir) / len_squared, 0, 1)
+	return start.Plus(dir.Multiply(t))
+}
+
+// Closest point on the outline of the core, so points inside a polygon core still get pushed to an edge
+func (c convex) closestCorePoint(p utils.FloatPair) utils.FloatPair {
+	if len(c.points) == 1 {
+		return c.points[0]
+	}
+	best := c.points[0]
+	best_dist := math.Inf(1)
+	for i := 0; i < c.edgeCount(); i++ {
+		start, end := c.edge(i)
+		closest := closestPointOnSegment(start, end, p)
+		dist := closest.Minus(p).Length()
+		if dist < best_dist {
+			best_dist = dist
+			best = closest
+		}
+	}
+	return best
+}
+
+// Closest pair of points between the two cores, only meaningful when the cores don't overlap
+func closestCorePoints(a, b convex) (utils.FloatPair, utils.FloatPair) {
+	best_a := a.points[0]
+	best_b := b.points[0]
+	best_dist := math.Inf(1)
+	for _, p := range a.points {
+		closest := b.closestCorePoint(p)
+		dist := closest.Minus(p).Length()
+		if dist < best_dist {
+			best_dist = dist
+			best_a = p
+			best_b = closest
+		}
+	}
+	for _, p := range b.points {
+		closest := a.closestCorePoint(p)
+		dist := closest.Minus(p).Length()
+		if dist < best_dist {
+			best_dist = dist
+			best_a = closest
+			best_b = p
+		}
+	}
+	return best_a, best_b
+}
+
+// The part of the core furthest along dir, either a single point or an edge
+func (c convex) feature(dir utils.FloatPair) []utils.FloatPair {
+	if len(c.points) <= 2 {
+		return c.points
+	}
+
+	best := 0
+	best_dot := math.Inf(-1)
+	for i, p := range c.points {
+		d := p.Dot(dir)
+		if d > best_dot {
+			best_dot = d
+			best = i
+		}
+	}
+
+	// Of the two edges touching the support point, take whichever faces dir the most
+	prev := c.points[(best + len(c.points) - 1) % len(c.points)]
+	next := c.points[(best + 1) % len(c.points)]
+	support := c.points[best]
+	if math.Abs(support.Minus(prev).Normalized().Dot(dir)) <= math.Abs(next.Minus(support).Normalized().Dot(dir)) {
+		return []utils.FloatPair{prev, support}
+	}
+	return []utils.FloatPair{support, next}
+}
+
+// Separating axis test between two convex shapes
+// The candidate axes are the edge normals of both cores plus the direction between their closest points, which covers the rounded parts
+func collideConvex(a, b convex) Manifold {
+	if len(a.points) == 0 || len(b.points) == 0 {
+		return Manifold{}
+	}
+
+	axes := append(a.normals(), b.normals()...)
+	if a.radius > 0 || b.radius > 0 {
+		closest_a, closest_b := closestCorePoints(a, b)
+		closest_axis := closest_b.Minus(closest_a).Normalized()
+		if closest_axis.X != 0 || closest_axis.Y != 0 {
+			axes = append(axes, closest_axis)
+		}
+	}
+	if len(axes) == 0 {
+		// Two circles with the same center, any direction is as good as any other
+		axes = append(axes, utils.FloatPair{X: 1})
+	}
+	return collideConvexOnAxes(a, b, axes)
+}
+
+// True if none of the axes separate the two shapes
+func overlapsOnAxes(a, b convex, axes []utils.FloatPair) bool {
+	for _, axis := range axes {
+		amin, amax := a.project(axis)
+		bmin, bmax := b.project(axis)
+		if amax <= bmin || bmax <= amin {
+			return false
+		}
+	}
+	return true
+}
+
+// SAT over a caller supplied set of axes, which has to contain every axis that could separate the two shapes
+func collideConvexOnAxes(a, b convex, axes []utils.FloatPair) Manifold {
+	result := Manifold{}
+	depth := math.Inf(1)
+	normal := utils.FloatPair{}
+	for _, axis := range axes {
+		amin, amax := a.project(axis)
+		bmin, bmax := b.project(axis)
+		forward := amax - bmin
+		backward := bmax - amin
+		if forward <= 0 || backward <= 0 {
+			// Found a separating axis
+			return result
+		}
+		if forward < depth {
+			depth = forward
+			normal = axis
+		}
+		if backward < depth {
+			depth = backward
+			normal = axis.Negative()
+		}
+	}
+	result.Normal = normal
+
+	feature_a := a.feature(normal)
+	feature_b := b.feature(normal.Negative())
+
+	if (a.radius > 0 || b.radius > 0) && !(facesNormal(feature_a, normal) && facesNormal(feature_b, normal)) {
+		// Rounded parts touching while the cores stay apart, the contact is between the closest points
+		// Two edges lying flat against each other still get clipped below so they end up with two contacts
+		closest_a, closest_b := closestCorePoints(a, b)
+		closest_axis := closest_b.Minus(closest_a).Normalized()
+		core_dist := closest_b.Minus(closest_a).Length()
+		if core_dist > 0 && normal.Dot(closest_axis) > 1 - 1e-9 && depth <= a.radius + b.radius - core_dist + 1e-9 {
+			surface := closest_a.Plus(normal.Multiply(a.radius))
+			result.addContact(surface.Minus(normal.Multiply(depth / 2)), depth)
+			return result
+		}
+	}
+
+	if len(feature_a) == 1 {
+		surface := feature_a[0].Plus(normal.Multiply(a.radius))
+		result.addContact(surface.Minus(normal.Multiply(depth / 2)), depth)
+		return result
+	}
+	if len(feature_b) == 1 {
+		surface := feature_b[0].Minus(normal.Multiply(b.radius))
+		result.addContact(surface.Plus(normal.Multiply(depth / 2)), depth)
+		return result
+	}
+
+	// Two edges, clip the incident edge against the sides of the reference edge
+	_, amax := a.project(normal)
+	bmin, _ := b.project(normal)
+	tangent := normal.Perpendicular()
+	dir_a := feature_a[1].Minus(feature_a[0]).Normalized()
+	dir_b := feature_b[1].Minus(feature_b[0]).Normalized()
+	reference, incident := feature_a, feature_b
+	incident_is_b := true
+	if math.Abs(dir_a.Dot(normal)) > math.Abs(dir_b.Dot(normal)) {
+		reference, incident = feature_b, feature_a
+		incident_is_b = false
+	}
+
+	lo := math.Min(reference[0].Dot(tangent), reference[1].Dot(tangent))
+	hi := math.Max(reference[0].Dot(tangent), reference[1].Dot(tangent))
+	for _, p := range clipSegment(incident[0], incident[1], tangent, lo, hi) {
+		if incident_is_b {
+			surface := p.Minus(normal.Multiply(b.radius))
+			point_depth := math.Min(amax - surface.Dot(normal), depth)
+			if point_depth > 0 {
+				result.addContact(surface.Plus(normal.Multiply(point_depth / 2)), point_depth)
+			}
+		} else {
+			surface := p.Plus(normal.Multiply(a.radius))
+			point_depth := math.Min(surface.Dot(normal) - bmin, depth)
+			if point_depth > 0 {
+				result.addContact(surface.Minus(normal.Multiply(point_depth / 2)), point_depth)
+			}
+		}
+	}
+
+	if result.ContactCount == 0 {
+		// Clipping can throw everything away on really shallow or glancing hits, settle for a single point between the supports
+		support_a := a.feature(normal)[0].Plus(normal.Multiply(a.radius))
+		support_b := b.feature(normal.Negative())[0].Minus(normal.Multiply(b.radius))
+		result.addContact(support_a.Plus(support_b).Multiply(0.5), depth)
+	}
+	result.Depth = depth
+	return result
+}
+
+// True for an edge lying close to flat against the plane the normal points out of
+func facesNormal(feature []utils.FloatPair, normal utils.FloatPair) bool {
+	if len(feature) != 2 {
+		return false
+	}
+	return math.Abs(feature[1].Minus(feature[0]).Normalized().Dot(normal)) < flatEdgeTolerance
+}
+
+// Cuts the segment down to the part whose projection onto axis lies between lo and hi
+func clipSegment(start, end, axis utils.FloatPair, lo, hi float64) []utils.FloatPair {
+	d_start := start.Dot(axis)
+	d_end := end.Dot(axis)
+	if d_start == d_end {
+		// Nothing to clip against, the segment runs straight along the normal
+		return []utils.FloatPair{start, end}
+	}
+
+	t_lo := (lo - d_start) / (d_end - d_start)
+	t_hi := (hi - d_start) / (d_end - d_start)
+	if t_lo > t_hi {
+		t_lo, t_hi = t_hi, t_lo
+	}
+	t_lo = math.Max(t_lo, 0)
+	t_hi = math.Min(t_hi, 1)
+	if t_lo > t_hi {
+		return []utils.FloatPair{}
+	}
+	dir := end.Minus(start)
+	return []utils.FloatPair{start.Plus(dir.Multiply(t_lo)), start.Plus(dir.Multiply(t_hi))}
+}
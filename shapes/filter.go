@@ -0,0 +1,19 @@
+package shapes
+
+// Which collision layers something is on, and which layers it wants to collide with
+// Two things only collide if each one's mask has a bit from the other one's category
+type Filter struct {
+	Category uint32
+	Mask uint32
+}
+
+// On the first layer and colliding with everything
+var DefaultFilter = Filter{Category: 1, Mask: 0xFFFFFFFF}
+
+func NewFilter(category uint32, mask uint32) Filter {
+	return Filter{Category: category, Mask: mask}
+}
+
+func (filter Filter) ShouldCollide(other Filter) bool {
+	return (filter.Mask & other.Category) != 0 && (other.Mask & filter.Category) != 0
+}
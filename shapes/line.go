@@ -1,5 +1,10 @@
 package shapes
 
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
 func CrossProduct2D(x1 int, y1 int, x2 int, y2 int) float64 {
 	return float64((x1*y2) - (y1*x2))
 }
@@ -45,39 +50,38 @@ func NewLine(x int, y int, x2 int, y2 int) Line {
 	return ray
 }
 
-func (ray Line) GetLineIntersectionTimeRaw(x int, y int, dirx int, diry int) float64 {
-	// 2.0 is the value we use for a miss, I forget why
+// How far along this line it crosses the other one, false if they don't cross at all
+func (ray Line) LineIntersectionTime(x int, y int, dirx int, diry int) (float64, bool) {
 	denom := CrossProduct2D(ray.dirx, ray.diry, dirx, diry)
 	if denom == 0.0 {
-		return 2.0
+		return 0.0, false
 	}
 	to_other_x := x - ray.x
 	to_other_y := y - ray.y
 	t := CrossProduct2D(to_other_x, to_other_y, dirx, diry) / denom
 	u := CrossProduct2D(to_other_x, to_other_y, ray.dirx, ray.diry) / denom
 	if u > 1.0 || u < 0.0 || t > 1.0 || t < 0.0 {
-		return 2.0
+		return 0.0, false
 	}
-	return t
+	return t, true
 }
 
-func (ray Line) GetAxisRectIntersectionTime(other AxisRect) float64 {
+// How far along the line it first touches the rect, false if it misses
+func (ray Line) AxisRectIntersectionTime(other AxisRect) (float64, bool) {
 	// We treat rects as filled in, so if our starting point is inside it we treat that as the hit
 	if other.ContainsPoint(float64(ray.x), float64(ray.y)) {
-		return 0.0
+		return 0.0, true
 	}
 
-	t := 2.0
+	t := math.Inf(1)
 	
 	if ray.dirx != 0.0 {
 		if ray.x < int(other.x) {
-			u := ray.GetLineIntersectionTimeRaw(int(other.x), int(other.y), 0.0, int(other.h))
-			if u >= 0.0 && u < t {
+			if u, hit := ray.LineIntersectionTime(int(other.x), int(other.y), 0.0, int(other.h)); hit && u < t {
 				t = u
 			}
 		} else if ray.x > int(other.x2) {
-			u := ray.GetLineIntersectionTimeRaw(int(other.x2), int(other.y), 0.0, int(other.h))
-			if u >= 0.0 && u < t {
+			if u, hit := ray.LineIntersectionTime(int(other.x2), int(other.y), 0.0, int(other.h)); hit && u < t {
 				t = u
 			}
 		}
@@ -85,24 +89,76 @@ func (ray Line) GetAxisRectIntersectionTime(other AxisRect) float64 {
 	
 	if ray.diry != 0.0 {
 		if ray.y < int(other.y) {
-			u := ray.GetLineIntersectionTimeRaw(int(other.x), int(other.y), int(other.w), 0.0)
-			if u >= 0.0 && u < t {
+			if u, hit := ray.LineIntersectionTime(int(other.x), int(other.y), int(other.w), 0.0); hit && u < t {
 				t = u
 			}
 		} else if ray.y > int(other.y2) {
-			u := ray.GetLineIntersectionTimeRaw(int(other.x), int(other.y2), int(other.w), 0.0)
-			if u >= 0.0 && u < t {
+			if u, hit := ray.LineIntersectionTime(int(other.x), int(other.y2), int(other.w), 0.0); hit && u < t {
 				t = u
 			}
 		}
 	}
 
-	if t > 1.0 {
-		return 2.0
+	if math.IsInf(t, 1) {
+		return 0.0, false
 	}
-	return t
+	return t, true
 }
 
 func (ray Line) IntersectsAxisRect(other AxisRect) bool {
-	return ray.GetAxisRectIntersectionTime(other) < 2.0
-}
\ No newline at end of file
+	_, hit := ray.AxisRectIntersectionTime(other)
+	return hit
+}
+
+// Deprecated: use LineIntersectionTime, this gives back 2.0 for a miss
+func (ray Line) GetLineIntersectionTimeRaw(x int, y int, dirx int, diry int) float64 {
+	if t, hit := ray.LineIntersectionTime(x, y, dirx, diry); hit {
+		return t
+	}
+	return 2.0
+}
+
+// Deprecated: use AxisRectIntersectionTime, this gives back 2.0 for a miss
+func (ray Line) GetAxisRectIntersectionTime(other AxisRect) float64 {
+	if t, hit := ray.AxisRectIntersectionTime(other); hit {
+		return t
+	}
+	return 2.0
+}
+
+// SHAPE INTERFACE METHODS
+func (ray Line) Center() utils.FloatPair {
+	return utils.FloatPair{
+		X: float64(ray.x) + (float64(ray.dirx) / 2),
+		Y: float64(ray.y) + (float64(ray.diry) / 2),
+	}
+}
+// Gives back a Segment so the move isn't rounded onto the integer grid
+func (ray Line) Translated(x, y float64) Shape {
+	return NewSegment(float64(ray.x) + x, float64(ray.y) + y, float64(ray.x + ray.dirx) + x, float64(ray.y + ray.diry) + y)
+}
+// Gives back a Segment, the rotated end points generally don't land on the integer grid
+func (ray Line) Rotated(r float64) Shape {
+	center := ray.Center()
+	half := utils.FloatPair{X: float64(ray.dirx) / 2, Y: float64(ray.diry) / 2}.Rotated(r)
+	start := center.Minus(half)
+	end := center.Plus(half)
+	return NewSegment(start.X, start.Y, end.X, end.Y)
+}
+func (ray Line) ContainsPoint(x float64, y float64) bool {
+	to_point_x := x - float64(ray.x)
+	to_point_y := y - float64(ray.y)
+	if (to_point_x * float64(ray.diry)) - (to_point_y * float64(ray.dirx)) != 0.0 {
+		return false
+	}
+	return ray.bounding_box.ContainsPoint(x, y)
+}
+func (ray Line) TestCollision(o Shape) Manifold {
+	return Collide(ray, o)
+}
+func (ray Line) Intersects(o Shape) bool {
+	return Intersects(ray, o)
+}
+func (ray Line) Encloses(o Shape) bool {
+	return Encloses(ray, o)
+}
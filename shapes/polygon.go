@@ -0,0 +1,351 @@
+package shapes
+
+import (
+	"errors"
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+var (
+	ErrTooFewPoints = errors.New("polygon needs at least 3 points that aren't all in a line")
+	ErrNotConvex = errors.New("polygon is not convex")
+	ErrNotSimple = errors.New("polygon crosses over itself")
+)
+
+const polygonEpsilon = 1e-9
+
+// A convex polygon
+// Points are always stored with a positive signed area, which is clockwise on screen since y points down
+type Polygon struct {
+	points []utils.FloatPair
+}
+
+// Fails if the points don't describe a convex polygon, use DecomposePolygon for anything that might be concave
+func NewPolygon(points []utils.FloatPair) (Polygon, error) {
+	cleaned := cleanPolygonPoints(points)
+	if len(cleaned) < 3 {
+		return Polygon{}, ErrTooFewPoints
+	}
+	if signedArea(cleaned) < 0 {
+		reversePoints(cleaned)
+	}
+	if !isConvex(cleaned) {
+		return Polygon{}, ErrNotConvex
+	}
+	return Polygon{points: cleaned}, nil
+}
+
+// Splits any simple polygon into convex pieces, a polygon that is already convex comes back as a single piece
+// Ear clips the polygon into triangles and then merges neighbouring pieces back together as long as they stay convex
+func DecomposePolygon(points []utils.FloatPair) ([]Polygon, error) {
+	cleaned := cleanPolygonPoints(points)
+	if len(cleaned) < 3 {
+		return nil, ErrTooFewPoints
+	}
+	if signedArea(cleaned) < 0 {
+		reversePoints(cleaned)
+	}
+	if !isSimple(cleaned) {
+		return nil, ErrNotSimple
+	}
+	if isConvex(cleaned) {
+		return []Polygon{{points: cleaned}}, nil
+	}
+
+	pieces, err := triangulate(cleaned)
+	if err != nil {
+		return nil, err
+	}
+	pieces = mergeConvexPieces(pieces)
+
+	result := make([]Polygon, 0, len(pieces))
+	for _, piece := range pieces {
+		poly, err := NewPolygon(piece)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, poly)
+	}
+	return result, nil
+}
+
+// Positive for clockwise points on screen (y down), negative for counter clockwise
+func signedArea(points []utils.FloatPair) float64 {
+	area := 0.0
+	for i, p := range points {
+		area += p.Cross(points[(i + 1) % len(points)])
+	}
+	return area / 2
+}
+
+func reversePoints(points []utils.FloatPair) {
+	for i, j := 0, len(points) - 1; i < j; i, j = i + 1, j - 1 {
+		points[i], points[j] = points[j], points[i]
+	}
+}
+
+// Copies the points while dropping repeats and points sitting in a straight line between their neighbours
+func cleanPolygonPoints(points []utils.FloatPair) []utils.FloatPair {
+	result := make([]utils.FloatPair, 0, len(points))
+	for _, p := range points {
+		if len(result) > 0 && result[len(result) - 1] == p {
+			continue
+		}
+		result = append(result, p)
+	}
+	for len(result) > 1 && result[0] == result[len(result) - 1] {
+		result = result[:len(result) - 1]
+	}
+
+	for removed := true; removed && len(result) >= 3; {
+		removed = false
+		for i := 0; i < len(result); i++ {
+			prev := result[(i + len(result) - 1) % len(result)]
+			next := result[(i + 1) % len(result)]
+			if math.Abs(result[i].Minus(prev).Cross(next.Minus(result[i]))) <= polygonEpsilon {
+				result = append(result[:i], result[i+1:]...)
+				removed = true
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Expects points with a positive signed area
+// Every corner has to turn the same way, and the turns have to add up to one full turn, otherwise it's a star that winds round more than once
+func isConvex(points []utils.FloatPair) bool {
+	turning := 0.0
+	for i, p := range points {
+		next := points[(i + 1) % len(points)]
+		after := points[(i + 2) % len(points)]
+		edge, next_edge := next.Minus(p), after.Minus(next)
+		if edge.Cross(next_edge) < -polygonEpsilon {
+			return false
+		}
+		turning += math.Atan2(edge.Cross(next_edge), edge.Dot(next_edge))
+	}
+	return math.Abs(turning - (2 * math.Pi)) < 1e-6
+}
+
+func segmentsCross(a1, a2, b1, b2 utils.FloatPair) bool {
+	d1 := a2.Minus(a1).Cross(b1.Minus(a1))
+	d2 := a2.Minus(a1).Cross(b2.Minus(a1))
+	d3 := b2.Minus(b1).Cross(a1.Minus(b1))
+	d4 := b2.Minus(b1).Cross(a2.Minus(b1))
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// No two edges that aren't neighbours cross each other
+func isSimple(points []utils.FloatPair) bool {
+	n := len(points)
+	for i := 0; i < n; i++ {
+		for j := i + 2; j < n; j++ {
+			if i == 0 && j == n - 1 {
+				continue // Neighbours through the wrap around
+			}
+			if segmentsCross(points[i], points[(i + 1) % n], points[j], points[(j + 1) % n]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func pointInTriangle(p, a, b, c utils.FloatPair) bool {
+	d1 := b.Minus(a).Cross(p.Minus(a))
+	d2 := c.Minus(b).Cross(p.Minus(b))
+	d3 := a.Minus(c).Cross(p.Minus(c))
+	return d1 >= 0 && d2 >= 0 && d3 >= 0
+}
+
+// Ear clipping, expects points with a positive signed area
+func triangulate(points []utils.FloatPair) ([][]utils.FloatPair, error) {
+	remaining := make([]utils.FloatPair, len(points))
+	copy(remaining, points)
+	result := make([][]utils.FloatPair, 0, len(points) - 2)
+
+	for len(remaining) > 3 {
+		clipped := false
+		for i := range remaining {
+			prev := remaining[(i + len(remaining) - 1) % len(remaining)]
+			cur := remaining[i]
+			next := remaining[(i + 1) % len(remaining)]
+			if cur.Minus(prev).Cross(next.Minus(cur)) <= polygonEpsilon {
+				continue // Reflex corner, can't be an ear
+			}
+
+			ear := true
+			for _, p := range remaining {
+				if p == prev || p == cur || p == next {
+					continue
+				}
+				if pointInTriangle(p, prev, cur, next) {
+					ear = false
+					break
+				}
+			}
+			if ear {
+				result = append(result, []utils.FloatPair{prev, cur, next})
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				clipped = true
+				break
+			}
+		}
+		if !clipped {
+			return nil, ErrNotSimple
+		}
+	}
+	return append(result, remaining), nil
+}
+
+// Keeps joining pieces that share an edge for as long as the joined piece is still convex
+func mergeConvexPieces(pieces [][]utils.FloatPair) [][]utils.FloatPair {
+	for merged := true; merged; {
+		merged = false
+		for a := 0; a < len(pieces) && !merged; a++ {
+			for b := a + 1; b < len(pieces) && !merged; b++ {
+				joined, ok := joinOnSharedEdge(pieces[a], pieces[b])
+				if ok && isConvex(joined) {
+					pieces[a] = joined
+					pieces = append(pieces[:b], pieces[b+1:]...)
+					merged = true
+				}
+			}
+		}
+	}
+	return pieces
+}
+
+func joinOnSharedEdge(a, b []utils.FloatPair) ([]utils.FloatPair, bool) {
+	for i := range a {
+		u := a[i]
+		v := a[(i + 1) % len(a)]
+		for j := range b {
+			// With matching winding a shared edge runs the opposite way in the other piece
+			if b[j] != v || b[(j + 1) % len(b)] != u {
+				continue
+			}
+			result := make([]utils.FloatPair, 0, len(a) + len(b) - 2)
+			for k := 0; k < len(a); k++ {
+				result = append(result, a[(i + 1 + k) % len(a)])
+			}
+			for k := 2; k < len(b); k++ {
+				result = append(result, b[(j + k) % len(b)])
+			}
+			return result, true
+		}
+	}
+	return nil, false
+}
+
+func (poly Polygon) Points() []utils.FloatPair {
+	result := make([]utils.FloatPair, len(poly.points))
+	copy(result, poly.points)
+	return result
+}
+
+func (poly Polygon) Area() float64 {
+	return signedArea(poly.points)
+}
+
+func (poly Polygon) Centroid() utils.FloatPair {
+	result := utils.FloatPair{}
+	area := 0.0
+	for i, p := range poly.points {
+		next := poly.points[(i + 1) % len(poly.points)]
+		cross := p.Cross(next)
+		area += cross
+		result = result.Plus(p.Plus(next).Multiply(cross))
+	}
+	if area == 0 {
+		return result
+	}
+	return result.Multiply(1 / (3 * area))
+}
+
+// Moment of inertia around the centroid for a polygon of uniform density with the given mass
+func (poly Polygon) MomentOfInertia(mass float64) float64 {
+	centroid := poly.Centroid()
+	numerator := 0.0
+	denominator := 0.0
+	for i := range poly.points {
+		p := poly.points[i].Minus(centroid)
+		next := poly.points[(i + 1) % len(poly.points)].Minus(centroid)
+		cross := math.Abs(p.Cross(next))
+		numerator += cross * (p.Dot(p) + p.Dot(next) + next.Dot(next))
+		denominator += cross
+	}
+	if denominator == 0 {
+		return 0
+	}
+	return (mass / 6) * (numerator / denominator)
+}
+
+// The point of the polygon furthest along dir, the origin for a zero value Polygon with no points
+func (poly Polygon) Support(dir utils.FloatPair) utils.FloatPair {
+	if len(poly.points) == 0 {
+		return utils.FloatPair{}
+	}
+	best := poly.points[0]
+	best_dot := best.Dot(dir)
+	for _, p := range poly.points[1:] {
+		d := p.Dot(dir)
+		if d > best_dot {
+			best_dot = d
+			best = p
+		}
+	}
+	return best
+}
+
+// SHAPE INTERFACE METHODS
+func (poly Polygon) BoundingBox() AxisRect {
+	minx, miny := math.Inf(1), math.Inf(1)
+	maxx, maxy := math.Inf(-1), math.Inf(-1)
+	for _, p := range poly.points {
+		minx = math.Min(minx, p.X)
+		miny = math.Min(miny, p.Y)
+		maxx = math.Max(maxx, p.X)
+		maxy = math.Max(maxy, p.Y)
+	}
+	return boundingBoxFromFloats(minx, miny, maxx, maxy)
+}
+func (poly Polygon) Center() utils.FloatPair {
+	return poly.Centroid()
+}
+func (poly Polygon) Translated(x, y float64) Shape {
+	offset := utils.FloatPair{X: x, Y: y}
+	result := Polygon{points: make([]utils.FloatPair, len(poly.points))}
+	for i, p := range poly.points {
+		result.points[i] = p.Plus(offset)
+	}
+	return result
+}
+func (poly Polygon) Rotated(r float64) Shape {
+	center := poly.Centroid()
+	result := Polygon{points: make([]utils.FloatPair, len(poly.points))}
+	for i, p := range poly.points {
+		result.points[i] = p.Minus(center).Rotated(r).Plus(center)
+	}
+	return result
+}
+func (poly Polygon) ContainsPoint(x float64, y float64) bool {
+	point := utils.FloatPair{X: x, Y: y}
+	for i, p := range poly.points {
+		next := poly.points[(i + 1) % len(poly.points)]
+		if next.Minus(p).Cross(point.Minus(p)) < 0 {
+			return false
+		}
+	}
+	return len(poly.points) > 0
+}
+func (poly Polygon) TestCollision(o Shape) Manifold {
+	return Collide(poly, o)
+}
+func (poly Polygon) Intersects(o Shape) bool {
+	return Intersects(poly, o)
+}
+func (poly Polygon) Encloses(o Shape) bool {
+	return Encloses(poly, o)
+}
@@ -0,0 +1,108 @@
+package shapes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Yarnsh/hippo/utils"
+)
+
+func points(coords ...float64) []utils.FloatPair {
+	result := make([]utils.FloatPair, 0, len(coords) / 2)
+	for i := 0; i + 1 < len(coords); i += 2 {
+		result = append(result, utils.FloatPair{X: coords[i], Y: coords[i + 1]})
+	}
+	return result
+}
+
+func TestIsSimple(t *testing.T) {
+	cases := []struct {
+		name string
+		points []utils.FloatPair
+		simple bool
+	}{
+		{"square", points(0, 0, 10, 0, 10, 10, 0, 10), true},
+		{"l shape", points(0, 0, 20, 0, 20, 10, 10, 10, 10, 20, 0, 20), true},
+		{"bow tie", points(0, 0, 10, 10, 10, 0, 0, 10), false},
+		{"pentagram", points(0, -10, 5.9, 8.1, -9.5, -3.1, 9.5, -3.1, -5.9, 8.1), false},
+	}
+	for _, c := range cases {
+		if isSimple(c.points) != c.simple {
+			t.Errorf("%s: expected simple %v", c.name, c.simple)
+		}
+	}
+}
+
+func TestNewPolygon(t *testing.T) {
+	if _, err := NewPolygon(points(0, 0, 10, 0, 10, 10, 0, 10)); err != nil {
+		t.Errorf("square: %v", err)
+	}
+	// Counter clockwise and with a point in the middle of an edge, both get cleaned up
+	poly, err := NewPolygon(points(0, 0, 0, 10, 10, 10, 10, 5, 10, 0))
+	if err != nil {
+		t.Fatalf("counter clockwise square: %v", err)
+	}
+	if len(poly.Points()) != 4 || poly.Area() <= 0 {
+		t.Errorf("counter clockwise square: got %v with area %v", poly.Points(), poly.Area())
+	}
+	if _, err := NewPolygon(points(0, 0, 20, 0, 20, 10, 10, 10, 10, 20, 0, 20)); err != ErrNotConvex {
+		t.Errorf("l shape: expected ErrNotConvex, got %v", err)
+	}
+	// Every corner turns the same way, but it goes round twice
+	if _, err := NewPolygon(points(0, -10, 5.9, 8.1, -9.5, -3.1, 9.5, -3.1, -5.9, 8.1)); err != ErrNotConvex {
+		t.Errorf("pentagram: expected ErrNotConvex, got %v", err)
+	}
+	if _, err := NewPolygon(points(0, 0, 5, 5, 10, 10)); err != ErrTooFewPoints {
+		t.Errorf("points in a line: expected ErrTooFewPoints, got %v", err)
+	}
+}
+
+func TestDecomposePolygon(t *testing.T) {
+	cases := []struct {
+		name string
+		points []utils.FloatPair
+		pieces int // 0 to only check the pieces cover the polygon
+	}{
+		{"square", points(0, 0, 10, 0, 10, 10, 0, 10), 1},
+		{"l shape", points(0, 0, 20, 0, 20, 10, 10, 10, 10, 20, 0, 20), 2},
+		{"l shape counter clockwise", points(0, 20, 10, 20, 10, 10, 20, 10, 20, 0, 0, 0), 2},
+		{"u shape", points(0, 0, 30, 0, 30, 30, 20, 30, 20, 10, 10, 10, 10, 30, 0, 30), 0},
+		{"comb", points(0, 0, 50, 0, 50, 30, 40, 10, 30, 30, 20, 10, 10, 30, 0, 10), 0},
+	}
+	for _, c := range cases {
+		pieces, err := DecomposePolygon(c.points)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if c.pieces > 0 && len(pieces) != c.pieces {
+			t.Errorf("%s: expected %d pieces, got %d", c.name, c.pieces, len(pieces))
+		}
+		area := 0.0
+		for _, piece := range pieces {
+			if !isConvex(piece.points) {
+				t.Errorf("%s: piece %v isn't convex", c.name, piece.points)
+			}
+			area += piece.Area()
+		}
+		if want := math.Abs(signedArea(c.points)); math.Abs(area - want) > 1e-6 {
+			t.Errorf("%s: pieces cover %v but the polygon is %v", c.name, area, want)
+		}
+	}
+
+	if _, err := DecomposePolygon(points(0, 0, 10, 10, 10, 0, 0, 10)); err != ErrNotSimple {
+		t.Errorf("bow tie: expected ErrNotSimple, got %v", err)
+	}
+	if _, err := DecomposePolygon(points(0, -10, 5.9, 8.1, -9.5, -3.1, 9.5, -3.1, -5.9, 8.1)); err != ErrNotSimple {
+		t.Errorf("pentagram: expected ErrNotSimple, got %v", err)
+	}
+	if _, err := DecomposePolygon(points(0, 0, 10, 0)); err != ErrTooFewPoints {
+		t.Errorf("two points: expected ErrTooFewPoints, got %v", err)
+	}
+}
+
+func TestSupportOnEmptyPolygon(t *testing.T) {
+	if p := (Polygon{}).Support(utils.FloatPair{X: 1}); p != (utils.FloatPair{}) {
+		t.Errorf("expected the origin, got %v", p)
+	}
+}
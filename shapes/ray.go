@@ -0,0 +1,129 @@
+package shapes
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Rays never end, but AxisRects need an end, so anything that needs a box or an end point stops the ray this far out
+const rayReach = 1 << 24
+
+// Starts at a point and carries on forever in one direction, good for aiming and line of sight
+// Distances along a ray are in pixels from the origin
+type Ray struct {
+	origin utils.FloatPair
+	dir utils.FloatPair // Normalized
+}
+
+// Getters
+func (ray Ray) Origin() utils.FloatPair {
+	return ray.origin
+}
+// Normalized
+func (ray Ray) Direction() utils.FloatPair {
+	return ray.dir
+}
+// End getters
+
+// The direction doesn't need to be normalized, but it can't be zero
+func NewRay(x, y, dirx, diry float64) Ray {
+	return Ray{
+		origin: utils.FloatPair{X: x, Y: y},
+		dir: utils.FloatPair{X: dirx, Y: diry}.Normalized(),
+	}
+}
+
+func (ray *Ray) SetPosition(x float64, y float64) {
+	ray.origin = utils.FloatPair{X: x, Y: y}
+}
+
+func (ray *Ray) SetDirection(dirx float64, diry float64) {
+	ray.dir = utils.FloatPair{X: dirx, Y: diry}.Normalized()
+}
+
+// Point distance pixels along the ray
+func (ray Ray) PointAt(distance float64) utils.FloatPair {
+	return ray.origin.Plus(ray.dir.Multiply(distance))
+}
+
+// The part of the ray from the origin to distance pixels along it
+func (ray Ray) Segment(distance float64) Segment {
+	end := ray.PointAt(distance)
+	return NewSegment(ray.origin.X, ray.origin.Y, end.X, end.Y)
+}
+
+func (ray Ray) ClosestPoint(x float64, y float64) utils.FloatPair {
+	distance := math.Max(utils.FloatPair{X: x, Y: y}.Minus(ray.origin).Dot(ray.dir), 0)
+	return ray.PointAt(distance)
+}
+
+func (ray Ray) DistanceTo(x float64, y float64) float64 {
+	return ray.ClosestPoint(x, y).DistanceTo(utils.FloatPair{X: x, Y: y})
+}
+
+// Where the ray crosses the segment, as the distance along the ray and u from 0 to 1 along the segment
+func (ray Ray) IntersectSegment(other Segment) (float64, float64, bool) {
+	t, u, ok := lineIntersection(ray.origin, ray.dir, other.start, other.Direction())
+	if !ok || t < 0 || u < 0 || u > 1 {
+		return 0, 0, false
+	}
+	return t, u, true
+}
+
+// Distances along the ray where it goes into and comes out of the rect, the entry is 0 if the ray starts inside
+func (ray Ray) GetAxisRectIntersections(other AxisRect) (float64, float64, bool) {
+	return clipToAxisRect(ray.origin, ray.dir, other, math.Inf(1))
+}
+
+// Where the ray first goes into the shape, with the RayHit's Fraction being the distance along the ray instead of 0 to 1
+func (ray Ray) Intersect(shape Shape) RayHit {
+	// Only need to go as far as the far side of the shape, which keeps the numbers sensible
+	box := shape.BoundingBox()
+	reach := 1.0
+	for _, corner := range []utils.FloatPair{{X: float64(box.x), Y: float64(box.y)}, {X: float64(box.x2), Y: float64(box.y2)}, {X: float64(box.x), Y: float64(box.y2)}, {X: float64(box.x2), Y: float64(box.y)}} {
+		reach = math.Max(reach, ray.origin.DistanceTo(corner) + 1)
+	}
+	hit := RayCast(shape, ray.origin, ray.PointAt(reach))
+	hit.Fraction *= reach
+	return hit
+}
+func (ray Ray) IntersectCircle(other Circle) RayHit {
+	return ray.Intersect(other)
+}
+func (ray Ray) IntersectAxisRect(other AxisRect) RayHit {
+	return ray.Intersect(other)
+}
+func (ray Ray) IntersectRect(other Rect) RayHit {
+	return ray.Intersect(other)
+}
+
+// SHAPE INTERFACE METHODS
+// Stretches rayReach pixels out from the origin
+func (ray Ray) BoundingBox() AxisRect {
+	return ray.Segment(rayReach).BoundingBox()
+}
+// Rays have no middle, so this is the origin
+func (ray Ray) Center() utils.FloatPair {
+	return ray.origin
+}
+func (ray Ray) Translated(x, y float64) Shape {
+	ray.origin = ray.origin.Plus(utils.FloatPair{X: x, Y: y})
+	return ray
+}
+// Turns the ray around its origin
+func (ray Ray) Rotated(r float64) Shape {
+	ray.dir = ray.dir.Rotated(r)
+	return ray
+}
+func (ray Ray) ContainsPoint(x float64, y float64) bool {
+	return ray.DistanceTo(x, y) <= onLineTolerance
+}
+func (ray Ray) TestCollision(o Shape) Manifold {
+	return Collide(ray, o)
+}
+func (ray Ray) Intersects(o Shape) bool {
+	return Intersects(ray, o)
+}
+func (ray Ray) Encloses(o Shape) bool {
+	return Encloses(ray, o)
+}
@@ -0,0 +1,63 @@
+package shapes
+
+import (
+	"sort"
+)
+
+// One stretch of a ray passing through something, like a leaf of the terrain
+// Entry and Exit are distances for a Ray, or fractions from 0 to 1 for a Segment
+type RayResult struct {
+	Entry float64
+	Exit float64
+	Value int // What was passed through, like a terrain material
+}
+
+// Keeps ray results sorted by how far along the ray they start
+type RayResultList struct {
+	results []RayResult
+}
+
+// Getters
+func (list RayResultList) Len() int {
+	return len(list.results)
+}
+func (list RayResultList) Get(index int) RayResult {
+	return list.results[index]
+}
+func (list RayResultList) Results() []RayResult {
+	return append([]RayResult{}, list.results...)
+}
+// End getters
+
+func (list *RayResultList) Add(result RayResult) {
+	index := sort.Search(len(list.results), func(i int) bool {
+		return list.results[i].Entry > result.Entry
+	})
+	list.results = append(list.results, RayResult{})
+	copy(list.results[index+1:], list.results[index:])
+	list.results[index] = result
+}
+
+func (list *RayResultList) Clear() {
+	list.results = list.results[:0]
+}
+
+// Joins up results with the same value that pick up right where the last one left off
+// Big areas of one material get split up into lots of leaves, this turns them back into one stretch
+func (list *RayResultList) MergeTouching() {
+	if len(list.results) == 0 {
+		return
+	}
+	merged := list.results[:1]
+	for _, result := range list.results[1:] {
+		last := &merged[len(merged) - 1]
+		if result.Value == last.Value && result.Entry <= last.Exit + onLineTolerance {
+			if result.Exit > last.Exit {
+				last.Exit = result.Exit
+			}
+			continue
+		}
+		merged = append(merged, result)
+	}
+	list.results = merged
+}
@@ -0,0 +1,101 @@
+package shapes
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// Result of casting a ray against a shape
+type RayHit struct {
+	Hit bool
+	Fraction float64 // How far from the start to the end of the ray the hit is, from 0 to 1
+	Point utils.FloatPair
+	Normal utils.FloatPair // Surface normal where the ray went in
+}
+
+// Finds where the ray from start to end first goes into the shape
+// Shapes count as filled in, so a ray starting inside one hits straight away with the normal pointing back along the ray
+func RayCast(shape Shape, start utils.FloatPair, end utils.FloatPair) RayHit {
+	shape = shapeValue(shape)
+	dir := end.Minus(start)
+	if shape.ContainsPoint(start.X, start.Y) {
+		return RayHit{Hit: true, Fraction: 0, Point: start, Normal: dir.Negative().Normalized()}
+	}
+	if dir.X == 0 && dir.Y == 0 {
+		return RayHit{}
+	}
+
+	if circ, ok := shape.(Circle); ok {
+		return rayCastCircle(circ.pos, circ.radius, start, dir)
+	}
+
+	c, ok := convexOf(shape)
+	if !ok || len(c.points) == 0 {
+		return RayHit{}
+	}
+	if c.radius == 0 && len(c.points) >= 3 {
+		return rayCastPolygon(c, start, dir)
+	}
+
+	// Rounded shapes and segments get a point swept into them instead, which is close enough without a special case for each
+	hit := sweepConvex(convex{points: []utils.FloatPair{start}}, dir, c)
+	if !hit.Hit {
+		return RayHit{}
+	}
+	return RayHit{Hit: true, Fraction: hit.Time, Point: start.Plus(dir.Multiply(hit.Time)), Normal: hit.Normal}
+}
+
+func rayCastCircle(center utils.FloatPair, radius float64, start utils.FloatPair, dir utils.FloatPair) RayHit {
+	// Solve |start + dir * t - center| = radius for the smaller t
+	to_start := start.Minus(center)
+	a := dir.Dot(dir)
+	b := 2 * to_start.Dot(dir)
+	c := to_start.Dot(to_start) - (radius * radius)
+	discriminant := (b * b) - (4 * a * c)
+	if discriminant < 0 {
+		return RayHit{}
+	}
+	t := (-b - math.Sqrt(discriminant)) / (2 * a)
+	if t < 0 || t > 1 {
+		return RayHit{}
+	}
+	point := start.Plus(dir.Multiply(t))
+	return RayHit{Hit: true, Fraction: t, Point: point, Normal: point.Minus(center).Normalized()}
+}
+
+// Clips the ray against each edge of a convex polygon, the last edge it enters through is the one it hits
+func rayCastPolygon(c convex, start utils.FloatPair, dir utils.FloatPair) RayHit {
+	center := c.center()
+	enter := 0.0
+	exit := 1.0
+	normal := utils.FloatPair{}
+	for i, p := range c.points {
+		edge_normal := c.outwardNormal(i, center)
+
+		distance := edge_normal.Dot(p.Minus(start))
+		speed := edge_normal.Dot(dir)
+		if speed == 0 {
+			if distance < 0 {
+				return RayHit{} // Running alongside the edge on the outside
+			}
+			continue
+		}
+		t := distance / speed
+		if speed < 0 {
+			if t > enter {
+				enter = t
+				normal = edge_normal
+			}
+		} else if t < exit {
+			exit = t
+		}
+		if enter > exit {
+			return RayHit{}
+		}
+	}
+
+	if normal.X == 0 && normal.Y == 0 {
+		return RayHit{}
+	}
+	return RayHit{Hit: true, Fraction: enter, Point: start.Plus(dir.Multiply(enter)), Normal: normal}
+}
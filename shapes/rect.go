@@ -1,5 +1,12 @@
 package shapes
 
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// A rectangle rotated by r radians around its center
+// x, y, w and h describe the rectangle before rotation, the same way they do for an AxisRect
 type Rect struct {
 	x float64
 	y float64
@@ -11,4 +18,217 @@ type Rect struct {
 	y2 float64
 }
 
-// TODO: all this, we testing physics with just circle to start
+// Getters
+func (rect Rect) X() float64 {
+	return rect.x
+}
+func (rect Rect) Y() float64 {
+	return rect.y
+}
+func (rect Rect) W() float64 {
+	return rect.w
+}
+func (rect Rect) H() float64 {
+	return rect.h
+}
+func (rect Rect) R() float64 {
+	return rect.r
+}
+func (rect Rect) X2() float64 {
+	return rect.x2
+}
+func (rect Rect) Y2() float64 {
+	return rect.y2
+}
+// End getters
+
+func NewRect(x, y, w, h, r float64) Rect {
+	rect := Rect{}
+	rect.x = x
+	rect.y = y
+	rect.w = w
+	rect.h = h
+	rect.r = r
+
+	// Flip the rectangle around in the case of negative size
+	if (w < 0) {
+		rect.x += w
+		rect.w = -w
+	}
+	if (h < 0) {
+		rect.y += h
+		rect.h = -h
+	}
+
+	rect.x2 = rect.x + rect.w
+	rect.y2 = rect.y + rect.h
+
+	return rect
+}
+
+func NewRectCentered(x, y, w, h, r float64) Rect {
+	return NewRect(x - (w / 2), y - (h / 2), w, h, r)
+}
+
+func NewRectFromAxisRect(other AxisRect) Rect {
+	return NewRect(float64(other.x), float64(other.y), float64(other.w), float64(other.h), 0)
+}
+
+func (rect *Rect) SetPosition(x float64, y float64) {
+	rect.x = x
+	rect.y = y
+
+	rect.x2 = rect.x + rect.w
+	rect.y2 = rect.y + rect.h
+}
+
+func (rect *Rect) SetSize(w float64, h float64) {
+	rect.w = w
+	rect.h = h
+
+	// Flip the rectangle around in the case of negative size
+	if (w < 0) {
+		rect.x += w
+		rect.w = -w
+	}
+	if (h < 0) {
+		rect.y += h
+		rect.h = -h
+	}
+
+	rect.x2 = rect.x + rect.w
+	rect.y2 = rect.y + rect.h
+}
+
+func (rect *Rect) SetRotation(r float64) {
+	rect.r = r
+}
+
+// Corners in the order top left, top right, bottom right, bottom left (before rotation)
+func (rect Rect) Corners() [4]utils.FloatPair {
+	center := rect.Center()
+	half_w := rect.w / 2
+	half_h := rect.h / 2
+	return [4]utils.FloatPair{
+		center.Plus(utils.FloatPair{X: -half_w, Y: -half_h}.Rotated(rect.r)),
+		center.Plus(utils.FloatPair{X: half_w, Y: -half_h}.Rotated(rect.r)),
+		center.Plus(utils.FloatPair{X: half_w, Y: half_h}.Rotated(rect.r)),
+		center.Plus(utils.FloatPair{X: -half_w, Y: half_h}.Rotated(rect.r)),
+	}
+}
+
+// Unit vectors along the rect's own width and height, which are also the only two axes SAT needs for it
+func (rect Rect) Axes() [2]utils.FloatPair {
+	x_axis := utils.FloatPair{X: 1}.Rotated(rect.r)
+	return [2]utils.FloatPair{x_axis, x_axis.Perpendicular()}
+}
+
+func (rect Rect) convex() convex {
+	corners := rect.Corners()
+	return convex{points: corners[:]}
+}
+
+func (rect Rect) satAxes(other Rect) []utils.FloatPair {
+	axes := rect.Axes()
+	other_axes := other.Axes()
+	return []utils.FloatPair{axes[0], axes[1], other_axes[0], other_axes[1]}
+}
+
+func (rect Rect) IntersectsRect(other Rect) bool {
+	return overlapsOnAxes(rect.convex(), other.convex(), rect.satAxes(other))
+}
+
+func (rect Rect) IntersectsAxisRect(other AxisRect) bool {
+	return rect.IntersectsRect(NewRectFromAxisRect(other))
+}
+
+func (rect Rect) IntersectsCircle(other Circle) bool {
+	return collideCircleRect(other, rect).Colliding()
+}
+
+func collideRects(a, b Rect) Manifold {
+	return collideConvexOnAxes(a.convex(), b.convex(), a.satAxes(b))
+}
+
+// Done in the rect's own unrotated space, where it is the same problem as a circle against an AxisRect
+func collideCircleRect(circ Circle, rect Rect) Manifold {
+	result := Manifold{}
+	half_w := rect.w / 2
+	half_h := rect.h / 2
+	local := circ.pos.Minus(rect.Center()).Rotated(-rect.r)
+	closest := utils.FloatPair{
+		X: utils.ClampFloat64(local.X, -half_w, half_w),
+		Y: utils.ClampFloat64(local.Y, -half_h, half_h),
+	}
+
+	to_closest := closest.Minus(local)
+	squared_dist := to_closest.Dot(to_closest)
+	if squared_dist >= circ.radius_squared {
+		return result
+	}
+
+	var normal utils.FloatPair
+	var depth float64
+	if squared_dist == 0 {
+		// The center is inside the rect, so the circle has to leave through whichever edge is nearest
+		dist_x := half_w - math.Abs(local.X)
+		dist_y := half_h - math.Abs(local.Y)
+		if dist_x < dist_y {
+			normal = utils.FloatPair{X: -math.Copysign(1, local.X)}
+			depth = dist_x + circ.radius
+		} else {
+			normal = utils.FloatPair{Y: -math.Copysign(1, local.Y)}
+			depth = dist_y + circ.radius
+		}
+	} else {
+		dist := math.Sqrt(squared_dist)
+		normal = to_closest.Multiply(1 / dist)
+		depth = circ.radius - dist
+	}
+
+	result.Normal = normal.Rotated(rect.r)
+	surface := circ.pos.Plus(result.Normal.Multiply(circ.radius))
+	result.addContact(surface.Minus(result.Normal.Multiply(depth / 2)), depth)
+	return result
+}
+
+// SHAPE INTERFACE METHODS
+func (rect Rect) BoundingBox() AxisRect {
+	corners := rect.Corners()
+	minx, miny := corners[0].X, corners[0].Y
+	maxx, maxy := minx, miny
+	for _, c := range corners[1:] {
+		minx = math.Min(minx, c.X)
+		miny = math.Min(miny, c.Y)
+		maxx = math.Max(maxx, c.X)
+		maxy = math.Max(maxy, c.Y)
+	}
+	return boundingBoxFromFloats(minx, miny, maxx, maxy)
+}
+func (rect Rect) Center() utils.FloatPair {
+	return utils.FloatPair{
+		X: rect.x + (rect.w / 2),
+		Y: rect.y + (rect.h / 2),
+	}
+}
+func (rect Rect) Translated(x, y float64) Shape {
+	return NewRect(rect.x + x, rect.y + y, rect.w, rect.h, rect.r)
+}
+func (rect Rect) Rotated(r float64) Shape {
+	return NewRect(rect.x, rect.y, rect.w, rect.h, rect.r + r)
+}
+func (rect Rect) ContainsPoint(x float64, y float64) bool {
+	// Bring the point into the unrotated space of the rect and check it there
+	center := rect.Center()
+	local := utils.FloatPair{X: x, Y: y}.Minus(center).Rotated(-rect.r).Plus(center)
+	return local.X >= rect.x && local.X <= rect.x2 && local.Y >= rect.y && local.Y <= rect.y2
+}
+func (rect Rect) TestCollision(o Shape) Manifold {
+	return Collide(rect, o)
+}
+func (rect Rect) Intersects(o Shape) bool {
+	return Intersects(rect, o)
+}
+func (rect Rect) Encloses(o Shape) bool {
+	return Encloses(rect, o)
+}
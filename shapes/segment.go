@@ -0,0 +1,161 @@
+package shapes
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// How far off a segment or ray a point can be and still count as lying on it, floats rarely land exactly
+const onLineTolerance = 1e-9
+
+// A straight line between two points, like Line but with float end points so it isn't snapped to the pixel grid
+type Segment struct {
+	start utils.FloatPair
+	end utils.FloatPair
+}
+
+// Getters
+func (seg Segment) Start() utils.FloatPair {
+	return seg.start
+}
+func (seg Segment) End() utils.FloatPair {
+	return seg.end
+}
+// From the start to the end, not normalized
+func (seg Segment) Direction() utils.FloatPair {
+	return seg.end.Minus(seg.start)
+}
+func (seg Segment) Length() float64 {
+	return seg.start.DistanceTo(seg.end)
+}
+// End getters
+
+func NewSegment(x1, y1, x2, y2 float64) Segment {
+	return Segment{
+		start: utils.FloatPair{X: x1, Y: y1},
+		end: utils.FloatPair{X: x2, Y: y2},
+	}
+}
+
+// The same line with float end points
+func (ray Line) Segment() Segment {
+	return NewSegment(float64(ray.x), float64(ray.y), float64(ray.x + ray.dirx), float64(ray.y + ray.diry))
+}
+
+func (seg *Segment) Translate(x float64, y float64) {
+	offset := utils.FloatPair{X: x, Y: y}
+	seg.start = seg.start.Plus(offset)
+	seg.end = seg.end.Plus(offset)
+}
+
+// Point at t along the segment, 0 is the start and 1 is the end
+func (seg Segment) PointAt(t float64) utils.FloatPair {
+	return seg.start.Plus(seg.Direction().Multiply(t))
+}
+
+func (seg Segment) ClosestPoint(x float64, y float64) utils.FloatPair {
+	return closestPointOnSegment(seg.start, seg.end, utils.FloatPair{X: x, Y: y})
+}
+
+func (seg Segment) DistanceTo(x float64, y float64) float64 {
+	return seg.ClosestPoint(x, y).DistanceTo(utils.FloatPair{X: x, Y: y})
+}
+
+// Where the two segments cross, as t along this one and u along the other, both from 0 to 1
+// Parallel segments never count as crossing, even if they lie on top of each other
+func (seg Segment) IntersectSegment(other Segment) (float64, float64, bool) {
+	t, u, ok := lineIntersection(seg.start, seg.Direction(), other.start, other.Direction())
+	if !ok || t < 0 || t > 1 || u < 0 || u > 1 {
+		return 0, 0, false
+	}
+	return t, u, true
+}
+
+// Fractions along the segment where it goes into and comes out of the rect, the entry is 0 if the segment starts inside
+func (seg Segment) GetAxisRectIntersections(other AxisRect) (float64, float64, bool) {
+	return clipToAxisRect(seg.start, seg.Direction(), other, 1)
+}
+
+// Where the segment first goes into the shape, with the fraction running from the start to the end
+func (seg Segment) Intersect(shape Shape) RayHit {
+	return RayCast(shape, seg.start, seg.end)
+}
+func (seg Segment) IntersectCircle(other Circle) RayHit {
+	return seg.Intersect(other)
+}
+func (seg Segment) IntersectAxisRect(other AxisRect) RayHit {
+	return seg.Intersect(other)
+}
+func (seg Segment) IntersectRect(other Rect) RayHit {
+	return seg.Intersect(other)
+}
+
+// Slab test, clipping start + dir * t for t from 0 to max down to the part inside the rect
+func clipToAxisRect(start, dir utils.FloatPair, rect AxisRect, max float64) (float64, float64, bool) {
+	entry := 0.0
+	exit := max
+	starts := [2]float64{start.X, start.Y}
+	dirs := [2]float64{dir.X, dir.Y}
+	mins := [2]float64{float64(rect.x), float64(rect.y)}
+	maxs := [2]float64{float64(rect.x2), float64(rect.y2)}
+	for i := 0; i < 2; i++ {
+		if dirs[i] == 0 {
+			if starts[i] < mins[i] || starts[i] > maxs[i] {
+				return 0, 0, false
+			}
+			continue
+		}
+		t1 := (mins[i] - starts[i]) / dirs[i]
+		t2 := (maxs[i] - starts[i]) / dirs[i]
+		entry = math.Max(entry, math.Min(t1, t2))
+		exit = math.Min(exit, math.Max(t1, t2))
+		if entry > exit {
+			return 0, 0, false
+		}
+	}
+	return entry, exit, true
+}
+
+// Where two infinite lines cross, as how many lots of each direction along from its start
+func lineIntersection(start_a, dir_a, start_b, dir_b utils.FloatPair) (float64, float64, bool) {
+	denom := dir_a.Cross(dir_b)
+	if denom == 0 {
+		return 0, 0, false
+	}
+	to_b := start_b.Minus(start_a)
+	return to_b.Cross(dir_b) / denom, to_b.Cross(dir_a) / denom, true
+}
+
+// SHAPE INTERFACE METHODS
+func (seg Segment) BoundingBox() AxisRect {
+	return boundingBoxFromFloats(
+		math.Min(seg.start.X, seg.end.X),
+		math.Min(seg.start.Y, seg.end.Y),
+		math.Max(seg.start.X, seg.end.X),
+		math.Max(seg.start.Y, seg.end.Y))
+}
+func (seg Segment) Center() utils.FloatPair {
+	return seg.start.Plus(seg.end).Multiply(0.5)
+}
+func (seg Segment) Translated(x, y float64) Shape {
+	seg.Translate(x, y)
+	return seg
+}
+func (seg Segment) Rotated(r float64) Shape {
+	center := seg.Center()
+	seg.start = seg.start.Minus(center).Rotated(r).Plus(center)
+	seg.end = seg.end.Minus(center).Rotated(r).Plus(center)
+	return seg
+}
+func (seg Segment) ContainsPoint(x float64, y float64) bool {
+	return seg.DistanceTo(x, y) <= onLineTolerance
+}
+func (seg Segment) TestCollision(o Shape) Manifold {
+	return Collide(seg, o)
+}
+func (seg Segment) Intersects(o Shape) bool {
+	return Intersects(seg, o)
+}
+func (seg Segment) Encloses(o Shape) bool {
+	return Encloses(seg, o)
+}
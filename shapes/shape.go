@@ -5,8 +5,54 @@ import (
 )
 
 type Shape interface {
-	Translated() Shape
-	Rotated() Shape
-	// collision depth, and two manifold points
-	TestCollision(Shape) (float64, utils.FloatPair, utils.FloatPair)
+	// Smallest AxisRect that fully contains the shape
+	BoundingBox() AxisRect
+	Center() utils.FloatPair
+	// Never rounds, shapes that live on the integer grid give back a float shape when the result wouldn't land on it
+	Translated(x, y float64) Shape
+	// Rotation is in radians around the shape's own center
+	Rotated(r float64) Shape
+	ContainsPoint(x, y float64) bool
+	// Narrow phase test against any other shape, with the manifold normal pointing from this shape to the other one
+	TestCollision(Shape) Manifold
+	// True if the shapes overlap, just touching doesn't count
+	Intersects(Shape) bool
+	// True if the other shape is completely inside this one
+	Encloses(Shape) bool
+}
+
+// Shapes get passed around as both values and pointers, so we flatten pointers to values before type switching on them
+func shapeValue(shape Shape) Shape {
+	switch s := shape.(type) {
+	case *Circle:
+		return *s
+	case *AxisRect:
+		return *s
+	case *Rect:
+		return *s
+	case *Line:
+		return *s
+	case *Polygon:
+		return *s
+	case *Capsule:
+		return *s
+	case *Segment:
+		return *s
+	case *Ray:
+		return *s
+	}
+	return shape
+}
+
+// Rotates the shape by r radians around the point (x, y) instead of its own center
+func RotatedAround(shape Shape, r, x, y float64) Shape {
+	center := shape.Center()
+	pivot := utils.FloatPair{X: x, Y: y}
+	moved := center.Minus(pivot).Rotated(r).Plus(pivot)
+	return shape.Rotated(r).Translated(moved.X - center.X, moved.Y - center.Y)
+}
+
+// Rotates the shape around the origin and then moves it to (x, y), for taking shapes from a local space into the world
+func Transformed(shape Shape, x, y, r float64) Shape {
+	return RotatedAround(shape, r, 0, 0).Translated(x, y)
 }
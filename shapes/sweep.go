@@ -0,0 +1,135 @@
+package shapes
+
+import (
+	"github.com/Yarnsh/hippo/utils"
+	"math"
+)
+
+// How close two shapes have to get before a sweep counts them as touching
+const sweepTolerance = 0.01
+// Conservative advancement closes most of the gap every pass, so this is only hit by really grazing sweeps
+const maxSweepIterations = 32
+
+// Result of sweeping shapes through a motion
+type SweepHit struct {
+	Hit bool
+	Time float64 // How far through the motion they touch, from 0 to 1. Always 1 on a miss so you can move by motion * Time either way
+	Normal utils.FloatPair // Surface normal of what got hit, pointing back at the shape that was swept into it
+	Point utils.FloatPair // Where they touch, at Time
+}
+
+func missedSweep() SweepHit {
+	return SweepHit{Time: 1}
+}
+
+// Shapes that are already overlapping hit at the very start if they're pushing further in, pointing out the way the manifold would separate them
+// Ones already on their way out are left to carry on, otherwise anything resting on the ground could never slide along it
+func overlapHit(m Manifold, motion utils.FloatPair) SweepHit {
+	if motion.Dot(m.Normal) <= 0 {
+		return missedSweep()
+	}
+	return SweepHit{Hit: true, Time: 0, Normal: m.Normal.Negative(), Point: m.Contacts[0].Point}
+}
+
+// Time of impact between two shapes that both move in a straight line over the same stretch of time
+// Motions are the full distance each shape travels, rotation isn't swept so spin things slowly or sweep in smaller steps
+func TimeOfImpact(a Shape, motion_a utils.FloatPair, b Shape, motion_b utils.FloatPair) SweepHit {
+	motion := motion_a.Minus(motion_b)
+	result := Sweep(a, motion, b)
+	if result.Hit {
+		// Sweep left b where it started, so catch the contact up to where b actually is by then
+		result.Point = result.Point.Plus(motion_b.Multiply(result.Time))
+	}
+	return result
+}
+
+// Moves a along motion and finds the first time it touches b, which stays still
+func Sweep(a Shape, motion utils.FloatPair, b Shape) SweepHit {
+	a = shapeValue(a)
+	b = shapeValue(b)
+
+	if ra, ok := a.(AxisRect); ok {
+		if rb, ok := b.(AxisRect); ok {
+			return ra.SweepAxisRect(motion.X, motion.Y, rb)
+		}
+	}
+
+	ca, ok := convexOf(a)
+	if !ok || len(ca.points) == 0 {
+		return missedSweep()
+	}
+	cb, ok := convexOf(b)
+	if !ok || len(cb.points) == 0 {
+		return missedSweep()
+	}
+	return sweepConvex(ca, motion, cb)
+}
+
+// Conservative advancement, step a forward by the gap divided by how fast it's closing until the gap is gone
+// The gap along a straight line is convex, so these steps never jump past the real time of impact
+func sweepConvex(a convex, motion utils.FloatPair, b convex) SweepHit {
+	t := 0.0
+	for i := 0; i < maxSweepIterations; i++ {
+		moved := a.translated(motion.Multiply(t))
+		gap, normal, point := convexGap(moved, b)
+		if i == 0 && gap < -sweepTolerance {
+			return overlapHit(collideConvex(moved, b), motion)
+		}
+
+		closing := motion.Dot(normal)
+		if closing <= 0 {
+			// Moving apart or sliding along, either way they won't touch
+			return missedSweep()
+		}
+		if gap <= sweepTolerance {
+			return SweepHit{Hit: true, Time: t, Normal: normal.Negative(), Point: point}
+		}
+
+		t += gap / closing
+		if t > 1 {
+			return missedSweep()
+		}
+	}
+
+	// Ran out of passes while still closing in, close enough to call it a hit
+	moved := a.translated(motion.Multiply(t))
+	_, normal, point := convexGap(moved, b)
+	return SweepHit{Hit: true, Time: t, Normal: normal.Negative(), Point: point}
+}
+
+// Box covering everywhere box passes through while it moves along motion, handy for broad phase checks before sweeping
+func SweptBoundingBox(box AxisRect, motion utils.FloatPair) AxisRect {
+	minx := math.Min(float64(box.x), float64(box.x) + motion.X)
+	miny := math.Min(float64(box.y), float64(box.y) + motion.Y)
+	maxx := math.Max(float64(box.x2), float64(box.x2) + motion.X)
+	maxy := math.Max(float64(box.y2), float64(box.y2) + motion.Y)
+	return boundingBoxFromFloats(minx, miny, maxx, maxy)
+}
+
+func (c convex) translated(offset utils.FloatPair) convex {
+	points := make([]utils.FloatPair, len(c.points))
+	for i, p := range c.points {
+		points[i] = p.Plus(offset)
+	}
+	return convex{points: points, radius: c.radius}
+}
+
+// Distance between the outsides of two shapes, the direction from a to b, and the closest point on b
+// Overlapping shapes give back a negative gap with the manifold normal
+func convexGap(a, b convex) (float64, utils.FloatPair, utils.FloatPair) {
+	m := collideConvex(a, b)
+	if m.Colliding() {
+		return -m.Depth, m.Normal, m.Contacts[0].Point
+	}
+
+	closest_a, closest_b := closestCorePoints(a, b)
+	d := closest_b.Minus(closest_a)
+	dist := d.Length()
+	if dist == 0 {
+		// Cores touching with no radius to push them apart, so fall back to the direction between them
+		normal := b.points[0].Minus(a.points[0]).Normalized()
+		return 0, normal, closest_b
+	}
+	normal := d.Multiply(1 / dist)
+	return math.Max(dist - a.radius - b.radius, 0), normal, closest_b.Minus(normal.Multiply(b.radius))
+}
@@ -0,0 +1,141 @@
+package shapes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Yarnsh/hippo/utils"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a - b) <= tolerance
+}
+
+// First time along motion the shapes overlap, found by stepping through in tiny steps
+func bruteForceImpact(a Shape, motion utils.FloatPair, b Shape) (float64, bool) {
+	const steps = 20000
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / steps
+		moved := a.Translated(motion.X * t, motion.Y * t)
+		if Collide(moved, b).Colliding() {
+			return t, true
+		}
+	}
+	return 1, false
+}
+
+func TestSweepHeadOn(t *testing.T) {
+	cases := []struct {
+		name string
+		a Shape
+		motion utils.FloatPair
+		b Shape
+	}{
+		{"circles", NewCircle(0, 0, 5), utils.FloatPair{X: 100}, NewCircle(50, 0, 5)},
+		{"axis rects", NewAxisRect(-5, -5, 10, 10), utils.FloatPair{X: 100}, NewAxisRect(45, -5, 10, 10)},
+		{"circle into axis rect", NewCircle(0, 0, 5), utils.FloatPair{X: 100}, NewAxisRect(45, -20, 10, 40)},
+		{"capsule into polygon", NewCapsule(0, -5, 0, 5, 5), utils.FloatPair{X: 100}, mustPolygon(points(45, -20, 60, -20, 60, 20, 45, 20))},
+	}
+	for _, c := range cases {
+		hit := Sweep(c.a, c.motion, c.b)
+		if !hit.Hit {
+			t.Errorf("%s: missed", c.name)
+			continue
+		}
+		// They start 40 apart and close at 100 over the whole motion
+		if !near(hit.Time, 0.4, 0.001) {
+			t.Errorf("%s: expected time 0.4, got %v", c.name, hit.Time)
+		}
+		if !near(hit.Normal.X, -1, 1e-6) || !near(hit.Normal.Y, 0, 1e-6) {
+			t.Errorf("%s: expected the normal to point back along the motion, got %v", c.name, hit.Normal)
+		}
+		if !near(hit.Point.X, 45, 0.05) {
+			t.Errorf("%s: expected to touch at x 45, got %v", c.name, hit.Point)
+		}
+	}
+}
+
+func TestSweepMatchesBruteForce(t *testing.T) {
+	cases := []struct {
+		name string
+		a Shape
+		motion utils.FloatPair
+		b Shape
+	}{
+		{"circle into rotated rect", NewCircle(0, 0, 4), utils.FloatPair{X: 80, Y: 30}, NewRectCentered(60, 25, 20, 10, 0.6)},
+		{"rotated rect into circle", NewRectCentered(0, 0, 12, 6, 1.1), utils.FloatPair{X: 70, Y: -40}, NewCircle(55, -30, 6)},
+		{"polygon onto a corner", mustPolygon(points(-5, -5, 5, -5, 0, 6)), utils.FloatPair{X: 50, Y: 50}, NewRectCentered(40, 38, 10, 10, 0.785)},
+		{"grazing circles", NewCircle(0, 0, 5), utils.FloatPair{X: 100}, NewCircle(50, 9.5, 5)},
+	}
+	for _, c := range cases {
+		hit := Sweep(c.a, c.motion, c.b)
+		want, want_hit := bruteForceImpact(c.a, c.motion, c.b)
+		if hit.Hit != want_hit {
+			t.Errorf("%s: hit %v, brute force says %v", c.name, hit.Hit, want_hit)
+			continue
+		}
+		// Sweeps stop within sweepTolerance of touching, which is a little before they overlap
+		slack := (sweepTolerance / c.motion.Length()) + 0.001
+		if want_hit && (hit.Time > want + 0.0001 || hit.Time < want - slack) {
+			t.Errorf("%s: time %v, brute force says %v", c.name, hit.Time, want)
+		}
+	}
+}
+
+func TestSweepMisses(t *testing.T) {
+	if hit := Sweep(NewCircle(0, 0, 5), utils.FloatPair{X: 30}, NewCircle(50, 0, 5)); hit.Hit || hit.Time != 1 {
+		t.Errorf("stopping short: expected a miss with time 1, got %+v", hit)
+	}
+	if hit := Sweep(NewCircle(0, 0, 5), utils.FloatPair{X: 100}, NewCircle(50, 20, 5)); hit.Hit {
+		t.Errorf("passing by: expected a miss, got %+v", hit)
+	}
+	if hit := Sweep(NewCircle(0, 0, 5), utils.FloatPair{X: -100}, NewCircle(50, 0, 5)); hit.Hit {
+		t.Errorf("moving away: expected a miss, got %+v", hit)
+	}
+}
+
+func TestSweepThinWallDoesNotTunnel(t *testing.T) {
+	// Far further in one go than the circle or the wall are thick
+	hit := Sweep(NewCircle(0, 0, 1), utils.FloatPair{X: 1000}, NewSegment(500, -50, 500, 50))
+	if !hit.Hit || !near(hit.Time, 0.499, 0.001) {
+		t.Errorf("expected to hit the wall at time 0.499, got %+v", hit)
+	}
+}
+
+func TestSweepStartingOverlapped(t *testing.T) {
+	// Pushing further in hits straight away
+	hit := Sweep(NewCircle(0, 0, 5), utils.FloatPair{X: 10}, NewCircle(8, 0, 5))
+	if !hit.Hit || hit.Time != 0 {
+		t.Errorf("pushing in: expected a hit at time 0, got %+v", hit)
+	}
+	// Already on the way out is left alone
+	if hit := Sweep(NewCircle(0, 0, 5), utils.FloatPair{X: -10}, NewCircle(8, 0, 5)); hit.Hit {
+		t.Errorf("moving out: expected a miss, got %+v", hit)
+	}
+}
+
+func TestTimeOfImpactBothMoving(t *testing.T) {
+	// 90 apart and closing at 100, b has moved 45 to the left by the time they touch
+	hit := TimeOfImpact(NewCircle(0, 0, 5), utils.FloatPair{X: 50}, NewCircle(100, 0, 5), utils.FloatPair{X: -50})
+	if !hit.Hit || !near(hit.Time, 0.9, 0.001) {
+		t.Fatalf("expected a hit at time 0.9, got %+v", hit)
+	}
+	if !near(hit.Point.X, 45 + 5, 0.05) {
+		t.Errorf("expected to touch halfway between them at x 50, got %v", hit.Point)
+	}
+}
+
+func TestSweptBoundingBox(t *testing.T) {
+	box := SweptBoundingBox(NewAxisRect(0, 0, 10, 10), utils.FloatPair{X: -20.5, Y: 30})
+	if box.X() != -21 || box.Y() != 0 || box.X2() != 10 || box.Y2() != 40 {
+		t.Errorf("expected -21, 0 to 10, 40, got %v", box)
+	}
+}
+
+func mustPolygon(points []utils.FloatPair) Polygon {
+	poly, err := NewPolygon(points)
+	if err != nil {
+		panic(err)
+	}
+	return poly
+}
@@ -0,0 +1,212 @@
+package terrain
+
+import (
+	"math"
+
+	"github.com/Yarnsh/hippo/utils"
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// How big whatever is following a path is, so paths only go where it fits
+// Round agents keep Radius away from anything unwalkable, box agents keep their half width and height away
+type AgentSize struct {
+	Radius float64
+	HalfWidth float64
+	HalfHeight float64
+}
+
+func CircleAgent(radius float64) AgentSize {
+	return AgentSize{Radius: radius}
+}
+
+// Full width and height of the box
+func BoxAgent(w, h float64) AgentSize {
+	return AgentSize{HalfWidth: w / 2, HalfHeight: h / 2}
+}
+
+// Agents with no size can use the plain path finding
+func (agent AgentSize) IsPoint() bool {
+	return agent.Radius <= 0 && agent.HalfWidth <= 0 && agent.HalfHeight <= 0
+}
+
+// Furthest an unwalkable pixel can push the agent's center away from it
+func (agent AgentSize) reach() int {
+	return int(math.Ceil(math.Max(agent.Radius, math.Max(agent.HalfWidth, agent.HalfHeight))))
+}
+
+// Walkable spots an agent's center can't go because it would be overlapping something
+const tooClose = math.MinInt + 1
+
+var tooCloseMaterial = Material{Name: "too close"}
+
+// Copy of a tree where everything unwalkable has been grown by the agent's size, so the agent's center can find a path through it like a point
+// Edits to the real tree get queued up and patched in the next time the copy is used
+type clearanceMap struct {
+	tree *QuadTreeTerrain
+	pending []shapes.AxisRect
+}
+
+// Same as FindPath, but only through gaps the agent fits through, and never closer to a wall than the agent's size
+// The path is where the agent's center should go, and gaps are measured to the pixel, erring on the side of not fitting
+// The grown copy of the terrain is cached for each agent size and kept up to date as the terrain is edited
+func (tree QuadTreeTerrain) FindPathForAgent(s, e utils.IntPair, agent AgentSize) []utils.IntPair {
+	return tree.FindPathForAgentWithCosts(s, e, agent, nil)
+}
+
+func (tree QuadTreeTerrain) FindPathForAgentWithCosts(s, e utils.IntPair, agent AgentSize, costs PathCosts) []utils.IntPair {
+	if agent.IsPoint() {
+		return tree.FindPathWithCosts(s, e, costs)
+	}
+	return tree.clearanceTree(agent).FindPathWithCosts(s, e, costs)
+}
+
+// Same as ImprovePath, but only takes shortcuts the agent fits along
+func (tree QuadTreeTerrain) ImprovePathForAgent(path []utils.IntPair, agent AgentSize) []utils.IntPair {
+	return tree.ImprovePathForAgentWithCosts(path, agent, nil)
+}
+
+func (tree QuadTreeTerrain) ImprovePathForAgentWithCosts(path []utils.IntPair, agent AgentSize, costs PathCosts) []utils.IntPair {
+	if agent.IsPoint() {
+		return tree.ImprovePathWithCosts(path, costs)
+	}
+	return tree.clearanceTree(agent).ImprovePathWithCosts(path, costs)
+}
+
+// Same as ImprovePathBeginning, but only takes shortcuts the agent fits along
+func (tree QuadTreeTerrain) ImprovePathBeginningForAgent(path []utils.IntPair, agent AgentSize) []utils.IntPair {
+	return tree.ImprovePathBeginningForAgentWithCosts(path, agent, nil)
+}
+
+func (tree QuadTreeTerrain) ImprovePathBeginningForAgentWithCosts(path []utils.IntPair, agent AgentSize, costs PathCosts) []utils.IntPair {
+	if agent.IsPoint() {
+		return tree.ImprovePathBeginningWithCosts(path, costs)
+	}
+	return tree.clearanceTree(agent).ImprovePathBeginningWithCosts(path, costs)
+}
+
+// Whether the agent can stand with its center at the point without overlapping anything unwalkable
+func (tree QuadTreeTerrain) HasClearance(x, y float64, agent AgentSize) bool {
+	clearance := tree
+	if !agent.IsPoint() {
+		clearance = *tree.clearanceTree(agent)
+	}
+	value, ok := clearance.ValueAt(x, y)
+	return ok && clearance.Material(value).Walkable
+}
+
+// Drops the cached copies, they need rebuilding after changing which materials are walkable
+func (tree *QuadTreeTerrain) ForgetAgentSizes() {
+	if tree.settings.clearance_subscriber != 0 {
+		tree.Unsubscribe(tree.settings.clearance_subscriber)
+		tree.settings.clearance_subscriber = 0
+	}
+	tree.settings.clearance = nil
+}
+
+// Should be called on the root, since the copy is made from whatever tree it's called on
+func (tree QuadTreeTerrain) clearanceTree(agent AgentSize) *QuadTreeTerrain {
+	settings := tree.settings
+	if settings.clearance == nil {
+		settings.clearance = make(map[AgentSize]*clearanceMap)
+		settings.clearance_subscriber = tree.Subscribe(func(region shapes.AxisRect) {
+			for _, clearance := range settings.clearance {
+				clearance.pending = append(clearance.pending, region)
+			}
+		})
+	}
+
+	clearance, ok := settings.clearance[agent]
+	if !ok {
+		clearance = &clearanceMap{tree: tree.clone(&terrainSettings{bounds: settings.bounds, materials: settings.materials, material_filters: make(map[int]shapes.Filter)})}
+		tree.inflateInto(clearance.tree, tree.space, agent)
+		settings.clearance[agent] = clearance
+	}
+
+	reach := agent.reach()
+	for _, region := range clearance.pending {
+		// Put back what the terrain has now wherever the change could have reached, then grow everything unwalkable nearby back over it
+		area := growAxisRect(region, reach, reach)
+		tree.copyInto(clearance.tree, area)
+		tree.inflateInto(clearance.tree, growAxisRect(area, reach, reach), agent)
+	}
+	clearance.pending = nil
+	return clearance.tree
+}
+
+func (tree QuadTreeTerrain) clone(settings *terrainSettings) *QuadTreeTerrain {
+	result := newQuadTreeNode(tree.pixel_x, tree.pixel_y, tree.pixel_width, settings)
+	result.leaf = tree.leaf
+	result.leaf_value = tree.leaf_value
+	if !tree.leaf {
+		for i, st := range tree.sub_trees {
+			result.sub_trees[i] = st.clone(settings)
+		}
+	}
+	return result
+}
+
+// Calls fn for every leaf touching the area
+func (tree *QuadTreeTerrain) forEachLeaf(area shapes.AxisRect, fn func(leaf *QuadTreeTerrain)) {
+	if !area.IntersectsAxisRect(tree.space) {
+		return
+	}
+	if tree.leaf {
+		fn(tree)
+		return
+	}
+	for _, st := range tree.sub_trees {
+		st.forEachLeaf(area, fn)
+	}
+}
+
+// Paints this tree's values over the same spots in other, but only inside the area
+func (tree QuadTreeTerrain) copyInto(other *QuadTreeTerrain, area shapes.AxisRect) {
+	tree.forEachLeaf(area, func(leaf *QuadTreeTerrain) {
+		if overlap, ok := overlapAxisRect(leaf.space, area); ok {
+			other.setShape(overlap, leaf.leaf_value, false)
+		}
+	})
+}
+
+// Marks everywhere within the agent's size of an unwalkable leaf in the area as too close in other
+func (tree QuadTreeTerrain) inflateInto(other *QuadTreeTerrain, area shapes.AxisRect, agent AgentSize) {
+	tree.forEachLeaf(area, func(leaf *QuadTreeTerrain) {
+		if tree.Material(leaf.leaf_value).Walkable {
+			return
+		}
+		for _, shape := range agent.grownShapes(leaf.space) {
+			other.setShape(shape, tooClose, false)
+		}
+	})
+}
+
+// Shapes that together cover everywhere the agent's center would have it overlapping the rect
+func (agent AgentSize) grownShapes(rect shapes.AxisRect) []shapes.Shape {
+	if agent.Radius <= 0 {
+		return []shapes.Shape{growAxisRect(rect, int(math.Ceil(agent.HalfWidth)), int(math.Ceil(agent.HalfHeight)))}
+	}
+	// The rect itself is already unwalkable, so a capsule along each edge covers the rest of the rounded rect
+	x, y, x2, y2 := float64(rect.X()), float64(rect.Y()), float64(rect.X2()), float64(rect.Y2())
+	return []shapes.Shape{
+		shapes.NewCapsule(x, y, x2, y, agent.Radius),
+		shapes.NewCapsule(x, y2, x2, y2, agent.Radius),
+		shapes.NewCapsule(x, y, x, y2, agent.Radius),
+		shapes.NewCapsule(x2, y, x2, y2, agent.Radius),
+	}
+}
+
+func growAxisRect(rect shapes.AxisRect, x, y int) shapes.AxisRect {
+	return shapes.NewAxisRect(rect.X() - x, rect.Y() - y, rect.W() + (x * 2), rect.H() + (y * 2))
+}
+
+// The part of a inside b, false if they don't overlap at all
+func overlapAxisRect(a, b shapes.AxisRect) (shapes.AxisRect, bool) {
+	x := utils.MaxInt(a.X(), b.X())
+	y := utils.MaxInt(a.Y(), b.Y())
+	x2 := utils.MinInt(a.X2(), b.X2())
+	y2 := utils.MinInt(a.Y2(), b.Y2())
+	if x2 <= x || y2 <= y {
+		return shapes.AxisRect{}, false
+	}
+	return shapes.NewAxisRect(x, y, x2 - x, y2 - y), true
+}
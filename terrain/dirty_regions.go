@@ -0,0 +1,77 @@
+package terrain
+
+import (
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// Called with the area that changed every time the terrain gets edited
+type DirtyRegionCallback func(region shapes.AxisRect)
+
+// Most regions kept waiting for ConsumeDirtyRegions, past this they get squashed into one
+// Games that only Subscribe never consume them, so without a cap they'd pile up with every edit
+const maxDirtyRegions = 64
+
+type dirtySubscriber struct {
+	id int
+	callback DirtyRegionCallback
+}
+
+// Whether anything has changed since the last ConsumeDirtyRegions
+func (tree QuadTreeTerrain) IsDirty() bool {
+	return len(tree.settings.dirty_regions) > 0
+}
+
+// Every area that has changed since the last call, and clears them out
+// Regions can overlap, but one that falls completely inside another is only reported once
+// If more than maxDirtyRegions build up in between they get joined into a single region covering all of them
+func (tree *QuadTreeTerrain) ConsumeDirtyRegions() []shapes.AxisRect {
+	regions := tree.settings.dirty_regions
+	tree.settings.dirty_regions = nil
+	return regions
+}
+
+// The callback hears about every edit as it happens, whether or not anyone consumes the regions
+// Returns an id for Unsubscribe
+func (tree *QuadTreeTerrain) Subscribe(callback DirtyRegionCallback) int {
+	tree.settings.next_subscriber += 1
+	tree.settings.subscribers = append(tree.settings.subscribers, dirtySubscriber{id: tree.settings.next_subscriber, callback: callback})
+	return tree.settings.next_subscriber
+}
+
+func (tree *QuadTreeTerrain) Unsubscribe(id int) {
+	for i, subscriber := range tree.settings.subscribers {
+		if subscriber.id == id {
+			tree.settings.subscribers = append(tree.settings.subscribers[:i], tree.settings.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (tree *QuadTreeTerrain) markDirty(region shapes.AxisRect) {
+	regions := tree.settings.dirty_regions
+	covered := false
+	kept := regions[:0]
+	for _, existing := range regions {
+		if existing.EnclosesAxisRect(region) {
+			covered = true
+		}
+		if covered || !region.EnclosesAxisRect(existing) {
+			kept = append(kept, existing)
+		}
+	}
+	if !covered {
+		kept = append(kept, region)
+	}
+	if len(kept) > maxDirtyRegions {
+		bounds := kept[0]
+		for _, existing := range kept[1:] {
+			bounds = bounds.Union(existing)
+		}
+		kept = append(kept[:0], bounds)
+	}
+	tree.settings.dirty_regions = kept
+
+	for _, subscriber := range append([]dirtySubscriber{}, tree.settings.subscribers...) {
+		subscriber.callback(region)
+	}
+}
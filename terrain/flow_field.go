@@ -0,0 +1,398 @@
+package terrain
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/Yarnsh/hippo/utils"
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// Cost to the nearest goal from every corner of the terrain, so any number of units can head for the same goals without each doing a path search
+// Ask it which way to go with Direction or Target every so often, it's cheap enough to do every frame
+// Edits to the terrain only redo the corners whose way to the goals went near the edit, the next time the field is used
+type FlowField struct {
+	tree *QuadTreeTerrain
+	goals []utils.IntPair
+	agent AgentSize
+	costs PathCosts
+	nodes map[utils.IntPair]flowNode
+	graph *flowGraph // Kept between lookups until the terrain changes
+	pending []shapes.AxisRect
+	subscriber int
+}
+
+// What a corner costs to get to a goal from, and where to head next to get there
+// Corners on the edge of a goal's leaf head straight for the goal
+type flowNode struct {
+	value float64
+	next utils.IntPair
+}
+
+// The field watches the terrain for edits, call Close when done with it
+func NewFlowField(tree *QuadTreeTerrain, goals []utils.IntPair) *FlowField {
+	return NewFlowFieldForAgentWithCosts(tree, goals, AgentSize{}, nil)
+}
+
+func NewFlowFieldWithCosts(tree *QuadTreeTerrain, goals []utils.IntPair, costs PathCosts) *FlowField {
+	return NewFlowFieldForAgentWithCosts(tree, goals, AgentSize{}, costs)
+}
+
+// Only goes through gaps the agent fits through, the same as FindPathForAgent
+func NewFlowFieldForAgent(tree *QuadTreeTerrain, goals []utils.IntPair, agent AgentSize) *FlowField {
+	return NewFlowFieldForAgentWithCosts(tree, goals, agent, nil)
+}
+
+func NewFlowFieldForAgentWithCosts(tree *QuadTreeTerrain, goals []utils.IntPair, agent AgentSize, costs PathCosts) *FlowField {
+	field := &FlowField{tree: tree, agent: agent}
+	// Our own copy, so changing the map afterwards doesn't change the field
+	if costs != nil {
+		field.costs = make(PathCosts, len(costs))
+		for value, cost := range costs {
+			field.costs[value] = cost
+		}
+	}
+	field.subscriber = tree.Subscribe(func(region shapes.AxisRect) {
+		field.pending = append(field.pending, region)
+	})
+	field.SetGoals(goals)
+	return field
+}
+
+// Getters
+func (field FlowField) Goals() []utils.IntPair {
+	return append([]utils.IntPair{}, field.goals...)
+}
+func (field FlowField) Agent() AgentSize {
+	return field.agent
+}
+// End getters
+
+// Works out the whole field again for the new goals
+func (field *FlowField) SetGoals(goals []utils.IntPair) {
+	field.goals = append([]utils.IntPair{}, goals...)
+	field.Rebuild()
+}
+
+// Works out the whole field from scratch, needed after changing material costs or which materials are walkable
+func (field *FlowField) Rebuild() {
+	graph := field.freshGraph()
+	field.pending = nil
+	field.nodes = make(map[utils.IntPair]flowNode)
+	open := pathHeap{}
+	field.seed(graph, &open)
+	field.spread(graph, &open)
+}
+
+func (field *FlowField) Close() {
+	field.tree.Unsubscribe(field.subscriber)
+	field.pending = nil
+}
+
+// Patches in any terrain edits since the field was last used
+// Happens anyway the next time the field is asked for anything, this is for doing it at a time that suits
+func (field *FlowField) Update() {
+	if len(field.pending) == 0 {
+		return
+	}
+
+	// Everything heading to or through somewhere near an edit might have changed
+	reach := field.agent.reach() + 1
+	areas := make([]shapes.AxisRect, len(field.pending))
+	for i, region := range field.pending {
+		areas[i] = growAxisRect(region, reach, reach)
+	}
+	field.pending = nil
+
+	// A grown copy gets patched without saying which of its leaves got split or joined, and those leaves can reach past the areas
+	// Covering the leaves there before and after the patch catches every step and corner they took with them
+	if !field.agent.IsPoint() {
+		field.graph.coverLeaves(areas)
+	}
+	graph := field.freshGraph()
+	if !field.agent.IsPoint() {
+		graph.coverLeaves(areas)
+	}
+
+	invalid := []utils.IntPair{}
+	seen := make(map[utils.IntPair]void)
+	for pos, node := range field.nodes {
+		step := shapes.NewSegment(float64(pos.X), float64(pos.Y), float64(node.next.X), float64(node.next.Y)).BoundingBox()
+		for _, area := range areas {
+			if area.IntersectsAxisRect(step) {
+				invalid = append(invalid, pos)
+				seen[pos] = void_item
+				break
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		children := make(map[utils.IntPair][]utils.IntPair)
+		for pos, node := range field.nodes {
+			if node.next != pos {
+				children[node.next] = append(children[node.next], pos)
+			}
+		}
+		for i := 0; i < len(invalid); i++ {
+			for _, child := range children[invalid[i]] {
+				if _, ok := seen[child]; !ok {
+					seen[child] = void_item
+					invalid = append(invalid, child)
+				}
+			}
+		}
+		for _, pos := range invalid {
+			delete(field.nodes, pos)
+		}
+	}
+
+	// Corners the edits made are new to the field too
+	for _, area := range areas {
+		graph.tree.forEachLeaf(area, func(leaf *QuadTreeTerrain) {
+			for _, corner := range leafCorners(leaf) {
+				if _, ok := seen[corner]; !ok && area.ContainsPoint(float64(corner.X), float64(corner.Y)) {
+					seen[corner] = void_item
+					invalid = append(invalid, corner)
+				}
+			}
+		})
+	}
+
+	// Spread back in from the goals and from whatever is still good around the edges of what got thrown out
+	open := pathHeap{}
+	field.seed(graph, &open)
+	for _, pos := range invalid {
+		for _, edge := range graph.neighbours(pos) {
+			if node, ok := field.nodes[edge.pos]; ok {
+				heap.Push(&open, pathNode{pos: edge.pos, estimate: node.value})
+			}
+		}
+	}
+	field.spread(graph, &open)
+}
+
+// Cost of getting from the point to the nearest goal, false if no goal can be reached from there
+func (field *FlowField) Value(x, y float64) (float64, bool) {
+	_, value, ok := field.best(x, y)
+	return value, ok
+}
+
+// Where to head in a straight line from the point, either a corner or a goal
+// Nothing unwalkable is in the way of going straight there
+func (field *FlowField) Target(x, y float64) (utils.IntPair, bool) {
+	target, _, ok := field.best(x, y)
+	return target, ok
+}
+
+// Unit vector pointing the way to go from the point, 0, 0 when standing on a goal
+func (field *FlowField) Direction(x, y float64) (float64, float64, bool) {
+	target, _, ok := field.best(x, y)
+	if !ok {
+		return 0, 0, false
+	}
+	dx, dy := float64(target.X) - x, float64(target.Y) - y
+	length := math.Hypot(dx, dy)
+	if length < 1e-9 {
+		return 0, 0, true
+	}
+	return dx / length, dy / length, true
+}
+
+// Anywhere on the edge of a walkable leaf can be walked to in a straight line from inside it, so the best of those is the way to go
+func (field *FlowField) best(x, y float64) (utils.IntPair, float64, bool) {
+	field.Update()
+	graph := *field.graph
+
+	best := math.Inf(1)
+	target := utils.IntPair{}
+	consider := func(pos utils.IntPair, cost float64) {
+		if cost < best {
+			best = cost
+			target = pos
+		}
+	}
+	graph.leavesAt(x, y, func(leaf *QuadTreeTerrain, cost float64) {
+		for _, goal := range field.goals {
+			if leaf.space.ContainsPoint(float64(goal.X), float64(goal.Y)) {
+				consider(goal, math.Hypot(float64(goal.X) - x, float64(goal.Y) - y) * cost)
+			}
+		}
+		for _, corner := range graph.edgeCorners(leaf) {
+			node, ok := field.nodes[corner]
+			if !ok {
+				continue
+			}
+			distance := math.Hypot(float64(corner.X) - x, float64(corner.Y) - y)
+			if distance < 1e-9 {
+				// Already there, so on to the next one
+				consider(node.next, node.value)
+			} else {
+				consider(corner, (distance * cost) + node.value)
+			}
+		}
+	})
+	if math.IsInf(best, 1) {
+		return utils.IntPair{}, 0, false
+	}
+	return target, best, true
+}
+
+// Corners on the edges of each goal's leaf get what it costs to walk straight to the goal
+func (field *FlowField) seed(graph flowGraph, open *pathHeap) {
+	for _, goal := range field.goals {
+		graph.leavesAt(float64(goal.X), float64(goal.Y), func(leaf *QuadTreeTerrain, cost float64) {
+			for _, corner := range graph.edgeCorners(leaf) {
+				value := EuclidianDistance(goal, corner) * cost
+				if node, ok := field.nodes[corner]; ok && node.value <= value {
+					continue
+				}
+				field.nodes[corner] = flowNode{value: value, next: goal}
+				heap.Push(open, pathNode{pos: corner, estimate: value})
+			}
+		})
+	}
+}
+
+// Dijkstra outwards from whatever is in the heap, only ever lowering values so it can carry on from a partly worked out field
+func (field *FlowField) spread(graph flowGraph, open *pathHeap) {
+	for open.Len() > 0 {
+		current := heap.Pop(open).(pathNode)
+		node := field.nodes[current.pos]
+		if node.value < current.estimate - 1e-9 {
+			// Found a cheaper way here since this was pushed
+			continue
+		}
+		for _, edge := range graph.neighbours(current.pos) {
+			value := node.value + edge.cost
+			if old, ok := field.nodes[edge.pos]; ok && old.value <= value + 1e-9 {
+				continue
+			}
+			field.nodes[edge.pos] = flowNode{value: value, next: current.pos}
+			heap.Push(open, pathNode{pos: edge.pos, estimate: value})
+		}
+	}
+}
+
+// The walkable leaves of whatever tree the field is on, until the next edit
+// Leaves only change with edits, so the corners along their edges get worked out once in between
+type flowGraph struct {
+	tree *QuadTreeTerrain
+	coster pathCoster
+	edges map[*QuadTreeTerrain][]utils.IntPair
+}
+
+// Somewhere a corner can walk straight to, and what it costs
+type flowEdge struct {
+	pos utils.IntPair
+	cost float64
+}
+
+// Throws away the cached graph for one that matches the terrain as it is now
+// Works on the grown copy of the tree for agents with a size
+func (field *FlowField) freshGraph() flowGraph {
+	tree := field.tree
+	if !field.agent.IsPoint() {
+		tree = field.tree.clearanceTree(field.agent)
+	}
+	field.graph = &flowGraph{tree: tree, coster: tree.pathCoster(field.costs), edges: make(map[*QuadTreeTerrain][]utils.IntPair)}
+	return *field.graph
+}
+
+// Calls fn for every walkable leaf with the point in it or on its edge, along with what it costs to walk across
+func (graph flowGraph) leavesAt(x, y float64, fn func(leaf *QuadTreeTerrain, cost float64)) {
+	graph.tree.forEachLeaf(shapes.NewAxisRect(int(math.Floor(x)), int(math.Floor(y)), 1, 1), func(leaf *QuadTreeTerrain) {
+		if leaf.space.ContainsPoint(x, y) && graph.tree.Material(leaf.leaf_value).Walkable {
+			fn(leaf, graph.coster.cost(leaf.leaf_value))
+		}
+	})
+}
+
+// Every corner along the leaf's edges, including the ones from smaller leaves next to it
+func (graph flowGraph) edgeCorners(leaf *QuadTreeTerrain) []utils.IntPair {
+	if corners, ok := graph.edges[leaf]; ok {
+		return corners
+	}
+	space := leaf.space
+	corners := []utils.IntPair{}
+	seen := make(map[utils.IntPair]void)
+	graph.tree.forEachLeaf(space, func(other *QuadTreeTerrain) {
+		for _, corner := range leafCorners(other) {
+			on_edge := ((corner.X == space.X() || corner.X == space.X2()) && corner.Y >= space.Y() && corner.Y <= space.Y2()) ||
+				((corner.Y == space.Y() || corner.Y == space.Y2()) && corner.X >= space.X() && corner.X <= space.X2())
+			if _, ok := seen[corner]; !ok && on_edge {
+				seen[corner] = void_item
+				corners = append(corners, corner)
+			}
+		}
+	})
+	graph.edges[leaf] = corners
+	return corners
+}
+
+// Corners that can be walked to in a straight line across or along a walkable leaf
+// Unlike GetAdjacentCorners this goes both ways, which spreading out from the goals needs
+func (graph flowGraph) neighbours(pos utils.IntPair) []flowEdge {
+	// Steps along an edge come up from the leaves on both sides of it, and spreading keeps the cheaper one
+	result := []flowEdge{}
+	add := func(other utils.IntPair, cost float64) {
+		result = append(result, flowEdge{pos: other, cost: cost})
+	}
+
+	graph.leavesAt(float64(pos.X), float64(pos.Y), func(leaf *QuadTreeTerrain, cost float64) {
+		corners := leafCorners(leaf)
+		edge := graph.edgeCorners(leaf)
+		is_corner := false
+		for _, corner := range corners {
+			is_corner = is_corner || corner == pos
+		}
+
+		// Straight across the leaf, the leaf's own corners see every corner on the other edges and the rest only see the leaf's corners
+		across := edge
+		if !is_corner {
+			across = corners[:]
+		}
+		for _, other := range across {
+			if other.X != pos.X && other.Y != pos.Y {
+				add(other, EuclidianDistance(pos, other) * cost)
+			}
+		}
+
+		// Along the edges only as far as the next corner each way, anything further goes through it anyway
+		left, right, up, down := pos, pos, pos, pos
+		for _, other := range edge {
+			if other.Y == pos.Y && other.X < pos.X && (left == pos || other.X > left.X) {
+				left = other
+			} else if other.Y == pos.Y && other.X > pos.X && (right == pos || other.X < right.X) {
+				right = other
+			} else if other.X == pos.X && other.Y < pos.Y && (up == pos || other.Y > up.Y) {
+				up = other
+			} else if other.X == pos.X && other.Y > pos.Y && (down == pos || other.Y < down.Y) {
+				down = other
+			}
+		}
+		for _, other := range []utils.IntPair{left, right, up, down} {
+			if other != pos {
+				add(other, EuclidianDistance(pos, other) * cost)
+			}
+		}
+	})
+	return result
+}
+
+// Grows each area to cover every leaf touching it
+func (graph flowGraph) coverLeaves(areas []shapes.AxisRect) {
+	for i, area := range areas {
+		graph.tree.forEachLeaf(area, func(leaf *QuadTreeTerrain) {
+			areas[i] = areas[i].Union(leaf.space)
+		})
+	}
+}
+
+func leafCorners(leaf *QuadTreeTerrain) [4]utils.IntPair {
+	return [4]utils.IntPair{
+		{X: leaf.space.X(), Y: leaf.space.Y()},
+		{X: leaf.space.X2(), Y: leaf.space.Y()},
+		{X: leaf.space.X(), Y: leaf.space.Y2()},
+		{X: leaf.space.X2(), Y: leaf.space.Y2()},
+	}
+}
@@ -0,0 +1,134 @@
+package terrain
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+)
+
+func randomBlocks(r *rand.Rand, size, count int) *QuadTreeTerrain {
+	tree := NewQuadTreeTerrain(0, 0, size)
+	tree.MaterialTable().Register(2, Material{Name: "mud", Walkable: true, Cost: 3})
+	for i := 0; i < count; i++ {
+		tree.SetShape(shapes.NewAxisRect(r.Intn(size), r.Intn(size), 2 + r.Intn(size / 8), 2 + r.Intn(size / 8)), 1 + r.Intn(2))
+	}
+	return tree
+}
+
+// Patching a field after edits has to end up with exactly what building it from scratch gives
+func sameField(t *testing.T, label string, got, want *FlowField) {
+	t.Helper()
+	for pos, node := range want.nodes {
+		if old, ok := got.nodes[pos]; !ok || math.Abs(old.value - node.value) > 1e-6 {
+			t.Fatalf("%s: corner %v is %v in the patched field, %v built from scratch (present %v)", label, pos, old.value, node.value, ok)
+		}
+	}
+	for pos := range got.nodes {
+		if _, ok := want.nodes[pos]; !ok {
+			t.Fatalf("%s: patched field still has corner %v", label, pos)
+		}
+	}
+}
+
+func TestFlowFieldUpdateMatchesRebuild(t *testing.T) {
+	for _, agent := range []AgentSize{{}, CircleAgent(3)} {
+		r := rand.New(rand.NewSource(3))
+		tree := randomBlocks(r, 256, 40)
+		goals := []utils.IntPair{{X: 128, Y: 128}, {X: 20, Y: 230}}
+		for _, goal := range goals {
+			tree.SetShape(shapes.NewAxisRect(goal.X - 8, goal.Y - 8, 16, 16), 0)
+		}
+		field := NewFlowFieldForAgent(tree, goals, agent)
+
+		for round := 0; round < 20; round++ {
+			// Walls going up and getting knocked down, away from the goals so they stay reachable
+			tree.SetShape(shapes.NewAxisRect(r.Intn(256), r.Intn(256), 2 + r.Intn(60), 2 + r.Intn(8)), 1 + r.Intn(2))
+			tree.Carve(shapes.NewAxisRect(r.Intn(256), r.Intn(256), 2 + r.Intn(30), 2 + r.Intn(30)), 0)
+			for _, goal := range goals {
+				tree.SetShape(shapes.NewAxisRect(goal.X - 8, goal.Y - 8, 16, 16), 0)
+			}
+			field.Update()
+			fresh := NewFlowFieldForAgent(tree, goals, agent)
+			sameField(t, fmt.Sprintf("agent %v round %d", agent, round), field, fresh)
+			fresh.Close()
+		}
+		field.Close()
+	}
+}
+
+func TestFlowFieldUpdateOnlyRedoesWhatTheEditReached(t *testing.T) {
+	tree := NewQuadTreeTerrain(0, 0, 256)
+	tree.SetShape(shapes.NewAxisRect(60, 0, 8, 200), 1)
+	field := NewFlowField(tree, []utils.IntPair{{X: 20, Y: 20}})
+	before := make(map[utils.IntPair]flowNode, len(field.nodes))
+	for pos, node := range field.nodes {
+		before[pos] = node
+	}
+
+	// Down in the far corner, nothing on the way to the goal from the rest of the map goes near it
+	tree.SetShape(shapes.NewAxisRect(240, 240, 4, 4), 1)
+	field.Update()
+	kept := 0
+	for pos, node := range before {
+		if pos.X < 200 && pos.Y < 200 && field.nodes[pos] == node {
+			kept += 1
+		}
+	}
+	if kept == 0 {
+		t.Errorf("edit in the corner redid the whole field")
+	}
+	fresh := NewFlowField(tree, []utils.IntPair{{X: 20, Y: 20}})
+	sameField(t, "corner edit", field, fresh)
+}
+
+func TestFlowFieldLeadsToTheGoal(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	tree := randomBlocks(r, 256, 30)
+	goal := utils.IntPair{X: 128, Y: 128}
+	tree.SetShape(shapes.NewAxisRect(goal.X - 8, goal.Y - 8, 16, 16), 0)
+	field := NewFlowField(tree, []utils.IntPair{goal})
+	defer field.Close()
+	coster := tree.pathCoster(nil)
+
+	followed := 0
+	for i := 0; i < 100; i++ {
+		x, y := float64(r.Intn(256)) + 0.5, float64(r.Intn(256)) + 0.5
+		value, ok := field.Value(x, y)
+		if !ok {
+			continue
+		}
+		followed += 1
+		// Walking to each target in turn has to add up to the value, and never go through anything
+		total := 0.0
+		for steps := 0; ; steps++ {
+			target, _ := field.Target(x, y)
+			if float64(target.X) == x && float64(target.Y) == y {
+				break
+			}
+			seg := shapes.NewSegment(x, y, float64(target.X), float64(target.Y))
+			spans, clear := coster.spans(seg, coster)
+			cost := 0.0
+			if clear {
+				cost, clear = spansCost(spans, seg.Length())
+			}
+			if !clear || steps > 1000 {
+				t.Fatalf("following the field from %v, %v got stuck at %v, %v", x, y, target.X, target.Y)
+			}
+			total += cost
+			x, y = float64(target.X), float64(target.Y)
+		}
+		if x != float64(goal.X) || y != float64(goal.Y) {
+			t.Errorf("ended up at %v, %v instead of the goal", x, y)
+		}
+		if total > value + 1e-6 {
+			t.Errorf("walking the field cost %v but its value was %v", total, value)
+		}
+	}
+	if followed == 0 {
+		t.Fatalf("no starting points could reach the goal")
+	}
+}
@@ -0,0 +1,463 @@
+package terrain
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/Yarnsh/hippo/utils"
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// Plans paths over clusters of the quadtree first and only fills in the detail inside the clusters it goes through
+// Clusters are the tree's nodes cut off at cluster_size, and any uniform leaf bigger than that is one cluster by itself, so open areas cost next to nothing
+// Paths between the entrances of each cluster are worked out the first time they're needed and kept until an edit touches the cluster
+// Each agent size and set of cost overrides gets its own clusters, so stick to a handful of them
+// Paths can come out a little longer than FindPath's since they go through entrances, ImprovePath straightens most of that back out
+// Everything happens on the calling goroutine
+type HierarchicalPathfinder struct {
+	tree *QuadTreeTerrain
+	cluster_size int
+	caches map[string]*clusterCache
+	subscriber int
+}
+
+// The clusters for one agent size and set of costs
+type clusterCache struct {
+	graph *QuadTreeTerrain // The tree, or the grown copy of it for agents with a size
+	coster pathCoster
+	cluster_size int
+	agent AgentSize
+	costs PathCosts
+	clusters map[shapes.AxisRect]*pathCluster
+	pending []shapes.AxisRect
+}
+
+// Entrances and the paths between them for one cluster
+type pathCluster struct {
+	space shapes.AxisRect
+	entrances []utils.IntPair
+	edges map[utils.IntPair]map[utils.IntPair]clusterEdge
+}
+
+// Cheapest way between two points without leaving a cluster, path includes both ends
+type clusterEdge struct {
+	cost float64
+	path []utils.IntPair
+}
+
+// The pathfinder watches the terrain for edits, call Close when done with it
+// cluster_size should be a power of 2, somewhere around 32 to 128 works for most maps
+func NewHierarchicalPathfinder(tree *QuadTreeTerrain, cluster_size int) *HierarchicalPathfinder {
+	finder := &HierarchicalPathfinder{
+		tree: tree,
+		cluster_size: cluster_size,
+		caches: make(map[string]*clusterCache),
+	}
+	finder.subscriber = tree.Subscribe(finder.terrainChanged)
+	return finder
+}
+
+// Getters
+func (finder HierarchicalPathfinder) ClusterSize() int {
+	return finder.cluster_size
+}
+// How many clusters have their entrances worked out at the moment, across every agent size and set of costs
+func (finder HierarchicalPathfinder) CachedClusters() int {
+	count := 0
+	for _, cache := range finder.caches {
+		count += len(cache.clusters)
+	}
+	return count
+}
+// End getters
+
+func (finder *HierarchicalPathfinder) Close() {
+	finder.tree.Unsubscribe(finder.subscriber)
+	finder.caches = make(map[string]*clusterCache)
+}
+
+// Drops every cached cluster, they get rebuilt as paths need them
+// Needed after changing material costs or which materials are walkable
+func (finder *HierarchicalPathfinder) Forget() {
+	finder.caches = make(map[string]*clusterCache)
+}
+
+// Edits get patched in the next time each cache gets used
+func (finder *HierarchicalPathfinder) terrainChanged(region shapes.AxisRect) {
+	for _, cache := range finder.caches {
+		cache.pending = append(cache.pending, region)
+	}
+}
+
+// Same layout as FindPath's paths, and the same start and end checks
+func (finder *HierarchicalPathfinder) FindPath(s, e utils.IntPair) []utils.IntPair {
+	return finder.FindPathForAgentWithCosts(s, e, AgentSize{}, nil)
+}
+
+func (finder *HierarchicalPathfinder) FindPathWithCosts(s, e utils.IntPair, costs PathCosts) []utils.IntPair {
+	return finder.FindPathForAgentWithCosts(s, e, AgentSize{}, costs)
+}
+
+// Only through gaps the agent fits through, the same as FindPathForAgent
+func (finder *HierarchicalPathfinder) FindPathForAgent(s, e utils.IntPair, agent AgentSize) []utils.IntPair {
+	return finder.FindPathForAgentWithCosts(s, e, agent, nil)
+}
+
+func (finder *HierarchicalPathfinder) FindPathForAgentWithCosts(s, e utils.IntPair, agent AgentSize, costs PathCosts) []utils.IntPair {
+	cache := finder.cache(agent, costs)
+	graph, coster := cache.graph, cache.coster
+	s_inside, sx, sy := graph.GetClosestCorner(float64(s.X), float64(s.Y))
+	e_inside, ex, ey := graph.GetClosestCorner(float64(e.X), float64(e.Y))
+	if !s_inside || !e_inside {
+		return []utils.IntPair{}
+	}
+	s = utils.IntPair{X: sx, Y: sy}
+	e = utils.IntPair{X: ex, Y: ey}
+	if len(graph.GetAdjacentCorners(e.X, e.Y)) <= 0 {
+		return []utils.IntPair{}
+	}
+
+	// Hook the start and end up to the entrances of the clusters they're in, and straight to each other if they share one
+	from_start := make(map[utils.IntPair]clusterEdge)
+	to_end := make(map[utils.IntPair]clusterEdge)
+	for _, cluster := range cache.clustersAt(s) {
+		targets := append([]utils.IntPair{e}, cluster.entrances...)
+		for target, edge := range cache.localPaths(cluster.space, s, targets) {
+			if old, ok := from_start[target]; !ok || edge.cost < old.cost {
+				from_start[target] = edge
+			}
+		}
+	}
+	for _, cluster := range cache.clustersAt(e) {
+		for target, edge := range cache.localPaths(cluster.space, e, cluster.entrances) {
+			if old, ok := to_end[target]; !ok || edge.cost < old.cost {
+				to_end[target] = reversedEdge(edge)
+			}
+		}
+	}
+
+	// A* over the entrances
+	costs_so_far := map[utils.IntPair]float64{s: 0}
+	came_from := make(map[utils.IntPair]utils.IntPair)
+	came_by := make(map[utils.IntPair]clusterEdge)
+	closed := make(map[utils.IntPair]void)
+	open := pathHeap{}
+	heap.Push(&open, pathNode{pos: s, estimate: coster.heuristic(s, e)})
+	found := false
+	for open.Len() > 0 {
+		current := heap.Pop(&open).(pathNode).pos
+		if _, ok := closed[current]; ok {
+			continue
+		}
+		if current == e {
+			found = true
+			break
+		}
+		closed[current] = void_item
+
+		for next, edge := range cache.abstractEdges(current, s, from_start, to_end) {
+			if _, ok := closed[next]; ok {
+				continue
+			}
+			cost := costs_so_far[current] + edge.cost
+			if old, seen := costs_so_far[next]; seen && old <= cost {
+				continue
+			}
+			costs_so_far[next] = cost
+			came_from[next] = current
+			came_by[next] = edge
+			heap.Push(&open, pathNode{pos: next, estimate: cost + coster.heuristic(next, e)})
+		}
+	}
+	if !found {
+		// No way through
+		return []utils.IntPair{}
+	}
+
+	// Fill in the detail from the cached paths inside each cluster
+	entrances := tracePath(came_from, s, e)
+	corners := []utils.IntPair{s}
+	for _, pos := range entrances[1:] {
+		corners = append(corners, came_by[pos].path[1:]...)
+	}
+	return pathWithEnds(corners)
+}
+
+// The cache for the agent and costs, brought up to date with the terrain
+func (finder *HierarchicalPathfinder) cache(agent AgentSize, costs PathCosts) *clusterCache {
+	key := agentCostsKey(agent, costs)
+	cache, ok := finder.caches[key]
+	if !ok {
+		// Our own copy, so changing the map afterwards doesn't change the cache
+		cache = &clusterCache{cluster_size: finder.cluster_size, agent: agent}
+		if costs != nil {
+			cache.costs = make(PathCosts, len(costs))
+			for value, cost := range costs {
+				cache.costs[value] = cost
+			}
+		}
+		finder.caches[key] = cache
+	}
+
+	graph := finder.tree
+	if !agent.IsPoint() {
+		graph = finder.tree.clearanceTree(agent)
+	}
+	if graph != cache.graph || len(cache.pending) > maxDirtyRegions {
+		// A whole new grown copy after ForgetAgentSizes, or so many edits that starting over is simpler
+		cache.clusters = make(map[shapes.AxisRect]*pathCluster)
+		cache.pending = nil
+	}
+	cache.graph = graph
+	cache.coster = graph.pathCoster(cache.costs)
+	cache.applyPending()
+	return cache
+}
+
+// Edits can split or join clusters, and entrances depend on the clusters next door, so everything touching the clusters an edit is in gets dropped
+func (cache *clusterCache) applyPending() {
+	reach := cache.agent.reach() + 1
+	for _, region := range cache.pending {
+		area := growAxisRect(region, reach, reach)
+		affected := area
+		cache.graph.forEachCluster(area, cache.cluster_size, func(cluster *QuadTreeTerrain) {
+			affected = affected.Union(cluster.space)
+		})
+		for space := range cache.clusters {
+			if space.IntersectsAxisRect(affected) {
+				delete(cache.clusters, space)
+			}
+		}
+	}
+	cache.pending = nil
+}
+
+// Everywhere the abstract search can go next from pos
+func (cache *clusterCache) abstractEdges(pos, s utils.IntPair, from_start, to_end map[utils.IntPair]clusterEdge) map[utils.IntPair]clusterEdge {
+	result := make(map[utils.IntPair]clusterEdge)
+	add := func(target utils.IntPair, edge clusterEdge) {
+		if old, ok := result[target]; !ok || edge.cost < old.cost {
+			result[target] = edge
+		}
+	}
+
+	if pos == s {
+		for target, edge := range from_start {
+			add(target, edge)
+		}
+	} else {
+		for _, cluster := range cache.clustersAt(pos) {
+			for target, edge := range cluster.edges[pos] {
+				add(target, edge)
+			}
+		}
+	}
+	if edge, ok := to_end[pos]; ok {
+		// to_end is keyed by where it starts, so this is the way into the end
+		add(edge.path[len(edge.path) - 1], edge)
+	}
+	return result
+}
+
+// Every cluster with pos in it or on its edge, worked out now if they aren't cached
+func (cache *clusterCache) clustersAt(pos utils.IntPair) []*pathCluster {
+	result := []*pathCluster{}
+	cache.graph.forEachCluster(shapes.NewAxisRect(pos.X, pos.Y, 0, 0), cache.cluster_size, func(node *QuadTreeTerrain) {
+		cluster, ok := cache.clusters[node.space]
+		if !ok {
+			cluster = cache.buildCluster(node.space)
+			cache.clusters[node.space] = cluster
+		}
+		result = append(result, cluster)
+	})
+	return result
+}
+
+func (cache *clusterCache) buildCluster(space shapes.AxisRect) *pathCluster {
+	cluster := &pathCluster{space: space, edges: make(map[utils.IntPair]map[utils.IntPair]clusterEdge)}
+
+	// Entrances go on each stretch of edge shared with a neighbouring cluster, worked out the same way from both sides so they always line up
+	seen := make(map[utils.IntPair]void)
+	sides := [4][2]utils.IntPair{
+		{{X: space.X(), Y: space.Y()}, {X: space.X2(), Y: space.Y()}},
+		{{X: space.X(), Y: space.Y2()}, {X: space.X2(), Y: space.Y2()}},
+		{{X: space.X(), Y: space.Y()}, {X: space.X(), Y: space.Y2()}},
+		{{X: space.X2(), Y: space.Y()}, {X: space.X2(), Y: space.Y2()}},
+	}
+	for _, side := range sides {
+		side_rect := shapes.NewAxisRect(side[0].X, side[0].Y, side[1].X - side[0].X, side[1].Y - side[0].Y)
+		cache.graph.forEachCluster(side_rect, cache.cluster_size, func(neighbour *QuadTreeTerrain) {
+			if neighbour.space == space {
+				return
+			}
+			shared, ok := sharedEdge(side, neighbour.space)
+			if !ok {
+				return
+			}
+			for _, entrance := range cache.entrances(shared) {
+				if _, ok := seen[entrance]; !ok {
+					seen[entrance] = void_item
+					cluster.entrances = append(cluster.entrances, entrance)
+				}
+			}
+		})
+	}
+
+	for _, entrance := range cluster.entrances {
+		cluster.edges[entrance] = cache.localPaths(space, entrance, cluster.entrances)
+	}
+	return cluster
+}
+
+// The part of a cluster's side that lies along the other cluster, false if they only meet at a corner or not at all
+func sharedEdge(side [2]utils.IntPair, other shapes.AxisRect) ([2]utils.IntPair, bool) {
+	if side[0].Y == side[1].Y {
+		if side[0].Y != other.Y() && side[0].Y != other.Y2() {
+			return side, false
+		}
+		start := utils.MaxInt(side[0].X, other.X())
+		end := utils.MinInt(side[1].X, other.X2())
+		return [2]utils.IntPair{{X: start, Y: side[0].Y}, {X: end, Y: side[0].Y}}, end > start
+	}
+	if side[0].X != other.X() && side[0].X != other.X2() {
+		return side, false
+	}
+	start := utils.MaxInt(side[0].Y, other.Y())
+	end := utils.MinInt(side[1].Y, other.Y2())
+	return [2]utils.IntPair{{X: side[0].X, Y: start}, {X: side[0].X, Y: end}}, end > start
+}
+
+// Corners along a shared edge that paths can cross at
+// Corners that can walk along the edge to each other make one entrance, which gets points at both ends, and one in the middle if it's long
+func (cache *clusterCache) entrances(edge [2]utils.IntPair) []utils.IntPair {
+	horizontal := edge[0].Y == edge[1].Y
+	along := func(p utils.IntPair) int {
+		if horizontal {
+			return p.X
+		}
+		return p.Y
+	}
+
+	corners := []utils.IntPair{}
+	seen := make(map[utils.IntPair]void)
+	area := shapes.NewAxisRect(edge[0].X, edge[0].Y, edge[1].X - edge[0].X, edge[1].Y - edge[0].Y)
+	cache.graph.forEachLeaf(area, func(leaf *QuadTreeTerrain) {
+		for _, corner := range leafCorners(leaf) {
+			if !area.ContainsPoint(float64(corner.X), float64(corner.Y)) {
+				continue
+			}
+			if _, ok := seen[corner]; ok {
+				continue
+			}
+			seen[corner] = void_item
+			if len(cache.graph.GetAdjacentCorners(corner.X, corner.Y)) > 0 {
+				corners = append(corners, corner)
+			}
+		}
+	})
+	sort.Slice(corners, func(i, j int) bool {
+		return along(corners[i]) < along(corners[j])
+	})
+
+	result := []utils.IntPair{}
+	add_run := func(run []utils.IntPair) {
+		result = append(result, run[0])
+		if len(run) > 1 {
+			if along(run[len(run) - 1]) - along(run[0]) > cache.cluster_size / 4 {
+				result = append(result, run[len(run) / 2])
+			}
+			result = append(result, run[len(run) - 1])
+		}
+	}
+	run := []utils.IntPair{}
+	for _, corner := range corners {
+		if len(run) > 0 && !containsPair(cache.graph.GetAdjacentCorners(corner.X, corner.Y), run[len(run) - 1]) {
+			add_run(run)
+			run = []utils.IntPair{}
+		}
+		run = append(run, corner)
+	}
+	if len(run) > 0 {
+		add_run(run)
+	}
+	return result
+}
+
+// Dijkstra from from to each of the targets without leaving space, stops once every target has been reached
+func (cache *clusterCache) localPaths(space shapes.AxisRect, from utils.IntPair, targets []utils.IntPair) map[utils.IntPair]clusterEdge {
+	remaining := make(map[utils.IntPair]void)
+	for _, target := range targets {
+		remaining[target] = void_item
+	}
+
+	costs := map[utils.IntPair]float64{from: 0}
+	came_from := make(map[utils.IntPair]utils.IntPair)
+	closed := make(map[utils.IntPair]void)
+	result := make(map[utils.IntPair]clusterEdge)
+	open := pathHeap{}
+	heap.Push(&open, pathNode{pos: from})
+	for open.Len() > 0 && len(remaining) > 0 {
+		current := heap.Pop(&open).(pathNode).pos
+		if _, ok := closed[current]; ok {
+			continue
+		}
+		closed[current] = void_item
+		if _, ok := remaining[current]; ok {
+			delete(remaining, current)
+			result[current] = clusterEdge{cost: costs[current], path: tracePath(came_from, from, current)}
+		}
+
+		for _, next := range cache.graph.GetAdjacentCorners(current.X, current.Y) {
+			if !space.ContainsPoint(float64(next.X), float64(next.Y)) {
+				continue
+			}
+			if _, ok := closed[next]; ok {
+				continue
+			}
+			step := cache.coster.edgeCost(current, next)
+			if math.IsInf(step, 1) {
+				continue
+			}
+			cost := costs[current] + step
+			if old, seen := costs[next]; seen && old <= cost {
+				continue
+			}
+			costs[next] = cost
+			came_from[next] = current
+			heap.Push(&open, pathNode{pos: next, estimate: cost})
+		}
+	}
+	return result
+}
+
+func reversedEdge(edge clusterEdge) clusterEdge {
+	path := make([]utils.IntPair, len(edge.path))
+	for i, pos := range edge.path {
+		path[len(path) - 1 - i] = pos
+	}
+	return clusterEdge{cost: edge.cost, path: path}
+}
+
+func containsPair(pairs []utils.IntPair, pair utils.IntPair) bool {
+	for _, p := range pairs {
+		if p == pair {
+			return true
+		}
+	}
+	return false
+}
+
+// Calls fn for every cluster touching the area, clusters being nodes of the given size or leaves bigger than it
+func (tree *QuadTreeTerrain) forEachCluster(area shapes.AxisRect, size int, fn func(cluster *QuadTreeTerrain)) {
+	if !area.IntersectsAxisRect(tree.space) || tree.isOutOfBounds() {
+		return
+	}
+	if tree.leaf || tree.pixel_width <= size {
+		fn(tree)
+		return
+	}
+	for _, st := range tree.sub_trees {
+		st.forEachCluster(area, size, fn)
+	}
+}
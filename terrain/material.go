@@ -0,0 +1,126 @@
+package terrain
+
+import (
+	"image/color"
+	"math"
+)
+
+// What a terrain value actually is, the tree only stores the value and looks the rest up in its MaterialTable
+type Material struct {
+	Name string
+	Solid bool // Collision queries run into it
+	Walkable bool // Path finding can go through it
+	Cost float64 // How expensive it is to walk across compared to open ground, 1 is normal
+	Friction float64
+	Destructible bool // Carve can remove it, SetShape paints over anything regardless
+	Color color.RGBA // What DebugDrawTree2 draws it as
+}
+
+// Value 0 in a fresh table
+var EmptyMaterial = Material{Name: "empty", Walkable: true, Cost: 1, Color: color.RGBA{200, 200, 200, 255}}
+
+// Value 1 in a fresh table, and what any value without a material counts as
+var SolidMaterial = Material{Name: "solid", Solid: true, Cost: 1, Friction: 0.3, Destructible: true, Color: color.RGBA{50, 50, 50, 255}}
+
+// Maps terrain values to materials, and image colors to terrain values
+// Trees can share a table, so registering a material once is enough for all of them
+type MaterialTable struct {
+	materials map[int]Material
+	palette map[color.RGBA]int
+}
+
+// Starts with EmptyMaterial as 0 and SolidMaterial as 1, and no palette
+func NewMaterialTable() *MaterialTable {
+	table := MaterialTable{
+		materials: make(map[int]Material),
+		palette: make(map[color.RGBA]int),
+	}
+	table.materials[0] = EmptyMaterial
+	table.materials[1] = SolidMaterial
+	return &table
+}
+
+// Getters
+// Values that were never registered get SolidMaterial
+func (table MaterialTable) Get(value int) Material {
+	if material, ok := table.materials[value]; ok {
+		return material
+	}
+	return SolidMaterial
+}
+func (table MaterialTable) IsRegistered(value int) bool {
+	_, ok := table.materials[value]
+	return ok
+}
+// End getters
+
+// Replaces whatever was registered for the value before
+func (table *MaterialTable) Register(value int, material Material) {
+	table.materials[value] = material
+}
+
+func (table *MaterialTable) Unregister(value int) {
+	delete(table.materials, value)
+}
+
+// Pixels of this color load as value
+func (table *MaterialTable) SetPaletteColor(c color.Color, value int) {
+	table.palette[color.RGBAModel.Convert(c).(color.RGBA)] = value
+}
+
+// Goes back to loading black as 0 and everything else as 1
+func (table *MaterialTable) ClearPalette() {
+	table.palette = make(map[color.RGBA]int)
+}
+
+// Colors that aren't in the palette get the value of the nearest color that is, so antialiased edges still load as something sensible
+// Without a palette black is 0 and anything else is 1
+func (table MaterialTable) MaterialFromColor(c color.Color) int {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	if len(table.palette) == 0 {
+		if rgba.R > 0 || rgba.G > 0 || rgba.B > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	if value, ok := table.palette[rgba]; ok {
+		return value
+	}
+
+	best := 0
+	best_distance := -1
+	for key, value := range table.palette {
+		distance := colorDistance(rgba, key)
+		// Ties go to the lower value so the same image always loads the same way
+		if best_distance < 0 || distance < best_distance || (distance == best_distance && value < best) {
+			best = value
+			best_distance = distance
+		}
+	}
+	return best
+}
+
+func colorDistance(a, b color.RGBA) int {
+	dr := int(a.R) - int(b.R)
+	dg := int(a.G) - int(b.G)
+	db := int(a.B) - int(b.B)
+	da := int(a.A) - int(b.A)
+	return (dr * dr) + (dg * dg) + (db * db) + (da * da)
+}
+
+// Value of the padding around terrain that isn't a power of 2 square, never registered in a table
+const outOfBounds = math.MinInt
+
+var outOfBoundsMaterial = Material{Name: "out of bounds"}
+
+// Same as table.Get, but knows about the values trees use for themselves
+func materialFor(table *MaterialTable, value int) Material {
+	switch value {
+	case outOfBounds:
+		return outOfBoundsMaterial
+	case tooClose:
+		return tooCloseMaterial
+	}
+	return table.Get(value)
+}
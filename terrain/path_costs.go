@@ -0,0 +1,210 @@
+package terrain
+
+import (
+	"math"
+	"sort"
+
+	"github.com/Yarnsh/hippo/utils"
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// Per query changes to how expensive materials are to walk across, keyed by terrain value
+// Costs have to be more than 0, so hazards can be made expensive but not banned outright
+type PathCosts map[int]float64
+
+// Part of a line going through or along a walkable leaf, in fractions of the line from 0 to 1
+type costSpan struct {
+	entry float64
+	exit float64
+	cost float64
+}
+
+// Works out what it costs to walk along lines for one path finding query
+type pathCoster struct {
+	materials *MaterialTable
+	costs PathCosts
+	cheapest float64 // Lowest cost of any walkable material, keeps the heuristic from overestimating
+	spans func(seg shapes.Segment, coster pathCoster) ([]costSpan, bool) // Gathers spans from whatever is being walked on, false if the line is blocked
+	leaf func(x, y float64) *QuadTreeTerrain // Leaf with the point in it, nil where there's nothing loaded
+}
+
+func newPathCoster(materials *MaterialTable, costs PathCosts, spans func(seg shapes.Segment, coster pathCoster) ([]costSpan, bool), leaf func(x, y float64) *QuadTreeTerrain) pathCoster {
+	coster := pathCoster{materials: materials, costs: costs, spans: spans, leaf: leaf}
+	coster.cheapest = math.Inf(1)
+	for value, material := range materials.materials {
+		if material.Walkable {
+			coster.cheapest = math.Min(coster.cheapest, coster.cost(value))
+		}
+	}
+	if math.IsInf(coster.cheapest, 1) {
+		coster.cheapest = 1
+	}
+	return coster
+}
+
+// Materials with no Cost set count as 1
+func (coster pathCoster) cost(value int) float64 {
+	if cost, ok := coster.costs[value]; ok && cost > 0 {
+		return cost
+	}
+	if cost := materialFor(coster.materials, value).Cost; cost > 0 {
+		return cost
+	}
+	return 1
+}
+
+// Cost of walking straight from a to b, false if something unwalkable is in the way
+func (coster pathCoster) lineCost(a, b utils.IntPair) (float64, bool) {
+	if a == b {
+		return 0, true
+	}
+	seg := shapes.NewSegment(float64(a.X), float64(a.Y), float64(b.X), float64(b.Y))
+	spans, ok := coster.spans(seg, coster)
+	if !ok {
+		return 0, false
+	}
+	return spansCost(spans, seg.Length())
+}
+
+// Edge cost for astar, edges run along leaf edges so they cost whatever the cheaper side costs
+// Only looks up the leaves on either side instead of tracing a line through the tree, +Inf if neither side is walkable somewhere along it
+func (coster pathCoster) edgeCost(a, b utils.IntPair) float64 {
+	if a.X != b.X && a.Y != b.Y {
+		// Not along a leaf edge, astar never asks for one of these
+		if cost, ok := coster.lineCost(a, b); ok {
+			return cost
+		}
+		return math.Inf(1)
+	}
+
+	horizontal := a.Y == b.Y
+	lo, hi, across := utils.MinInt(a.Y, b.Y), utils.MaxInt(a.Y, b.Y), a.X
+	if horizontal {
+		lo, hi, across = utils.MinInt(a.X, b.X), utils.MaxInt(a.X, b.X), a.Y
+	}
+	total := 0.0
+	for pos := lo; pos < hi; {
+		// Pixel centers just either side of the edge, so it's never a question of which leaf a point on a boundary belongs to
+		next := hi
+		cheapest := math.Inf(1)
+		for _, side := range [2]float64{float64(across) - 0.5, float64(across) + 0.5} {
+			x, y := side, float64(pos) + 0.5
+			if horizontal {
+				x, y = float64(pos) + 0.5, side
+			}
+			leaf := coster.leaf(x, y)
+			if leaf == nil {
+				continue
+			}
+			if horizontal {
+				next = utils.MinInt(next, leaf.space.X2())
+			} else {
+				next = utils.MinInt(next, leaf.space.Y2())
+			}
+			if materialFor(coster.materials, leaf.leaf_value).Walkable {
+				cheapest = math.Min(cheapest, coster.cost(leaf.leaf_value))
+			}
+		}
+		if math.IsInf(cheapest, 1) {
+			return cheapest
+		}
+		total += float64(next - pos) * cheapest
+		pos = next
+	}
+	return total
+}
+
+// Straight line at the cheapest cost there is, so it never overestimates and paths stay optimal
+func (coster pathCoster) heuristic(a, b utils.IntPair) float64 {
+	return EuclidianDistance(a, b) * coster.cheapest
+}
+
+// Adds up the spans along a line of the given length, using the cheapest span wherever they overlap
+// False if part of the line isn't covered by any span
+func spansCost(spans []costSpan, length float64) (float64, bool) {
+	breaks := make([]float64, 0, (len(spans) * 2) + 2)
+	breaks = append(breaks, 0, 1)
+	for _, span := range spans {
+		breaks = append(breaks, span.entry, span.exit)
+	}
+	sort.Float64s(breaks)
+
+	total := 0.0
+	for i := 1; i < len(breaks); i++ {
+		start, end := breaks[i-1], breaks[i]
+		if end - start <= 1e-9 {
+			continue
+		}
+		middle := (start + end) / 2
+		cheapest := math.Inf(1)
+		for _, span := range spans {
+			if span.entry <= middle && span.exit >= middle {
+				cheapest = math.Min(cheapest, span.cost)
+			}
+		}
+		if math.IsInf(cheapest, 1) {
+			return 0, false
+		}
+		total += (end - start) * length * cheapest
+	}
+	return total, true
+}
+
+// Spans for every leaf the segment goes through or along, false if it goes through something unwalkable
+func (tree QuadTreeTerrain) lineSpans(seg shapes.Segment, coster pathCoster, spans []costSpan) ([]costSpan, bool) {
+	if !seg.BoundingBox().IntersectsAxisRect(tree.space) {
+		return spans, true
+	}
+	if !tree.leaf {
+		ok := true
+		for _, st := range tree.sub_trees {
+			if spans, ok = st.lineSpans(seg, coster, spans); !ok {
+				return spans, false
+			}
+		}
+		return spans, true
+	}
+
+	entry, exit, hit := seg.GetAxisRectIntersections(tree.space)
+	if !hit || exit - entry <= 1e-9 {
+		return spans, true
+	}
+	if !tree.Material(tree.leaf_value).Walkable {
+		// Running along the outside of something is fine, going through it isn't
+		return spans, !crossesAxisRect(seg, tree.space)
+	}
+	return append(spans, costSpan{entry: entry, exit: exit, cost: coster.cost(tree.leaf_value)}), true
+}
+
+// Looks at the tree through the pointer, so a coster kept across edits sees them
+func (tree *QuadTreeTerrain) pathCoster(costs PathCosts) pathCoster {
+	return newPathCoster(tree.settings.materials, costs, func(seg shapes.Segment, coster pathCoster) ([]costSpan, bool) {
+		return tree.lineSpans(seg, coster, nil)
+	}, tree.leafAt)
+}
+
+// Shared by ImprovePath and friends, whole goes through the entire path instead of stopping at the first corner it can't cut
+// A corner only gets cut if going straight past it costs no more than going around it
+func improvePath(path []utils.IntPair, coster pathCoster, whole bool) []utils.IntPair {
+	if len(path) <= 2 {
+		return path
+	}
+	for idx := 0; idx < len(path) - 2; {
+		shortcut, ok := coster.lineCost(path[idx], path[idx+2])
+		if ok {
+			// Without a cost for both legs there's nothing to hold the shortcut up against, so the corner stays
+			first, first_ok := coster.lineCost(path[idx], path[idx+1])
+			second, second_ok := coster.lineCost(path[idx+1], path[idx+2])
+			ok = first_ok && second_ok && shortcut <= first + second + 1e-9
+		}
+		if ok {
+			// we can skip straight to idx+2, so remove idx+1 from the path
+			path = append(path[:idx+1], path[idx+2:]...)
+		} else if whole {
+			idx += 1
+		} else {
+			return path
+		}
+	}
+	return path
+}
@@ -0,0 +1,65 @@
+package terrain
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+)
+
+// Edges only look at the leaves either side of them, which has to come out the same as tracing the edge through the tree
+func TestEdgeCostMatchesLineCost(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := NewQuadTreeTerrain(0, 0, 128)
+	tree.MaterialTable().Register(2, Material{Name: "mud", Walkable: true, Cost: 3})
+	tree.MaterialTable().Register(3, Material{Name: "road", Walkable: true, Cost: 0.5})
+	for i := 0; i < 80; i++ {
+		tree.SetShape(shapes.NewAxisRect(r.Intn(128), r.Intn(128), 1 + r.Intn(20), 1 + r.Intn(20)), r.Intn(4))
+	}
+
+	coster := tree.pathCoster(PathCosts{2: 5})
+	for y := 0; y <= 128; y++ {
+		for x := 0; x <= 128; x++ {
+			a := utils.IntPair{X: x, Y: y}
+			for _, b := range tree.GetAdjacentCorners(x, y) {
+				want, ok := coster.lineCost(a, b)
+				got := coster.edgeCost(a, b)
+				if !ok && !math.IsInf(got, 1) {
+					t.Fatalf("%v to %v is blocked but costs %v", a, b, got)
+				}
+				if ok && math.Abs(got - want) > 1e-9 {
+					t.Fatalf("%v to %v costs %v, tracing it costs %v", a, b, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEdgeCostThroughAWallIsInfinite(t *testing.T) {
+	tree := NewQuadTreeTerrain(0, 0, 64)
+	tree.SetShape(shapes.NewAxisRect(16, 16, 32, 32), 1)
+	coster := tree.pathCoster(nil)
+	// Along the middle of the wall, neither side is walkable
+	if cost := coster.edgeCost(utils.IntPair{X: 32, Y: 16}, utils.IntPair{X: 32, Y: 48}); !math.IsInf(cost, 1) {
+		t.Errorf("expected +Inf, got %v", cost)
+	}
+	// Along its outside only one side has to be walkable
+	if cost := coster.edgeCost(utils.IntPair{X: 16, Y: 16}, utils.IntPair{X: 16, Y: 48}); cost != 32 {
+		t.Errorf("expected 32, got %v", cost)
+	}
+}
+
+func TestImprovePathKeepsCornersItCantCost(t *testing.T) {
+	tree := NewQuadTreeTerrain(0, 0, 64)
+	// Sits between a and b, but not between either of them and c
+	tree.SetShape(shapes.NewAxisRect(20, 20, 4, 4), 1)
+	a, b, c := utils.IntPair{X: 32, Y: 32}, utils.IntPair{X: 12, Y: 12}, utils.IntPair{X: 42, Y: 32}
+	if _, ok := tree.pathCoster(nil).lineCost(a, b); ok {
+		t.Fatalf("the wall should be in the way of the first leg")
+	}
+	if path := tree.ImprovePath([]utils.IntPair{a, b, c}); len(path) != 3 {
+		t.Errorf("cut a corner with a leg that can't be walked, got %v", path)
+	}
+}
@@ -0,0 +1,158 @@
+package terrain
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/Yarnsh/hippo/utils"
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// Anything made of leaf corners that can be searched for paths, QuadTreeTerrain and TerrainWorld both are
+type pathGraph interface {
+	GetClosestCorner(x, y float64) (bool, int, int)
+	GetAdjacentCorners(x, y int) []utils.IntPair
+}
+
+// A* over leaf corners that can stop and pick up where it left off
+type aStar struct {
+	graph pathGraph
+	coster pathCoster
+	start, end utils.IntPair
+	failed bool
+	found bool
+
+	open pathHeap
+	costs map[utils.IntPair]float64
+	came_from map[utils.IntPair]utils.IntPair
+	closed map[utils.IntPair]void
+	explored shapes.AxisRect // Covers every node looked at so far, edits outside it can't change the result
+}
+
+// s and e get moved to their closest corners the same way FindPath always has
+func newAStar(graph pathGraph, coster pathCoster, s, e utils.IntPair) *aStar {
+	search := &aStar{graph: graph, coster: coster}
+
+	// check if end is inside unwalkable terrain to save a lot of time
+	s_inside, sx, sy := graph.GetClosestCorner(float64(s.X), float64(s.Y))
+	e_inside, ex, ey := graph.GetClosestCorner(float64(e.X), float64(e.Y))
+	if !s_inside || !e_inside || len(graph.GetAdjacentCorners(ex, ey)) <= 0 {
+		search.failed = true
+		return search
+	}
+	search.start = utils.IntPair{X: sx, Y: sy}
+	search.end = utils.IntPair{X: ex, Y: ey}
+
+	search.costs = map[utils.IntPair]float64{search.start: 0}
+	search.came_from = make(map[utils.IntPair]utils.IntPair)
+	search.closed = make(map[utils.IntPair]void)
+	search.explored = shapes.NewAxisRect(sx, sy, 0, 0)
+	heap.Push(&search.open, pathNode{pos: search.start, estimate: coster.heuristic(search.start, search.end)})
+	return search
+}
+
+// Expands up to count nodes, true once the search is over one way or another
+func (search *aStar) step(count int) bool {
+	if search.failed || search.found {
+		return true
+	}
+
+	for i := 0; i < count; i++ {
+		if search.open.Len() == 0 {
+			// No way through
+			search.failed = true
+			return true
+		}
+		current := heap.Pop(&search.open).(pathNode).pos
+		if _, closed := search.closed[current]; closed {
+			continue
+		}
+		if current == search.end {
+			search.found = true
+			return true
+		}
+		search.closed[current] = void_item
+
+		for _, next := range search.graph.GetAdjacentCorners(current.X, current.Y) {
+			if _, closed := search.closed[next]; closed {
+				continue
+			}
+			step := search.coster.edgeCost(current, next)
+			if math.IsInf(step, 1) {
+				continue
+			}
+			cost := search.costs[current] + step
+			if old, seen := search.costs[next]; seen && old <= cost {
+				continue
+			}
+			search.costs[next] = cost
+			search.came_from[next] = current
+			search.explored = search.explored.Union(shapes.NewAxisRect(next.X, next.Y, 0, 0))
+			heap.Push(&search.open, pathNode{pos: next, estimate: cost + search.coster.heuristic(next, search.end)})
+		}
+	}
+	return false
+}
+
+// Runs the whole search in one go
+func (search *aStar) finish() []utils.IntPair {
+	for !search.step(1 << 16) {
+	}
+	return search.result()
+}
+
+// Empty if there's no path, and the start and end show up twice like FindPath has always done
+func (search *aStar) result() []utils.IntPair {
+	if !search.found {
+		return []utils.IntPair{}
+	}
+	return pathWithEnds(tracePath(search.came_from, search.start, search.end))
+}
+
+// The corners from from to to, following came_from back from to
+func tracePath(came_from map[utils.IntPair]utils.IntPair, from, to utils.IntPair) []utils.IntPair {
+	path := []utils.IntPair{to}
+	for pos := to; pos != from; {
+		pos = came_from[pos]
+		path = append(path, pos)
+	}
+	for i, j := 0, len(path) - 1; i < j; i, j = i + 1, j - 1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Puts the first and last corners on again at each end, which is the layout every FindPath gives back
+func pathWithEnds(corners []utils.IntPair) []utils.IntPair {
+	path := make([]utils.IntPair, 0, len(corners) + 2)
+	path = append(path, corners[0])
+	path = append(path, corners...)
+	return append(path, corners[len(corners) - 1])
+}
+
+type pathNode struct {
+	pos utils.IntPair
+	estimate float64 // Cost so far plus the heuristic
+}
+
+// Open list for aStar, cheapest estimate first
+type pathHeap []pathNode
+
+func (h pathHeap) Len() int {
+	return len(h)
+}
+func (h pathHeap) Less(i, j int) bool {
+	return h[i].estimate < h[j].estimate
+}
+func (h pathHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+func (h *pathHeap) Push(x any) {
+	*h = append(*h, x.(pathNode))
+}
+func (h *pathHeap) Pop() any {
+	old := *h
+	last := old[len(old) - 1]
+	*h = old[:len(old) - 1]
+	return last
+}
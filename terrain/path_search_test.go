@@ -0,0 +1,145 @@
+package terrain
+
+import (
+	"container/heap"
+	"math"
+	"testing"
+
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+)
+
+// Plain Dijkstra over every corner, costing each step by tracing it through the tree instead of edgeCost
+// Gives back the cheapest cost from s to e after moving them to their closest corners, false if there's no way
+func referenceCost(tree *QuadTreeTerrain, s, e utils.IntPair, costs PathCosts) (float64, bool) {
+	s_inside, sx, sy := tree.GetClosestCorner(float64(s.X), float64(s.Y))
+	e_inside, ex, ey := tree.GetClosestCorner(float64(e.X), float64(e.Y))
+	if !s_inside || !e_inside {
+		return 0, false
+	}
+	s = utils.IntPair{X: sx, Y: sy}
+	e = utils.IntPair{X: ex, Y: ey}
+	if len(tree.GetAdjacentCorners(e.X, e.Y)) <= 0 {
+		return 0, false
+	}
+
+	coster := tree.pathCoster(costs)
+	best := map[utils.IntPair]float64{s: 0}
+	open := pathHeap{}
+	heap.Push(&open, pathNode{pos: s})
+	for open.Len() > 0 {
+		node := heap.Pop(&open).(pathNode)
+		if node.pos == e {
+			return node.estimate, true
+		}
+		if node.estimate > best[node.pos] {
+			continue
+		}
+		for _, next := range tree.GetAdjacentCorners(node.pos.X, node.pos.Y) {
+			step, ok := coster.lineCost(node.pos, next)
+			if !ok {
+				continue
+			}
+			if old, seen := best[next]; !seen || node.estimate + step < old {
+				best[next] = node.estimate + step
+				heap.Push(&open, pathNode{pos: next, estimate: node.estimate + step})
+			}
+		}
+	}
+	return 0, false
+}
+
+// Sum of the steps traced through the tree, skipping the repeated corners at each end
+func pathCostOf(tree *QuadTreeTerrain, path []utils.IntPair, costs PathCosts) (float64, bool) {
+	coster := tree.pathCoster(costs)
+	total := 0.0
+	for i := 2; i < len(path) - 1; i++ {
+		step, ok := coster.lineCost(path[i - 1], path[i])
+		if !ok {
+			return 0, false
+		}
+		total += step
+	}
+	return total, true
+}
+
+func TestFindPathMatchesReference(t *testing.T) {
+	table := NewMaterialTable()
+	table.Register(2, Material{Name: "mud", Walkable: true, Cost: 4})
+
+	open_field := func() *QuadTreeTerrain {
+		tree := NewQuadTreeTerrain(0, 0, 64)
+		tree.SetShape(shapes.NewAxisRect(20, 20, 16, 16), 1)
+		return tree
+	}
+	// Two blocks that only meet at a corner, with the way through being the diagonal between them
+	diagonal_corners := func() *QuadTreeTerrain {
+		tree := NewQuadTreeTerrain(0, 0, 64)
+		tree.SetShape(shapes.NewAxisRect(16, 16, 16, 16), 1)
+		tree.SetShape(shapes.NewAxisRect(32, 32, 16, 16), 1)
+		return tree
+	}
+	// A mud strip across the middle with a gap at one end, cheaper to go around unless the costs say otherwise
+	mud := func() *QuadTreeTerrain {
+		tree := NewQuadTreeTerrain(0, 0, 64)
+		tree.SetMaterialTable(table)
+		tree.SetShape(shapes.NewAxisRect(0, 24, 48, 16), 2)
+		return tree
+	}
+	// Lots of small blocks so there are plenty of routes that nearly tie
+	pillars := func() *QuadTreeTerrain {
+		tree := NewQuadTreeTerrain(0, 0, 128)
+		for i := 0; i < 12; i++ {
+			tree.SetShape(shapes.NewAxisRect(8 + (i * 37) % 104, 8 + (i * 53) % 104, 6 + i % 4 * 3, 5 + i % 3 * 4), 1)
+		}
+		return tree
+	}
+	// The end is inside a closed ring of wall
+	walled_in := func() *QuadTreeTerrain {
+		tree := NewQuadTreeTerrain(0, 0, 64)
+		tree.SetShape(shapes.NewAxisRect(32, 32, 24, 24), 1)
+		tree.SetShape(shapes.NewAxisRect(36, 36, 16, 16), 0)
+		return tree
+	}
+
+	cases := []struct {
+		name string
+		tree *QuadTreeTerrain
+		s, e utils.IntPair
+		costs PathCosts
+		reachable bool
+	}{
+		{"straight", open_field(), utils.IntPair{X: 2, Y: 2}, utils.IntPair{X: 60, Y: 2}, nil, true},
+		{"around a block", open_field(), utils.IntPair{X: 10, Y: 10}, utils.IntPair{X: 50, Y: 50}, nil, true},
+		{"past diagonal corners", diagonal_corners(), utils.IntPair{X: 48, Y: 16}, utils.IntPair{X: 16, Y: 48}, nil, true},
+		{"corner to corner", diagonal_corners(), utils.IntPair{X: 2, Y: 2}, utils.IntPair{X: 62, Y: 62}, nil, true},
+		{"through mud", mud(), utils.IntPair{X: 30, Y: 4}, utils.IntPair{X: 30, Y: 60}, nil, true},
+		{"through cheap mud", mud(), utils.IntPair{X: 30, Y: 4}, utils.IntPair{X: 30, Y: 60}, PathCosts{2: 0.5}, true},
+		{"between pillars", pillars(), utils.IntPair{X: 1, Y: 1}, utils.IntPair{X: 127, Y: 127}, nil, true},
+		{"across pillars", pillars(), utils.IntPair{X: 120, Y: 3}, utils.IntPair{X: 5, Y: 122}, nil, true},
+		{"walled in", walled_in(), utils.IntPair{X: 4, Y: 4}, utils.IntPair{X: 44, Y: 44}, nil, false},
+		{"end in a wall", walled_in(), utils.IntPair{X: 4, Y: 4}, utils.IntPair{X: 33, Y: 45}, nil, false},
+		{"start out of bounds", open_field(), utils.IntPair{X: -10, Y: 4}, utils.IntPair{X: 4, Y: 4}, nil, false},
+	}
+
+	for _, c := range cases {
+		got := c.tree.FindPathWithCosts(c.s, c.e, c.costs)
+		want, want_ok := referenceCost(c.tree, c.s, c.e, c.costs)
+		if (len(got) > 0) != c.reachable || want_ok != c.reachable {
+			t.Errorf("%s: expected reachable %v, got %d corners and the reference says %v", c.name, c.reachable, len(got), want_ok)
+			continue
+		}
+		if !c.reachable {
+			continue
+		}
+		if got[0] != got[1] || got[len(got) - 1] != got[len(got) - 2] {
+			t.Errorf("%s: start and end should show up twice, got %v", c.name, got)
+		}
+		got_cost, ok := pathCostOf(c.tree, got, c.costs)
+		if !ok {
+			t.Errorf("%s: path %v goes through something unwalkable", c.name, got)
+		} else if math.Abs(got_cost - want) > 1e-9 {
+			t.Errorf("%s: cost %v but the cheapest way costs %v", c.name, got_cost, want)
+		}
+	}
+}
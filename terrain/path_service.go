@@ -0,0 +1,243 @@
+package terrain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Yarnsh/hippo/utils"
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+type PathStatus int
+
+const (
+	PathPending PathStatus = iota
+	PathDone
+	PathFailed // There's no way through
+	PathCancelled
+)
+
+// Everything FindPathForAgentWithCosts takes
+// A zero Agent finds paths for a point, and nil Costs uses the material table's costs
+type PathRequest struct {
+	Start utils.IntPair
+	End utils.IntPair
+	Agent AgentSize
+	Costs PathCosts
+}
+
+// What PathService.Request gives back, check on it after each Update or wait on Done
+type PathHandle struct {
+	search *pathSearch
+	status PathStatus
+	path []utils.IntPair
+	done chan struct{}
+}
+
+// Getters
+func (handle PathHandle) Status() PathStatus {
+	return handle.status
+}
+// Same as what FindPathForAgentWithCosts would have returned, nil until the status is PathDone or PathFailed
+func (handle PathHandle) Path() []utils.IntPair {
+	return handle.path
+}
+// Closed once the handle is no longer pending
+func (handle PathHandle) Done() <-chan struct{} {
+	return handle.done
+}
+// End getters
+
+// Stops waiting for the path, the search itself keeps going if anyone else asked for the same path
+func (handle *PathHandle) Cancel() {
+	if handle.status != PathPending {
+		return
+	}
+	handle.status = PathCancelled
+	close(handle.done)
+	handle.search.removeHandle(handle)
+}
+
+// Runs path finding a bit at a time across frames so long searches don't cause hitches
+// Identical requests that are waiting at the same time share one search
+// Everything happens inside Update, so it should only be used from the game loop
+type PathService struct {
+	tree *QuadTreeTerrain
+	queue []*pathSearch
+	searches map[string]*pathSearch
+	subscriber int
+}
+
+// Checking the clock is slow enough that we only do it every so often
+const expansionsPerClockCheck = 32
+
+// The service watches the terrain for edits, call Close when done with it
+func NewPathService(tree *QuadTreeTerrain) *PathService {
+	service := &PathService{
+		tree: tree,
+		searches: make(map[string]*pathSearch),
+	}
+	service.subscriber = tree.Subscribe(service.terrainChanged)
+	return service
+}
+
+// Getters
+// Searches that haven't finished yet
+func (service PathService) Pending() int {
+	return len(service.queue)
+}
+// End getters
+
+func (service *PathService) Request(request PathRequest) *PathHandle {
+	// Our own copy, so changing the map after asking doesn't change the search
+	if request.Costs != nil {
+		costs := make(PathCosts, len(request.Costs))
+		for value, cost := range request.Costs {
+			costs[value] = cost
+		}
+		request.Costs = costs
+	}
+
+	key := request.key()
+	search, ok := service.searches[key]
+	if !ok {
+		search = &pathSearch{service: service, key: key, request: request}
+		service.searches[key] = search
+		service.queue = append(service.queue, search)
+	}
+	handle := &PathHandle{search: search, status: PathPending, done: make(chan struct{})}
+	search.handles = append(search.handles, handle)
+	return handle
+}
+
+// Works through the queue oldest first until it runs out of requests or the budget runs out
+func (service *PathService) Update(budget time.Duration) {
+	deadline := time.Now().Add(budget)
+	for len(service.queue) > 0 {
+		search := service.queue[0]
+		if search.run(expansionsPerClockCheck) {
+			service.finish(search)
+		}
+		if !time.Now().Before(deadline) {
+			return
+		}
+	}
+}
+
+// Cancels everything still waiting and stops watching the terrain
+func (service *PathService) Close() {
+	for len(service.queue) > 0 {
+		search := service.queue[0]
+		for len(search.handles) > 0 {
+			search.handles[0].Cancel()
+		}
+	}
+	service.tree.Unsubscribe(service.subscriber)
+}
+
+func (service *PathService) finish(search *pathSearch) {
+	for i, queued := range service.queue {
+		if queued == search {
+			service.queue = append(service.queue[:i], service.queue[i+1:]...)
+			break
+		}
+	}
+	delete(service.searches, search.key)
+
+	for _, handle := range search.handles {
+		handle.status = search.status
+		if search.path != nil {
+			handle.path = append([]utils.IntPair{}, search.path...)
+		}
+		close(handle.done)
+	}
+	search.handles = nil
+}
+
+// Searches that have already looked at the changed area start over, the rest carry on
+func (service *PathService) terrainChanged(region shapes.AxisRect) {
+	for _, search := range service.queue {
+		if !search.started {
+			continue
+		}
+		reach := search.request.Agent.reach()
+		if growAxisRect(region, reach, reach).IntersectsAxisRect(search.search.explored) {
+			search.started = false
+		}
+	}
+}
+
+// So identical requests end up with the same key
+func (request PathRequest) key() string {
+	return fmt.Sprintf("%d,%d>%d,%d|", request.Start.X, request.Start.Y, request.End.X, request.End.Y) + agentCostsKey(request.Agent, request.Costs)
+}
+
+// Same for any two queries with the same agent size and the same costs
+func agentCostsKey(agent AgentSize, costs PathCosts) string {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%v,%v,%v|", agent.Radius, agent.HalfWidth, agent.HalfHeight)
+	values := make([]int, 0, len(costs))
+	for value := range costs {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+	for _, value := range values {
+		fmt.Fprintf(&key, "%d=%v,", value, costs[value])
+	}
+	return key.String()
+}
+
+// One queued request and everyone waiting on it
+type pathSearch struct {
+	service *PathService
+	key string
+	request PathRequest
+	handles []*PathHandle
+
+	started bool
+	graph *QuadTreeTerrain // The tree, or its grown copy for agents with a size
+	search *aStar
+
+	status PathStatus
+	path []utils.IntPair
+}
+
+func (search *pathSearch) removeHandle(handle *PathHandle) {
+	for i, h := range search.handles {
+		if h == handle {
+			search.handles = append(search.handles[:i], search.handles[i+1:]...)
+			break
+		}
+	}
+	if len(search.handles) == 0 {
+		search.status = PathCancelled
+		search.service.finish(search)
+	}
+}
+
+// Expands up to count nodes, true once the search is over one way or another
+// Searches the live tree rather than a copy, so edits show up in the rest of the search and terrainChanged restarts it if they land somewhere it already looked
+func (search *pathSearch) run(count int) bool {
+	graph := search.service.tree
+	if !search.request.Agent.IsPoint() {
+		// Patches any edits into the grown copy, which is a new one after ForgetAgentSizes
+		graph = search.service.tree.clearanceTree(search.request.Agent)
+	}
+	if !search.started || search.graph != graph {
+		search.started = true
+		search.graph = graph
+		search.search = newAStar(graph, graph.pathCoster(search.request.Costs), search.request.Start, search.request.End)
+	}
+
+	if !search.search.step(count) {
+		return false
+	}
+	search.path = search.search.result()
+	search.status = PathDone
+	if len(search.path) == 0 {
+		search.status = PathFailed
+	}
+	return true
+}
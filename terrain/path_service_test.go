@@ -0,0 +1,183 @@
+package terrain
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Yarnsh/hippo/shapes"
+	"github.com/Yarnsh/hippo/utils"
+)
+
+// Rows of small blocks, so searches across it take a lot more than one batch of expansions
+func blockGrid() *QuadTreeTerrain {
+	tree := NewQuadTreeTerrain(0, 0, 128)
+	for y := 4; y < 124; y += 12 {
+		for x := 4; x < 124; x += 12 {
+			tree.SetShape(shapes.NewAxisRect(x, y, 6, 6), 1)
+		}
+	}
+	return tree
+}
+
+func isClosed(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+func samePathCost(t *testing.T, name string, tree *QuadTreeTerrain, got, want []utils.IntPair) {
+	t.Helper()
+	if len(got) == 0 || len(want) == 0 {
+		t.Fatalf("%s: expected paths, got %d corners and wanted %d", name, len(got), len(want))
+	}
+	got_cost, got_ok := pathCostOf(tree, got, nil)
+	want_cost, want_ok := pathCostOf(tree, want, nil)
+	if !got_ok || !want_ok || math.Abs(got_cost - want_cost) > 1e-9 {
+		t.Errorf("%s: path costs %v but FindPath's costs %v", name, got_cost, want_cost)
+	}
+}
+
+func TestPathServiceSharesIdenticalRequests(t *testing.T) {
+	tree := blockGrid()
+	service := NewPathService(tree)
+	defer service.Close()
+
+	request := PathRequest{Start: utils.IntPair{X: 1, Y: 1}, End: utils.IntPair{X: 126, Y: 126}, Costs: PathCosts{1: 2}}
+	first := service.Request(request)
+	// Changing the caller's map afterwards doesn't make it a different request
+	request.Costs[1] = 2
+	second := service.Request(request)
+	other := service.Request(PathRequest{Start: utils.IntPair{X: 1, Y: 1}, End: utils.IntPair{X: 126, Y: 2}})
+	if first.search != second.search || first.search == other.search {
+		t.Fatalf("identical requests should share a search and different ones shouldn't")
+	}
+	if service.Pending() != 2 {
+		t.Fatalf("expected 2 searches, got %d", service.Pending())
+	}
+
+	service.Update(time.Second)
+	for _, handle := range []*PathHandle{first, second, other} {
+		if handle.Status() != PathDone || !isClosed(handle.Done()) {
+			t.Fatalf("expected every handle done, got status %v", handle.Status())
+		}
+	}
+	samePathCost(t, "shared", tree, first.Path(), tree.FindPath(request.Start, request.End))
+	// Each handle gets its own copy of the path
+	first.Path()[0] = utils.IntPair{X: -1, Y: -1}
+	if second.Path()[0] == first.Path()[0] {
+		t.Errorf("handles share the same path slice")
+	}
+}
+
+func TestPathServiceCancel(t *testing.T) {
+	tree := blockGrid()
+	service := NewPathService(tree)
+	defer service.Close()
+
+	request := PathRequest{Start: utils.IntPair{X: 1, Y: 1}, End: utils.IntPair{X: 126, Y: 126}}
+	first := service.Request(request)
+	second := service.Request(request)
+	lonely := service.Request(PathRequest{Start: utils.IntPair{X: 126, Y: 1}, End: utils.IntPair{X: 1, Y: 126}})
+
+	// Cancelling one of two shared handles leaves the search going for the other
+	first.Cancel()
+	if first.Status() != PathCancelled || !isClosed(first.Done()) || first.Path() != nil {
+		t.Errorf("cancelled handle should be closed with no path, got status %v", first.Status())
+	}
+	if service.Pending() != 2 {
+		t.Errorf("shared search should still be queued, got %d pending", service.Pending())
+	}
+
+	// Cancelling the only handle drops the search
+	lonely.Cancel()
+	if service.Pending() != 1 {
+		t.Errorf("search with no one waiting should be dropped, got %d pending", service.Pending())
+	}
+	lonely.Cancel()
+
+	service.Update(time.Second)
+	if second.Status() != PathDone || len(second.Path()) == 0 {
+		t.Errorf("remaining handle should get its path, got status %v", second.Status())
+	}
+	if first.Status() != PathCancelled || first.Path() != nil {
+		t.Errorf("cancelled handle changed after the search finished, got status %v", first.Status())
+	}
+	// Too late to cancel once it's done
+	second.Cancel()
+	if second.Status() != PathDone {
+		t.Errorf("cancelling a finished handle changed its status to %v", second.Status())
+	}
+}
+
+func TestPathServiceSpreadsSearchesOverUpdates(t *testing.T) {
+	tree := blockGrid()
+	service := NewPathService(tree)
+	defer service.Close()
+
+	request := PathRequest{Start: utils.IntPair{X: 1, Y: 1}, End: utils.IntPair{X: 126, Y: 126}}
+	handle := service.Request(request)
+	// A budget that's already run out still does one batch of expansions each time
+	updates := 0
+	for handle.Status() == PathPending {
+		service.Update(0)
+		updates += 1
+		if updates > 10000 {
+			t.Fatalf("search never finished")
+		}
+	}
+	if updates < 2 {
+		t.Errorf("expected the search to take several updates, took %d", updates)
+	}
+	if handle.Status() != PathDone {
+		t.Fatalf("expected a path, got status %v", handle.Status())
+	}
+	samePathCost(t, "budgeted", tree, handle.Path(), tree.FindPath(request.Start, request.End))
+}
+
+func TestPathServiceRestartsAfterEdits(t *testing.T) {
+	tree := blockGrid()
+	service := NewPathService(tree)
+	defer service.Close()
+
+	request := PathRequest{Start: utils.IntPair{X: 1, Y: 1}, End: utils.IntPair{X: 126, Y: 126}}
+	handle := service.Request(request)
+	service.Update(0)
+	if !handle.search.started || handle.Status() != PathPending {
+		t.Fatalf("search should be part way through")
+	}
+
+	// Nowhere near what it's looked at so far, the search carries on
+	tree.SetShape(shapes.NewAxisRect(60, 120, 2, 2), 1)
+	if !handle.search.started {
+		t.Errorf("edit away from the search restarted it")
+	}
+
+	// A wall right across where it's been, with a gap at the right end
+	tree.SetShape(shapes.NewAxisRect(0, 10, 120, 2), 1)
+	if handle.search.started {
+		t.Errorf("edit where the search has looked didn't restart it")
+	}
+	for handle.Status() == PathPending {
+		service.Update(0)
+	}
+	samePathCost(t, "after the edit", tree, handle.Path(), tree.FindPath(request.Start, request.End))
+
+	// Agents search a grown copy, edits have to get patched into it as well
+	agent := CircleAgent(2)
+	sized := service.Request(PathRequest{Start: request.Start, End: request.End, Agent: agent})
+	service.Update(0)
+	tree.SetShape(shapes.NewAxisRect(0, 10, 120, 2), 0)
+	for sized.Status() == PathPending {
+		service.Update(0)
+	}
+	want := tree.FindPathForAgent(request.Start, request.End, agent)
+	got_cost, _ := pathCostOf(tree.clearanceTree(agent), sized.Path(), nil)
+	want_cost, _ := pathCostOf(tree.clearanceTree(agent), want, nil)
+	if len(sized.Path()) == 0 || math.Abs(got_cost - want_cost) > 1e-9 {
+		t.Errorf("agent path costs %v but FindPathForAgent's costs %v", got_cost, want_cost)
+	}
+}
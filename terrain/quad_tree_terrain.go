@@ -3,10 +3,10 @@ package terrain
 import (
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"image"
 	"image/color"
 	"math"
 
-	"github.com/fzipp/astar"
 	"github.com/Yarnsh/hippo/utils"
 	"github.com/Yarnsh/hippo/shapes"
 )
@@ -24,33 +24,200 @@ type QuadTreeTerrain struct {
 	leaf_value int
 	sub_trees [4]*QuadTreeTerrain
 	pixel_x, pixel_y, pixel_width int
+	settings *terrainSettings
+}
+
+// Called for every solid material a filtered query runs into, return false to pass through it
+type MaterialFilterCallback func(filter shapes.Filter, value int) bool
+
+// Shared by every node of a tree, so changes made on the root reach sub trees made by Split
+type terrainSettings struct {
+	bounds shapes.AxisRect // The real size of the terrain, the root can be bigger than this
+	materials *MaterialTable
+	material_filters map[int]shapes.Filter
+	filter_callback MaterialFilterCallback
 
-	dirty bool
+	dirty_regions []shapes.AxisRect
+	subscribers []dirtySubscriber
+	next_subscriber int
+
+	clearance map[AgentSize]*clearanceMap // Grown copies of the tree for path finding with big agents
+	clearance_subscriber int
 }
 
-// Quad tree terrain should be square, hence only width
-// They should also be powers of 2 in size, should maybe fix that
+// Square terrain, see NewQuadTreeTerrainRect
 func NewQuadTreeTerrain(x int, y int, w int) *QuadTreeTerrain {
+	return NewQuadTreeTerrainRect(x, y, w, w)
+}
+
+// Terrain of any size, like a 1920x1080 level image
+// Quad trees split evenly down to single pixels, so the root gets padded out to a power of 2 square
+// The padding is out of bounds, it never collides, can't be walked on and can't be painted
+func NewQuadTreeTerrainRect(x int, y int, w int, h int) *QuadTreeTerrain {
+	size := 1
+	for size < utils.MaxInt(w, h) {
+		size *= 2
+	}
+
+	settings := &terrainSettings{
+		bounds: shapes.NewAxisRect(x, y, w, h),
+		materials: NewMaterialTable(),
+		material_filters: make(map[int]shapes.Filter),
+	}
+	tree := newQuadTreeNode(x, y, size, settings)
+	tree.fitBounds()
+	return tree
+}
+
+func newQuadTreeNode(x int, y int, w int, settings *terrainSettings) *QuadTreeTerrain {
 	tree := QuadTreeTerrain{}
 	tree.pixel_x = x
 	tree.pixel_y = y
 	tree.pixel_width = w
 	tree.space = shapes.NewAxisRect(x, y, w, w)
 	tree.leaf = true
-	tree.dirty = false
+	tree.settings = settings
 
 	return &tree
 }
 
-func (tree QuadTreeTerrain) materialFromColor(color color.Color) int {
-	r,g,b,_ := color.RGBA()
-	if r > 0 || g > 0 || b > 0 {
-		return 1
+// Getters
+// The real area of the terrain, not counting the padding
+func (tree QuadTreeTerrain) Bounds() shapes.AxisRect {
+	return tree.settings.bounds
+}
+// End getters
+
+// Splits until every leaf is either completely inside the bounds or completely outside them
+func (tree *QuadTreeTerrain) fitBounds() {
+	if tree.insideBounds() {
+		tree.leaf_value = 0
+		return
+	}
+	if tree.outsideBounds() || !tree.Split() {
+		tree.leaf_value = outOfBounds
+		return
+	}
+	for _, st := range tree.sub_trees {
+		st.fitBounds()
+	}
+}
+
+func (tree QuadTreeTerrain) insideBounds() bool {
+	return tree.settings.bounds.EnclosesAxisRect(tree.space)
+}
+
+func (tree QuadTreeTerrain) outsideBounds() bool {
+	bounds := tree.settings.bounds
+	return tree.space.X() >= bounds.X2() || tree.space.X2() <= bounds.X() || tree.space.Y() >= bounds.Y2() || tree.space.Y2() <= bounds.Y()
+}
+
+func (tree QuadTreeTerrain) isOutOfBounds() bool {
+	return tree.leaf && tree.leaf_value == outOfBounds
+}
+
+// Swap in a table shared with other trees, or one set up ahead of time
+func (tree *QuadTreeTerrain) SetMaterialTable(table *MaterialTable) {
+	tree.settings.materials = table
+}
+
+func (tree QuadTreeTerrain) MaterialTable() *MaterialTable {
+	return tree.settings.materials
+}
+
+func (tree QuadTreeTerrain) Material(value int) Material {
+	return materialFor(tree.settings.materials, value)
+}
+
+// Value of the leaf containing the point, false if the point is outside the tree
+func (tree QuadTreeTerrain) ValueAt(x, y float64) (int, bool) {
+	if !tree.space.ContainsPoint(x, y) {
+		return 0, false
+	}
+	if tree.isOutOfBounds() {
+		return 0, false
+	}
+	if tree.leaf {
+		return tree.leaf_value, true
+	}
+	for _, st := range tree.sub_trees {
+		if value, ok := st.ValueAt(x, y); ok {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// Leaf containing the point, nil if the point is outside the tree
+func (tree *QuadTreeTerrain) leafAt(x, y float64) *QuadTreeTerrain {
+	if !tree.space.ContainsPoint(x, y) || tree.isOutOfBounds() {
+		return nil
+	}
+	if tree.leaf {
+		return tree
+	}
+	for _, st := range tree.sub_trees {
+		if leaf := st.leafAt(x, y); leaf != nil {
+			return leaf
+		}
+	}
+	return nil
+}
+
+// Material at the point, for things like friction under a character's feet
+func (tree QuadTreeTerrain) MaterialAt(x, y float64) (Material, bool) {
+	value, ok := tree.ValueAt(x, y)
+	if !ok {
+		return Material{}, false
 	}
-	return 0
+	return tree.Material(value), true
 }
 
+// Collision filter for a material value, materials without one use shapes.DefaultFilter
+// Materials that aren't solid never collide whatever their filter is
+func (tree *QuadTreeTerrain) SetMaterialFilter(value int, filter shapes.Filter) {
+	tree.settings.material_filters[value] = filter
+}
+
+func (tree QuadTreeTerrain) MaterialFilter(value int) shapes.Filter {
+	if filter, ok := tree.settings.material_filters[value]; ok {
+		return filter
+	}
+	return shapes.DefaultFilter
+}
+
+// nil removes the callback
+func (tree *QuadTreeTerrain) SetMaterialFilterCallback(callback MaterialFilterCallback) {
+	tree.settings.filter_callback = callback
+}
+
+// Whether a query with the given filter should collide with this material
+func (tree QuadTreeTerrain) collidesWith(filter shapes.Filter, value int) bool {
+	if !tree.Material(value).Solid {
+		return false
+	}
+	if !filter.ShouldCollide(tree.MaterialFilter(value)) {
+		return false
+	}
+	if tree.settings.filter_callback != nil && !tree.settings.filter_callback(filter, value) {
+		return false
+	}
+	return true
+}
+
+// Overwrites the whole tree with the image, the whole area gets marked dirty
+// Colors are turned into values by the material table's palette
 func (tree *QuadTreeTerrain) LoadImageData(image *ebiten.Image) {
+	tree.LoadImage(image)
+}
+
+// Same as LoadImageData, but for images that were never uploaded to the GPU, like ones decoded straight from a file
+func (tree *QuadTreeTerrain) LoadImage(img image.Image) {
+	tree.loadImageData(img)
+	tree.markDirty(tree.settings.bounds)
+}
+
+func (tree *QuadTreeTerrain) loadImageData(image image.Image) {
 	if !tree.leaf { // We are overwriting everything anyway so just collapse it down
 		tree.Join()
 	}
@@ -58,17 +225,15 @@ func (tree *QuadTreeTerrain) LoadImageData(image *ebiten.Image) {
 	startx := tree.pixel_x
 	starty := tree.pixel_y
 
-	color := image.At(startx, starty)
-	value := tree.materialFromColor(color)
+	value := tree.valueFromImage(image, startx, starty)
 	for y := starty; y < starty + tree.pixel_width; y++ {
 		for x := startx; x < startx + tree.pixel_width; x++ {
-			color = image.At(x, y)
-			val_new := tree.materialFromColor(color)
+			val_new := tree.valueFromImage(image, x, y)
 
 			if val_new != value { // We can't paint this tree all one color so we must split
 				tree.Split()
 				for _, sub_tree := range tree.sub_trees {
-					sub_tree.LoadImageData(image)
+					sub_tree.loadImageData(image)
 				}
 				return // Sub trees will end up painting whatever they need so we can just exit out
 			}
@@ -78,6 +243,15 @@ func (tree *QuadTreeTerrain) LoadImageData(image *ebiten.Image) {
 	tree.leaf_value = value
 }
 
+// Pixels in the padding stay out of bounds whatever the image has there
+func (tree QuadTreeTerrain) valueFromImage(image image.Image, x, y int) int {
+	bounds := tree.settings.bounds
+	if x < bounds.X() || x >= bounds.X2() || y < bounds.Y() || y >= bounds.Y2() {
+		return outOfBounds
+	}
+	return tree.settings.materials.MaterialFromColor(image.At(x, y))
+}
+
 // Returns false if splitting failed (probably due to reaching max depth)
 func (tree *QuadTreeTerrain) Split() bool {
 	if tree.pixel_width < 2 || !tree.leaf {
@@ -86,13 +260,13 @@ func (tree *QuadTreeTerrain) Split() bool {
 
 	half_w := tree.pixel_width / 2
 
-	tree.sub_trees[0] = NewQuadTreeTerrain(tree.pixel_x, tree.pixel_y, half_w)
+	tree.sub_trees[0] = newQuadTreeNode(tree.pixel_x, tree.pixel_y, half_w, tree.settings)
 	tree.sub_trees[0].leaf_value = tree.leaf_value
-	tree.sub_trees[1] = NewQuadTreeTerrain(tree.pixel_x + half_w, tree.pixel_y, half_w)
+	tree.sub_trees[1] = newQuadTreeNode(tree.pixel_x + half_w, tree.pixel_y, half_w, tree.settings)
 	tree.sub_trees[1].leaf_value = tree.leaf_value
-	tree.sub_trees[2] = NewQuadTreeTerrain(tree.pixel_x, tree.pixel_y + half_w, half_w)
+	tree.sub_trees[2] = newQuadTreeNode(tree.pixel_x, tree.pixel_y + half_w, half_w, tree.settings)
 	tree.sub_trees[2].leaf_value = tree.leaf_value
-	tree.sub_trees[3] = NewQuadTreeTerrain(tree.pixel_x + half_w, tree.pixel_y + half_w, half_w)
+	tree.sub_trees[3] = newQuadTreeNode(tree.pixel_x + half_w, tree.pixel_y + half_w, half_w, tree.settings)
 	tree.sub_trees[3].leaf_value = tree.leaf_value
 
 	tree.leaf = false
@@ -115,145 +289,208 @@ func (tree *QuadTreeTerrain) Join() {
 	tree.sub_trees[3] = nil
 }
 
-// Returns dirtiness
-/*func (tree *QuadTreeTerrain) SetShape(shape shapes.Shape, value int) bool {
+// Paints value everywhere the shape covers, splitting leaves along the edge of the shape and joining them back up wherever they end up all the same
+// Single pixel leaves along the edge get painted if their middle is inside the shape
+// Returns true if anything changed, in which case the area that changed gets marked dirty
+func (tree *QuadTreeTerrain) SetShape(shape shapes.Shape, value int) bool {
 	if shape == nil {
-		fmt.Println("SETTING A NIL SHAPE SOMEHOW")
-		return true
+		return false
 	}
+	changed, region := tree.setShape(shape, value, false)
+	if changed {
+		tree.markDirty(region)
+	}
+	return changed
+}
+
+// Same as SetShape, but anything that isn't Destructible is left alone, for explosions and digging
+func (tree *QuadTreeTerrain) Carve(shape shapes.Shape, value int) bool {
+	if shape == nil {
+		return false
+	}
+	changed, region := tree.setShape(shape, value, true)
+	if changed {
+		tree.markDirty(region)
+	}
+	return changed
+}
 
+// Also gives back the area covering every leaf that changed
+func (tree *QuadTreeTerrain) setShape(shape shapes.Shape, value int, carving bool) (bool, shapes.AxisRect) {
 	if tree.leaf && tree.leaf_value == value {
 		// Don't bother doing anything
-		return tree.dirty
+		return false, shapes.AxisRect{}
+	}
+	if tree.leaf && carving && !tree.Material(tree.leaf_value).Destructible {
+		return false, shapes.AxisRect{}
+	}
+	if tree.isOutOfBounds() {
+		return false, shapes.AxisRect{}
 	}
 
-	if tree.leaf {
-		if shape.Encloses(tree.space) {
+	if !shape.BoundingBox().IntersectsAxisRect(tree.space) || !shape.Intersects(tree.space) {
+		return false, shapes.AxisRect{}
+	}
+
+	// Carving can't flatten sub trees in one go since some of them might not be destructible
+	// Same goes for trees hanging over the edge of the bounds
+	if shape.Encloses(tree.space) && (tree.leaf || (!carving && tree.insideBounds())) {
+		tree.Join()
+		tree.leaf_value = value
+		return true, tree.space
+	}
+
+	split := tree.leaf
+	if tree.leaf && !tree.Split() {
+		// Can't split a single pixel, so go by its middle
+		center := tree.space.Center()
+		if shape.ContainsPoint(center.X, center.Y) {
 			tree.leaf_value = value
-			tree.dirty = true
-		} else if shape.Intersects(tree.space) {
-			split := tree.Split()
-			if !split{
-				tree.leaf_value = value
-				tree.dirty = true
-			} else {
-				for _, st := range tree.sub_trees{
-					if st.SetShape(shape, value){
-						tree.dirty = true
-					}
-				}
-			}
+			return true, tree.space
 		}
-	} else {
-		if shape.Encloses(tree.space) {
-			tree.Join()
-			tree.leaf_value = value
-			tree.dirty = true
-		} else if shape.Intersects(tree.space) {
-			for _, st := range tree.sub_trees{
-				if st.SetShape(shape, value){
-					tree.dirty = true
-				}
+		return false, shapes.AxisRect{}
+	}
+
+	changed := false
+	region := shapes.AxisRect{}
+	for _, st := range tree.sub_trees {
+		if st_changed, st_region := st.setShape(shape, value, carving); st_changed {
+			if changed {
+				region = region.Union(st_region)
+			} else {
+				region = st_region
 			}
+			changed = true
 		}
-		
-		// optimize as we climb back out of the tree
-		if !tree.leaf && tree.sub_trees[0].leaf {
-			join := true
-			tl_val := tree.sub_trees[0].leaf_value
-			for i := 1; i < 4; i++ {
-				if !tree.sub_trees[i].leaf || tree.sub_trees[i].leaf_value != tl_val {
-					join = false
-					break // not everything in this tree has the same value
-				}
-			}
-			if join {
-				tree.Join()
-				tree.leaf_value = tl_val
-			}
+	}
+	// optimize as we climb back out of the tree
+	tree.joinIfUniform()
+	if changed && (split || tree.leaf) {
+		// Splitting or joining changed the whole leaf, not just the parts that were painted
+		region = tree.space
+	}
+	return changed, region
+}
+
+// Collapses the sub trees back into a single leaf if they've all ended up as leaves with the same value
+func (tree *QuadTreeTerrain) joinIfUniform() {
+	if tree.leaf {
+		return
+	}
+	value := tree.sub_trees[0].leaf_value
+	for _, st := range tree.sub_trees {
+		if !st.leaf || st.leaf_value != value {
+			return // not everything in this tree has the same value
 		}
 	}
-	return tree.dirty
-}*/
+	tree.Join()
+}
 
-/*func (tree QuadTreeTerrain) GetRayCollision(ray shapes.Ray, ignore_values []int) (float64, int){
-	// Returns time of hit and leaf_value of the rect we hit
-	if !ray.BoundingBox().Intersects(tree.space) {
-		return 2.0, 0
+// First solid leaf along the ray, with where the ray goes in and out of it and its material
+func (tree QuadTreeTerrain) GetRayCollision(ray shapes.Ray) (shapes.RayResult, bool) {
+	return tree.GetRayCollisionFiltered(ray, shapes.DefaultFilter)
+}
+
+// Only counts materials the filter collides with
+func (tree QuadTreeTerrain) GetRayCollisionFiltered(ray shapes.Ray, filter shapes.Filter) (shapes.RayResult, bool) {
+	entry, exit, hit := ray.GetAxisRectIntersections(tree.space)
+	if !hit {
+		return shapes.RayResult{}, false
 	}
 
 	if tree.leaf {
-		if utils.IntSliceContains(ignore_values, tree.leaf_value) {
-			return 2.0, 0
+		if !tree.collidesWith(filter, tree.leaf_value) {
+			return shapes.RayResult{}, false
 		}
-		hit := ray.GetAxisRectIntersectionTime(tree.space)
-		return hit, tree.leaf_value
-	} else {
-		t := 2.0
-		v := 0
-		for _, st := range(tree.sub_trees) {
-			hit, val := st.GetRayCollision(ray, ignore_values)
-			if hit < t {
-				t = hit
-				v = val
-			}
+		return shapes.RayResult{Entry: entry, Exit: exit, Value: tree.leaf_value}, true
+	}
+
+	best := shapes.RayResult{}
+	found := false
+	for _, st := range(tree.sub_trees) {
+		result, hit := st.GetRayCollisionFiltered(ray, filter)
+		if hit && (!found || result.Entry < best.Entry) {
+			best = result
+			found = true
 		}
-		return t, v
 	}
+	return best, found
+}
+
+// Every stretch of terrain along the ray, whatever its material, added to results in order of distance
+// Neighbouring leaves of the same material are joined up, so each result starts and ends at a change in material
+func (tree QuadTreeTerrain) GetRayCollisions(ray shapes.Ray, results *shapes.RayResultList) {
+	tree.getRayCollisions(ray, nil, results)
+	results.MergeTouching()
+}
+
+// Only counts materials the filter collides with, which leaves out anything that isn't Solid
+func (tree QuadTreeTerrain) GetRayCollisionsFiltered(ray shapes.Ray, filter shapes.Filter, results *shapes.RayResultList) {
+	tree.getRayCollisions(ray, &filter, results)
+	results.MergeTouching()
 }
 
 // TODO: we can probably check fewer rect sides if we somehow consider neighbors
-func (tree QuadTreeTerrain) GetRayCollisions(ray shapes.Ray, ignore_values []int, results *shapes.RayResultList){
-	// Returns time of hit and leaf_value of the rect we hit
-	if !ray.BoundingBox().Intersects(tree.space) {
+// A nil filter counts every leaf inside the bounds
+func (tree QuadTreeTerrain) getRayCollisions(ray shapes.Ray, filter *shapes.Filter, results *shapes.RayResultList) {
+	entry, exit, hit := ray.GetAxisRectIntersections(tree.space)
+	if !hit || tree.isOutOfBounds() {
 		return
 	}
 
 	if tree.leaf {
-		if utils.IntSliceContains(ignore_values, tree.leaf_value) {
-			return
-		}
-		t, u := ray.GetAxisRectIntersections(tree.space)
-		if t <= 1.0 {
-			results.Add(shapes.RayResult{t, u, tree.leaf_value})
+		if (filter == nil || tree.collidesWith(*filter, tree.leaf_value)) && exit > entry {
+			results.Add(shapes.RayResult{Entry: entry, Exit: exit, Value: tree.leaf_value})
 		}
 	} else {
 		for _, st := range(tree.sub_trees) {
-			st.GetRayCollisions(ray, ignore_values, results)
+			st.getRayCollisions(ray, filter, results)
 		}
 	}
 }
 
-// TODO: generalize this to other shapes
-func (tree QuadTreeTerrain) SweepShape(shape shapes.AxisRect, dirx float64, diry float64, ignore_values []int) (float64, float64, float64) {
-	// TODO: broad phase check probably helps performance, and we dont need the hit info unless its a leaf
-	t, nx, ny := shape.SweepAxisRect(dirx, diry, tree.space)
+// Moves the shape along motion and finds the first solid material it runs into
+func (tree QuadTreeTerrain) SweepShape(shape shapes.Shape, motion utils.FloatPair) shapes.SweepHit {
+	return tree.SweepShapeFiltered(shape, motion, shapes.DefaultFilter)
+}
+
+// Only counts materials the filter collides with
+func (tree QuadTreeTerrain) SweepShapeFiltered(shape shapes.Shape, motion utils.FloatPair, filter shapes.Filter) shapes.SweepHit {
+	// Everywhere the shape passes through during the move, so we only look at the bits of the tree it could hit
+	swept := shapes.SweptBoundingBox(shape.BoundingBox(), motion)
+	return tree.sweepShape(shape, motion, swept, filter)
+}
+
+func (tree QuadTreeTerrain) sweepShape(shape shapes.Shape, motion utils.FloatPair, swept shapes.AxisRect, filter shapes.Filter) shapes.SweepHit {
+	if !swept.IntersectsAxisRect(tree.space) {
+		return shapes.SweepHit{Time: 1}
+	}
 
 	if tree.leaf {
-		if utils.IntSliceContains(ignore_values, tree.leaf_value) && t < 2.0 {
-			return 2.0, 0.0, 0.0
+		if !tree.collidesWith(filter, tree.leaf_value) {
+			return shapes.SweepHit{Time: 1}
 		}
-		return t, nx, ny
-	} else if t < 2.0 { // We hit this space so need to search deeper
-		mint := 2.0
-		wnx := 0.0
-		wny := 0.0
-		for _, st := range(tree.sub_trees) {
-			t, nx, ny = st.SweepShape(shape, dirx, diry, ignore_values)
-			if t < mint {
-				mint = t
-				wnx = nx
-				wny = ny
-			}
+		return shapes.Sweep(shape, motion, tree.space)
+	}
+
+	best := shapes.SweepHit{Time: 1}
+	for _, st := range(tree.sub_trees) {
+		hit := st.sweepShape(shape, motion, swept, filter)
+		if hit.Hit && (!best.Hit || hit.Time < best.Time) {
+			best = hit
 		}
-		return mint, wnx, wny
 	}
-	return 2.0, 0.0, 0.0
-}*/
+	return best
+}
 
 func (tree QuadTreeTerrain) DoesLineCollide(ray shapes.Line) bool {
+	return tree.DoesLineCollideFiltered(ray, shapes.DefaultFilter)
+}
+
+// Only counts materials the filter collides with
+func (tree QuadTreeTerrain) DoesLineCollideFiltered(ray shapes.Line, filter shapes.Filter) bool {
 	// TODO: for path finding we need a check like that that considers touching the side of a rectangle as not a collision
-	if tree.leaf && tree.leaf_value == 0 {
+	if tree.leaf && !tree.collidesWith(filter, tree.leaf_value) {
 		return false
 	}
 
@@ -267,7 +504,7 @@ func (tree QuadTreeTerrain) DoesLineCollide(ray shapes.Line) bool {
 		}
 	} else {
 		for _, st := range(tree.sub_trees) {
-			if st.DoesLineCollide(ray) {
+			if st.DoesLineCollideFiltered(ray, filter) {
 				return true
 			}
 		}
@@ -276,41 +513,38 @@ func (tree QuadTreeTerrain) DoesLineCollide(ray shapes.Line) bool {
 	return false
 }
 
-func (tree QuadTreeTerrain) ImprovePath(path []utils.IntPair) []utils.IntPair {
-	if len(path) <= 2 {
-		return path
-	}
-	for idx := 0; idx < len(path) - 2; {
-		if !tree.DoesLineCollide(shapes.NewLine(path[idx].X, path[idx].Y, path[idx+1].X, path[idx+1].Y)) {
-			// remove idx+1 from the path
-			path = append(path[:idx+1], path[idx+2:]...)
-		} else {
-			idx += 1
-		}
+// Unlike IntersectsAxisRect, running along an edge or clipping a corner doesn't count, which is fine for walking past something
+func crossesAxisRect(seg shapes.Segment, rect shapes.AxisRect) bool {
+	entry, exit, ok := seg.GetAxisRectIntersections(rect)
+	if !ok || exit <= entry {
+		return false
 	}
-	return path
+	middle := seg.PointAt((entry + exit) / 2)
+	return middle.X > float64(rect.X()) && middle.X < float64(rect.X2()) && middle.Y > float64(rect.Y()) && middle.Y < float64(rect.Y2())
+}
+
+// Cuts corners out of a path wherever it can walk straight, as long as that isn't more expensive
+func (tree QuadTreeTerrain) ImprovePath(path []utils.IntPair) []utils.IntPair {
+	return tree.ImprovePathWithCosts(path, nil)
+}
+
+func (tree QuadTreeTerrain) ImprovePathWithCosts(path []utils.IntPair, costs PathCosts) []utils.IntPair {
+	return improvePath(path, tree.pathCoster(costs), true)
 }
 
+// like ImprovePath, but we stop after our first ray hit. The idea is that a pathfinding user will be calling this as they follow the path
 func (tree QuadTreeTerrain) ImprovePathBeginning(path []utils.IntPair) []utils.IntPair {
-	// like ImprovePath, but we stop after our first ray hit. The idea is that a pathfinding user will be calling this as they follow the path
-	if len(path) <= 2 {
-		return path
-	}
-	for idx := 0; idx < len(path) - 2; {
-		if !tree.DoesLineCollide(shapes.NewLine(path[idx].X, path[idx].Y, path[idx+1].X, path[idx+1].Y)) {
-			// remove idx+1 from the path
-			path = append(path[:idx+1], path[idx+2:]...)
-		} else {
-			return path
-		}
-	}
-	return path
+	return tree.ImprovePathBeginningWithCosts(path, nil)
+}
+
+func (tree QuadTreeTerrain) ImprovePathBeginningWithCosts(path []utils.IntPair, costs PathCosts) []utils.IntPair {
+	return improvePath(path, tree.pathCoster(costs), false)
 }
 
 // Returns false if starting position is not inside this tree, returned position will not be useful in that case
 // Doesn't actually return the closest corner, just the closest corner of the leaf we are in, which is close enough
 func (tree QuadTreeTerrain) GetClosestCorner(x, y float64) (bool, int, int) {
-	if !tree.space.ContainsPoint(x, y) {
+	if !tree.space.ContainsPoint(x, y) || !tree.settings.bounds.ContainsPoint(x, y) || tree.isOutOfBounds() {
 		return false, 0, 0
 	}
 
@@ -353,56 +587,61 @@ func (tree QuadTreeTerrain) Neighbours(n utils.IntPair) []utils.IntPair {
 	return tree.GetAdjacentCorners(n.X, n.Y)
 }
 
-func (tree QuadTreeTerrain) GetAdjacentCorners(x, y int) []utils.IntPair {
-	// This function assumes you are passing in an actual corner
-	if !tree.leaf {
-		flags := [4]bool{}
-		result := [4]utils.IntPair{}
-		min_pos_x := math.MaxInt
-		min_neg_x := math.MinInt
-		min_pos_y := math.MaxInt
-		min_neg_y := math.MinInt
-		for _, subtree := range tree.sub_trees { // TODO: we know enough about the max number of adjacent corners to reasonably be able to avoid all this slice fiddling
-			if subtree.space.ContainsPoint(float64(x), float64(y)) {
-				nodes := subtree.GetAdjacentCorners(x, y)
-				for _, newnode := range nodes {
-					if newnode.X == x {
-						if newnode.Y > y && newnode.Y < min_pos_y {
-							min_pos_y = newnode.Y
-							result[0] = newnode
-							flags[0] = true
-						} else if newnode.Y < y && newnode.Y > min_neg_y {
-							min_neg_y = newnode.Y
-							result[1] = newnode
-							flags[1] = true
-						}
-					} else if newnode.Y == y {
-						if newnode.X > x && newnode.X < min_pos_x {
-							min_pos_x = newnode.X
-							result[2] = newnode
-							flags[2] = true
-						} else if newnode.X < x && newnode.X > min_neg_x {
-							min_neg_x = newnode.X
-							result[3] = newnode
-							flags[3] = true
-						}
+// Corners next to x, y from every tree touching it, keeping only the nearest one in each direction
+// Sub trees of a tree and chunks of a TerrainWorld both get stitched together like this
+func mergeAdjacentCorners(x, y int, trees []*QuadTreeTerrain) []utils.IntPair {
+	flags := [4]bool{}
+	result := [4]utils.IntPair{}
+	min_pos_x := math.MaxInt
+	min_neg_x := math.MinInt
+	min_pos_y := math.MaxInt
+	min_neg_y := math.MinInt
+	for _, subtree := range trees { // TODO: we know enough about the max number of adjacent corners to reasonably be able to avoid all this slice fiddling
+		if subtree.space.ContainsPoint(float64(x), float64(y)) {
+			nodes := subtree.GetAdjacentCorners(x, y)
+			for _, newnode := range nodes {
+				if newnode.X == x {
+					if newnode.Y > y && newnode.Y < min_pos_y {
+						min_pos_y = newnode.Y
+						result[0] = newnode
+						flags[0] = true
+					} else if newnode.Y < y && newnode.Y > min_neg_y {
+						min_neg_y = newnode.Y
+						result[1] = newnode
+						flags[1] = true
+					}
+				} else if newnode.Y == y {
+					if newnode.X > x && newnode.X < min_pos_x {
+						min_pos_x = newnode.X
+						result[2] = newnode
+						flags[2] = true
+					} else if newnode.X < x && newnode.X > min_neg_x {
+						min_neg_x = newnode.X
+						result[3] = newnode
+						flags[3] = true
 					}
 				}
 			}
 		}
+	}
 
-		slice_result := make([]utils.IntPair, 0, 4)
-		for idx, flag := range flags {
-			if flag {
-				slice_result = append(slice_result, result[idx])
-			}
+	slice_result := make([]utils.IntPair, 0, 4)
+	for idx, flag := range flags {
+		if flag {
+			slice_result = append(slice_result, result[idx])
 		}
-		return slice_result
+	}
+	return slice_result
+}
+
+func (tree QuadTreeTerrain) GetAdjacentCorners(x, y int) []utils.IntPair {
+	// This function assumes you are passing in an actual corner
+	if !tree.leaf {
+		return mergeAdjacentCorners(x, y, tree.sub_trees[:])
 	}
 
-	// TODO: don't hard code what is walkable like this probably
 	// TODO: this isnt really an accurate way to do this, but it might be good enough, should explore alternatives though
-	if tree.leaf_value == 1 {
+	if !tree.Material(tree.leaf_value).Walkable {
 		return []utils.IntPair{}
 	}
 
@@ -429,7 +668,12 @@ func (tree QuadTreeTerrain) GetAdjacentCorners(x, y int) []utils.IntPair {
 }
 
 func (tree QuadTreeTerrain) CircleSeparation(circ shapes.Circle) (utils.FloatPair, float64) {
-	if tree.leaf && tree.leaf_value == 0 {
+	return tree.CircleSeparationFiltered(circ, shapes.DefaultFilter)
+}
+
+// Only pushes out of materials the filter collides with
+func (tree QuadTreeTerrain) CircleSeparationFiltered(circ shapes.Circle, filter shapes.Filter) (utils.FloatPair, float64) {
+	if tree.leaf && !tree.collidesWith(filter, tree.leaf_value) {
 		return utils.FloatPair{}, 0
 	}
 
@@ -440,10 +684,41 @@ func (tree QuadTreeTerrain) CircleSeparation(circ shapes.Circle) (utils.FloatPai
 	if tree.leaf {
 		return circ.SeparationForAxisRect(tree.space)
 	} else {
-		maxvec, maxlen := tree.sub_trees[0].CircleSeparation(circ)
+		maxvec, maxlen := tree.sub_trees[0].CircleSeparationFiltered(circ, filter)
 		
 		for _, st := range(tree.sub_trees[1:]) {
-			vec, len := st.CircleSeparation(circ)
+			vec, len := st.CircleSeparationFiltered(circ, filter)
+			if len > maxlen {
+				maxlen = len
+				maxvec = vec
+			}
+		}
+
+		return maxvec, maxlen
+	}
+}
+
+// Same as CircleSeparation, but for capsule shaped things like tall characters
+func (tree QuadTreeTerrain) CapsuleSeparation(capsule shapes.Capsule) (utils.FloatPair, float64) {
+	return tree.CapsuleSeparationFiltered(capsule, shapes.DefaultFilter)
+}
+
+func (tree QuadTreeTerrain) CapsuleSeparationFiltered(capsule shapes.Capsule, filter shapes.Filter) (utils.FloatPair, float64) {
+	if tree.leaf && !tree.collidesWith(filter, tree.leaf_value) {
+		return utils.FloatPair{}, 0
+	}
+
+	if !capsule.BBIntersectsAxisRect(tree.space) {
+		return utils.FloatPair{}, 0
+	}
+
+	if tree.leaf {
+		return capsule.SeparationForAxisRect(tree.space)
+	} else {
+		maxvec, maxlen := tree.sub_trees[0].CapsuleSeparationFiltered(capsule, filter)
+
+		for _, st := range(tree.sub_trees[1:]) {
+			vec, len := st.CapsuleSeparationFiltered(capsule, filter)
 			if len > maxlen {
 				maxlen = len
 				maxvec = vec
@@ -472,21 +747,14 @@ func EuclidianDistance(s, e utils.IntPair) (float64) {
     return math.Sqrt((dx * dx) + (dy * dy))
 }
 
+// Cheapest path between the corners closest to s and e, going by the material table's costs
 func (tree QuadTreeTerrain) FindPath(s, e utils.IntPair) []utils.IntPair {
-	// check if end is inside unwalkable terrain to save a lot of time
-	_, sx, sy := tree.GetClosestCorner(float64(s.X), float64(s.Y))
-	_, ex, ey := tree.GetClosestCorner(float64(e.X), float64(e.Y))
-	s = utils.IntPair{X: sx, Y:sy,}
-	e = utils.IntPair{X: ex, Y:ey,}
-	end_adjacent := tree.GetAdjacentCorners(e.X, e.Y)
-	if len(end_adjacent) <= 0 {
-		return []utils.IntPair{}
-	}
+	return tree.FindPathWithCosts(s, e, nil)
+}
 
-	result := astar.FindPath[utils.IntPair](tree, s, e, ManhattanDistance, EuclidianDistance)
-	result = append([]utils.IntPair{s}, result...)
-	result = append(result, e)
-	return result
+// costs override the material table's costs for just this path
+func (tree QuadTreeTerrain) FindPathWithCosts(s, e utils.IntPair, costs PathCosts) []utils.IntPair {
+	return newAStar(tree, tree.pathCoster(costs), s, e).finish()
 }
 
 func (tree QuadTreeTerrain) DebugDrawTree(target *ebiten.Image) {
@@ -506,11 +774,7 @@ func (tree QuadTreeTerrain) DebugDrawTree2(target *ebiten.Image) {
 		tree.sub_trees[1].DebugDrawTree2(target)
 		tree.sub_trees[2].DebugDrawTree2(target)
 		tree.sub_trees[3].DebugDrawTree2(target)
-	} else {
-		if tree.leaf_value == 0 {
-			ebitenutil.DrawRect(target, float64(tree.pixel_x), float64(tree.pixel_y), float64(tree.pixel_width), float64(tree.pixel_width), color.RGBA{200, 200, 200, 255})
-		} else {
-			ebitenutil.DrawRect(target, float64(tree.pixel_x), float64(tree.pixel_y), float64(tree.pixel_width), float64(tree.pixel_width), color.RGBA{50, 50, 50, 255})
-		}
+	} else if !tree.isOutOfBounds() {
+		ebitenutil.DrawRect(target, float64(tree.pixel_x), float64(tree.pixel_y), float64(tree.pixel_width), float64(tree.pixel_width), tree.Material(tree.leaf_value).Color)
 	}
 }
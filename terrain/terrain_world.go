@@ -0,0 +1,640 @@
+package terrain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/Yarnsh/hippo/utils"
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+var FileSystem = os.DirFS(".")
+
+// Where the image for a chunk lives in FileSystem
+type ChunkPathCallback func(chunk utils.IntPair) string
+
+// Called with a chunk's grid position as it gets loaded or unloaded
+// Unloading throws the chunk away, so this is the place to save any edits
+type ChunkCallback func(chunk utils.IntPair, tree *QuadTreeTerrain)
+
+func DefaultChunkPath(chunk utils.IntPair) string {
+	return fmt.Sprintf("chunk_%d_%d.png", chunk.X, chunk.Y)
+}
+
+// A big world split up into a sparse grid of square QuadTreeTerrain chunks
+// Chunks get streamed in and out of FileSystem around a focus point, and queries work across them like they were one big terrain
+// Anything in a chunk that isn't loaded counts as empty for collision and can't be walked through
+type TerrainWorld struct {
+	chunk_size int
+	chunks map[utils.IntPair]*QuadTreeTerrain
+	missing map[utils.IntPair]void // Chunks with no file, so we don't keep looking for them
+
+	chunk_path ChunkPathCallback
+	load_distance float64
+	unload_distance float64
+	on_load ChunkCallback
+	on_unload ChunkCallback
+
+	// Handed to every chunk as it loads
+	materials *MaterialTable
+	material_filters map[int]shapes.Filter
+	filter_callback MaterialFilterCallback
+
+	// Grown copies of each loaded chunk for path finding with big agents, see clearanceMap
+	clearance map[AgentSize]map[utils.IntPair]*clearanceMap
+	clearance_subscribers map[utils.IntPair]int
+}
+
+// chunk_size should be a power of 2 to keep the trees free of padding
+// A nil chunk_path uses DefaultChunkPath
+func NewTerrainWorld(chunk_size int, chunk_path ChunkPathCallback) *TerrainWorld {
+	if chunk_path == nil {
+		chunk_path = DefaultChunkPath
+	}
+	return &TerrainWorld{
+		chunk_size: chunk_size,
+		chunks: make(map[utils.IntPair]*QuadTreeTerrain),
+		missing: make(map[utils.IntPair]void),
+		chunk_path: chunk_path,
+		load_distance: float64(chunk_size) * 2,
+		unload_distance: float64(chunk_size) * 3,
+		materials: NewMaterialTable(),
+		material_filters: make(map[int]shapes.Filter),
+		clearance: make(map[AgentSize]map[utils.IntPair]*clearanceMap),
+		clearance_subscribers: make(map[utils.IntPair]int),
+	}
+}
+
+// Getters
+func (world TerrainWorld) ChunkSize() int {
+	return world.chunk_size
+}
+func (world TerrainWorld) MaterialTable() *MaterialTable {
+	return world.materials
+}
+func (world TerrainWorld) Chunk(chunk utils.IntPair) (*QuadTreeTerrain, bool) {
+	tree, ok := world.chunks[chunk]
+	return tree, ok
+}
+// Grid positions of every loaded chunk, sorted so they come out the same every time
+func (world TerrainWorld) LoadedChunks() []utils.IntPair {
+	result := make([]utils.IntPair, 0, len(world.chunks))
+	for chunk := range world.chunks {
+		result = append(result, chunk)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Y != result[j].Y {
+			return result[i].Y < result[j].Y
+		}
+		return result[i].X < result[j].X
+	})
+	return result
+}
+// End getters
+
+// Grid position of the chunk containing the point
+func (world TerrainWorld) ChunkCoords(x, y float64) utils.IntPair {
+	return utils.IntPair{
+		X: int(math.Floor(x / float64(world.chunk_size))),
+		Y: int(math.Floor(y / float64(world.chunk_size))),
+	}
+}
+
+// The area a chunk covers whether or not it's loaded
+func (world TerrainWorld) ChunkSpace(chunk utils.IntPair) shapes.AxisRect {
+	return shapes.NewAxisRect(chunk.X * world.chunk_size, chunk.Y * world.chunk_size, world.chunk_size, world.chunk_size)
+}
+
+// Chunks closer than load get loaded by Update, and ones further than unload get dropped
+// unload should be a bit bigger than load so chunks don't flicker in and out while the focus wanders along an edge
+func (world *TerrainWorld) SetStreamingDistances(load float64, unload float64) {
+	world.load_distance = load
+	world.unload_distance = math.Max(load, unload)
+}
+
+// nil removes the callback
+func (world *TerrainWorld) SetChunkLoadCallback(callback ChunkCallback) {
+	world.on_load = callback
+}
+
+// nil removes the callback
+func (world *TerrainWorld) SetChunkUnloadCallback(callback ChunkCallback) {
+	world.on_unload = callback
+}
+
+// Replaces the table for every chunk, loaded or not
+func (world *TerrainWorld) SetMaterialTable(table *MaterialTable) {
+	world.materials = table
+	for _, tree := range world.chunks {
+		tree.SetMaterialTable(table)
+	}
+}
+
+func (world *TerrainWorld) SetMaterialFilter(value int, filter shapes.Filter) {
+	world.material_filters[value] = filter
+	for _, tree := range world.chunks {
+		tree.SetMaterialFilter(value, filter)
+	}
+}
+
+// nil removes the callback
+func (world *TerrainWorld) SetMaterialFilterCallback(callback MaterialFilterCallback) {
+	world.filter_callback = callback
+	for _, tree := range world.chunks {
+		tree.SetMaterialFilterCallback(callback)
+	}
+}
+
+// Loads every chunk near the focus that isn't loaded yet, and unloads the ones that are too far away
+// Chunks without a file are skipped, any other error stops loading and gets returned
+func (world *TerrainWorld) Update(focus utils.FloatPair) error {
+	for _, chunk := range world.LoadedChunks() {
+		if world.distanceToChunk(focus, chunk) > world.unload_distance {
+			world.UnloadChunk(chunk)
+		}
+	}
+
+	reach := int(math.Ceil(world.load_distance / float64(world.chunk_size)))
+	center := world.ChunkCoords(focus.X, focus.Y)
+	for cy := center.Y - reach; cy <= center.Y + reach; cy++ {
+		for cx := center.X - reach; cx <= center.X + reach; cx++ {
+			chunk := utils.IntPair{X: cx, Y: cy}
+			if _, loaded := world.chunks[chunk]; loaded {
+				continue
+			}
+			if _, missing := world.missing[chunk]; missing {
+				continue
+			}
+			if world.distanceToChunk(focus, chunk) > world.load_distance {
+				continue
+			}
+			if err := world.LoadChunk(chunk); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (world TerrainWorld) distanceToChunk(point utils.FloatPair, chunk utils.IntPair) float64 {
+	space := world.ChunkSpace(chunk)
+	dx := math.Max(math.Max(float64(space.X()) - point.X, point.X - float64(space.X2())), 0)
+	dy := math.Max(math.Max(float64(space.Y()) - point.Y, point.Y - float64(space.Y2())), 0)
+	return math.Sqrt((dx * dx) + (dy * dy))
+}
+
+// Reads the chunk's image from FileSystem, replacing the chunk if it was already loaded
+// A chunk with no file gets remembered as missing and the fs.ErrNotExist error is returned
+func (world *TerrainWorld) LoadChunk(chunk utils.IntPair) error {
+	dat, err := fs.ReadFile(FileSystem, world.chunk_path(chunk))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			world.missing[chunk] = void_item
+		}
+		return err
+	}
+	img, _, err := image.Decode(bytes.NewReader(dat))
+	if err != nil {
+		return err
+	}
+
+	space := world.ChunkSpace(chunk)
+	tree := NewQuadTreeTerrain(space.X(), space.Y(), world.chunk_size)
+	tree.SetMaterialTable(world.materials)
+	// The image's top left is the chunk's top left
+	tree.loadImageData(chunkImage{img: img, offset: image.Point{X: space.X(), Y: space.Y()}})
+	world.SetChunk(chunk, tree)
+	return nil
+}
+
+// Puts a tree in as a chunk, for worlds that are generated instead of loaded
+// The tree should sit exactly on the chunk's space
+func (world *TerrainWorld) SetChunk(chunk utils.IntPair, tree *QuadTreeTerrain) {
+	if _, loaded := world.chunks[chunk]; loaded {
+		world.UnloadChunk(chunk)
+	}
+	delete(world.missing, chunk)
+
+	tree.SetMaterialTable(world.materials)
+	tree.SetMaterialFilterCallback(world.filter_callback)
+	for value, filter := range world.material_filters {
+		tree.SetMaterialFilter(value, filter)
+	}
+	world.chunks[chunk] = tree
+	// Walls in the new chunk can push agents back in the neighbouring ones
+	world.queueClearance(world.ChunkSpace(chunk))
+	if world.on_load != nil {
+		world.on_load(chunk, tree)
+	}
+}
+
+func (world *TerrainWorld) UnloadChunk(chunk utils.IntPair) {
+	tree, loaded := world.chunks[chunk]
+	if !loaded {
+		return
+	}
+	delete(world.chunks, chunk)
+	if id, ok := world.clearance_subscribers[chunk]; ok {
+		tree.Unsubscribe(id)
+		delete(world.clearance_subscribers, chunk)
+	}
+	for _, grown := range world.clearance {
+		delete(grown, chunk)
+	}
+	world.queueClearance(world.ChunkSpace(chunk))
+	if world.on_unload != nil {
+		world.on_unload(chunk, tree)
+	}
+}
+
+// Makes Update look for files again for chunks that didn't have one, for when new chunks get written out
+func (world *TerrainWorld) ForgetMissingChunks() {
+	world.missing = make(map[utils.IntPair]void)
+}
+
+// Reads an image as if its top left were at offset, so chunk images don't need to know where they go
+type chunkImage struct {
+	img image.Image
+	offset image.Point
+}
+
+func (ci chunkImage) ColorModel() color.Model {
+	return ci.img.ColorModel()
+}
+func (ci chunkImage) Bounds() image.Rectangle {
+	return ci.img.Bounds().Sub(ci.img.Bounds().Min).Add(ci.offset)
+}
+func (ci chunkImage) At(x, y int) color.Color {
+	return ci.img.At(x - ci.offset.X + ci.img.Bounds().Min.X, y - ci.offset.Y + ci.img.Bounds().Min.Y)
+}
+
+// Loaded chunks overlapping the box, in the same order every time
+func (world TerrainWorld) chunksTouching(box shapes.AxisRect) []*QuadTreeTerrain {
+	first := world.ChunkCoords(float64(box.X()), float64(box.Y()))
+	last := world.ChunkCoords(float64(box.X2()), float64(box.Y2()))
+	// Huge boxes like a ray's would mean looking up a lot of empty grid spots, so just go through what is loaded
+	if (last.X - first.X + 1) * (last.Y - first.Y + 1) > len(world.chunks) {
+		result := []*QuadTreeTerrain{}
+		for _, chunk := range world.LoadedChunks() {
+			if box.IntersectsAxisRect(world.ChunkSpace(chunk)) {
+				result = append(result, world.chunks[chunk])
+			}
+		}
+		return result
+	}
+
+	result := []*QuadTreeTerrain{}
+	for cy := first.Y; cy <= last.Y; cy++ {
+		for cx := first.X; cx <= last.X; cx++ {
+			if tree, ok := world.chunks[utils.IntPair{X: cx, Y: cy}]; ok {
+				result = append(result, tree)
+			}
+		}
+	}
+	return result
+}
+
+// Every chunk that has the point in it, up to 4 when it's on a chunk corner
+func (world TerrainWorld) chunksAt(x, y float64) []*QuadTreeTerrain {
+	size := float64(world.chunk_size)
+	result := []*QuadTreeTerrain{}
+	for cy := int(math.Ceil(y / size)) - 1; cy <= int(math.Floor(y / size)); cy++ {
+		for cx := int(math.Ceil(x / size)) - 1; cx <= int(math.Floor(x / size)); cx++ {
+			if tree, ok := world.chunks[utils.IntPair{X: cx, Y: cy}]; ok {
+				result = append(result, tree)
+			}
+		}
+	}
+	return result
+}
+
+func (world TerrainWorld) ValueAt(x, y float64) (int, bool) {
+	tree, ok := world.chunks[world.ChunkCoords(x, y)]
+	if !ok {
+		return 0, false
+	}
+	return tree.ValueAt(x, y)
+}
+
+func (world TerrainWorld) MaterialAt(x, y float64) (Material, bool) {
+	value, ok := world.ValueAt(x, y)
+	if !ok {
+		return Material{}, false
+	}
+	return world.materials.Get(value), true
+}
+
+// Edits every loaded chunk the shape reaches, see QuadTreeTerrain.SetShape
+func (world *TerrainWorld) SetShape(shape shapes.Shape, value int) bool {
+	if shape == nil {
+		return false
+	}
+	changed := false
+	for _, tree := range world.chunksTouching(shape.BoundingBox()) {
+		if tree.SetShape(shape, value) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Edits every loaded chunk the shape reaches, see QuadTreeTerrain.Carve
+func (world *TerrainWorld) Carve(shape shapes.Shape, value int) bool {
+	if shape == nil {
+		return false
+	}
+	changed := false
+	for _, tree := range world.chunksTouching(shape.BoundingBox()) {
+		if tree.Carve(shape, value) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (world TerrainWorld) GetRayCollision(ray shapes.Ray) (shapes.RayResult, bool) {
+	return world.GetRayCollisionFiltered(ray, shapes.DefaultFilter)
+}
+
+func (world TerrainWorld) GetRayCollisionFiltered(ray shapes.Ray, filter shapes.Filter) (shapes.RayResult, bool) {
+	best := shapes.RayResult{}
+	found := false
+	for _, tree := range world.chunksTouching(ray.BoundingBox()) {
+		result, hit := tree.GetRayCollisionFiltered(ray, filter)
+		if hit && (!found || result.Entry < best.Entry) {
+			best = result
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Stretches that carry on over a seam come back as one result
+func (world TerrainWorld) GetRayCollisions(ray shapes.Ray, results *shapes.RayResultList) {
+	world.getRayCollisions(ray, nil, results)
+}
+
+func (world TerrainWorld) GetRayCollisionsFiltered(ray shapes.Ray, filter shapes.Filter, results *shapes.RayResultList) {
+	world.getRayCollisions(ray, &filter, results)
+}
+
+func (world TerrainWorld) getRayCollisions(ray shapes.Ray, filter *shapes.Filter, results *shapes.RayResultList) {
+	for _, tree := range world.chunksTouching(ray.BoundingBox()) {
+		tree.getRayCollisions(ray, filter, results)
+	}
+	results.MergeTouching()
+}
+
+func (world TerrainWorld) SweepShape(shape shapes.Shape, motion utils.FloatPair) shapes.SweepHit {
+	return world.SweepShapeFiltered(shape, motion, shapes.DefaultFilter)
+}
+
+func (world TerrainWorld) SweepShapeFiltered(shape shapes.Shape, motion utils.FloatPair, filter shapes.Filter) shapes.SweepHit {
+	best := shapes.SweepHit{Time: 1}
+	swept := shapes.SweptBoundingBox(shape.BoundingBox(), motion)
+	for _, tree := range world.chunksTouching(swept) {
+		hit := tree.SweepShapeFiltered(shape, motion, filter)
+		if hit.Hit && (!best.Hit || hit.Time < best.Time) {
+			best = hit
+		}
+	}
+	return best
+}
+
+func (world TerrainWorld) DoesLineCollide(ray shapes.Line) bool {
+	return world.DoesLineCollideFiltered(ray, shapes.DefaultFilter)
+}
+
+func (world TerrainWorld) DoesLineCollideFiltered(ray shapes.Line, filter shapes.Filter) bool {
+	for _, tree := range world.chunksTouching(ray.BoundingBox()) {
+		if tree.DoesLineCollideFiltered(ray, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func (world TerrainWorld) CircleSeparation(circ shapes.Circle) (utils.FloatPair, float64) {
+	return world.CircleSeparationFiltered(circ, shapes.DefaultFilter)
+}
+
+// Biggest push out of any chunk, the same way a single tree picks between its sub trees
+func (world TerrainWorld) CircleSeparationFiltered(circ shapes.Circle, filter shapes.Filter) (utils.FloatPair, float64) {
+	maxvec := utils.FloatPair{}
+	maxlen := 0.0
+	for _, tree := range world.chunksTouching(circ.BoundingBox()) {
+		vec, len := tree.CircleSeparationFiltered(circ, filter)
+		if len > maxlen {
+			maxlen = len
+			maxvec = vec
+		}
+	}
+	return maxvec, maxlen
+}
+
+func (world TerrainWorld) CapsuleSeparation(capsule shapes.Capsule) (utils.FloatPair, float64) {
+	return world.CapsuleSeparationFiltered(capsule, shapes.DefaultFilter)
+}
+
+func (world TerrainWorld) CapsuleSeparationFiltered(capsule shapes.Capsule, filter shapes.Filter) (utils.FloatPair, float64) {
+	maxvec := utils.FloatPair{}
+	maxlen := 0.0
+	for _, tree := range world.chunksTouching(capsule.BoundingBox()) {
+		vec, len := tree.CapsuleSeparationFiltered(capsule, filter)
+		if len > maxlen {
+			maxlen = len
+			maxvec = vec
+		}
+	}
+	return maxvec, maxlen
+}
+
+// Closest corner of the leaf the point is in, false if its chunk isn't loaded
+func (world TerrainWorld) GetClosestCorner(x, y float64) (bool, int, int) {
+	tree, ok := world.chunks[world.ChunkCoords(x, y)]
+	if !ok {
+		return false, 0, 0
+	}
+	return tree.GetClosestCorner(x, y)
+}
+
+func (world TerrainWorld) Neighbours(n utils.IntPair) []utils.IntPair {
+	// func to implement the astar library's graph interface
+	return world.GetAdjacentCorners(n.X, n.Y)
+}
+
+// Corners on a seam get neighbours from the chunks on both sides, so paths cross seams like any other leaf edge
+func (world TerrainWorld) GetAdjacentCorners(x, y int) []utils.IntPair {
+	return mergeAdjacentCorners(x, y, world.chunksAt(float64(x), float64(y)))
+}
+
+// Only goes through loaded chunks
+func (world TerrainWorld) FindPath(s, e utils.IntPair) []utils.IntPair {
+	return world.FindPathWithCosts(s, e, nil)
+}
+
+func (world TerrainWorld) FindPathWithCosts(s, e utils.IntPair, costs PathCosts) []utils.IntPair {
+	return newAStar(world, world.pathCoster(costs), s, e).finish()
+}
+
+// Chunks that aren't loaded can't be walked through
+func (world TerrainWorld) pathCoster(costs PathCosts) pathCoster {
+	return newPathCoster(world.materials, costs, func(seg shapes.Segment, coster pathCoster) ([]costSpan, bool) {
+		spans := []costSpan{}
+		ok := true
+		for _, tree := range world.chunksTouching(seg.BoundingBox()) {
+			if spans, ok = tree.lineSpans(seg, coster, spans); !ok {
+				return spans, false
+			}
+		}
+		return spans, true
+	}, func(x, y float64) *QuadTreeTerrain {
+		tree, ok := world.chunks[world.ChunkCoords(x, y)]
+		if !ok {
+			return nil
+		}
+		return tree.leafAt(x, y)
+	})
+}
+
+func (world TerrainWorld) ImprovePath(path []utils.IntPair) []utils.IntPair {
+	return world.ImprovePathWithCosts(path, nil)
+}
+
+func (world TerrainWorld) ImprovePathWithCosts(path []utils.IntPair, costs PathCosts) []utils.IntPair {
+	return improvePath(path, world.pathCoster(costs), true)
+}
+
+func (world TerrainWorld) ImprovePathBeginning(path []utils.IntPair) []utils.IntPair {
+	return world.ImprovePathBeginningWithCosts(path, nil)
+}
+
+func (world TerrainWorld) ImprovePathBeginningWithCosts(path []utils.IntPair, costs PathCosts) []utils.IntPair {
+	return improvePath(path, world.pathCoster(costs), false)
+}
+
+// Same as FindPath, but only through gaps the agent fits through, see QuadTreeTerrain.FindPathForAgent
+// Chunks get grown as if they were one big terrain, so a wall just over a seam still keeps the agent back
+// Chunks that aren't loaded don't push the agent away, the same way they count as empty for collision
+func (world TerrainWorld) FindPathForAgent(s, e utils.IntPair, agent AgentSize) []utils.IntPair {
+	return world.FindPathForAgentWithCosts(s, e, agent, nil)
+}
+
+func (world TerrainWorld) FindPathForAgentWithCosts(s, e utils.IntPair, agent AgentSize, costs PathCosts) []utils.IntPair {
+	if agent.IsPoint() {
+		return world.FindPathWithCosts(s, e, costs)
+	}
+	return world.clearanceWorld(agent).FindPathWithCosts(s, e, costs)
+}
+
+// Same as ImprovePath, but only takes shortcuts the agent fits along
+func (world TerrainWorld) ImprovePathForAgent(path []utils.IntPair, agent AgentSize) []utils.IntPair {
+	return world.ImprovePathForAgentWithCosts(path, agent, nil)
+}
+
+func (world TerrainWorld) ImprovePathForAgentWithCosts(path []utils.IntPair, agent AgentSize, costs PathCosts) []utils.IntPair {
+	if agent.IsPoint() {
+		return world.ImprovePathWithCosts(path, costs)
+	}
+	return world.clearanceWorld(agent).ImprovePathWithCosts(path, costs)
+}
+
+// Same as ImprovePathBeginning, but only takes shortcuts the agent fits along
+func (world TerrainWorld) ImprovePathBeginningForAgent(path []utils.IntPair, agent AgentSize) []utils.IntPair {
+	return world.ImprovePathBeginningForAgentWithCosts(path, agent, nil)
+}
+
+func (world TerrainWorld) ImprovePathBeginningForAgentWithCosts(path []utils.IntPair, agent AgentSize, costs PathCosts) []utils.IntPair {
+	if agent.IsPoint() {
+		return world.ImprovePathBeginningWithCosts(path, costs)
+	}
+	return world.clearanceWorld(agent).ImprovePathBeginningWithCosts(path, costs)
+}
+
+// Whether the agent can stand with its center at the point without overlapping anything unwalkable in a loaded chunk
+func (world TerrainWorld) HasClearance(x, y float64, agent AgentSize) bool {
+	clearance := world
+	if !agent.IsPoint() {
+		clearance = world.clearanceWorld(agent)
+	}
+	value, ok := clearance.ValueAt(x, y)
+	return ok && materialFor(world.materials, value).Walkable
+}
+
+// Drops the cached copies, they need rebuilding after changing which materials are walkable
+func (world *TerrainWorld) ForgetAgentSizes() {
+	for chunk, id := range world.clearance_subscribers {
+		if tree, ok := world.chunks[chunk]; ok {
+			tree.Unsubscribe(id)
+		}
+	}
+	world.clearance = make(map[AgentSize]map[utils.IntPair]*clearanceMap)
+	world.clearance_subscribers = make(map[utils.IntPair]int)
+}
+
+// The same world looking at the grown copies of its chunks instead, patched up with any edits since they were last used
+func (world TerrainWorld) clearanceWorld(agent AgentSize) TerrainWorld {
+	grown, ok := world.clearance[agent]
+	if !ok {
+		grown = make(map[utils.IntPair]*clearanceMap)
+		world.clearance[agent] = grown
+	}
+
+	reach := agent.reach()
+	chunks := make(map[utils.IntPair]*QuadTreeTerrain, len(world.chunks))
+	for chunk, tree := range world.chunks {
+		world.subscribeClearance(chunk, tree)
+		clearance, ok := grown[chunk]
+		if !ok {
+			clearance = &clearanceMap{tree: tree.clone(&terrainSettings{bounds: tree.settings.bounds, materials: world.materials, material_filters: make(map[int]shapes.Filter)})}
+			world.inflateInto(clearance.tree, tree.space, agent)
+			grown[chunk] = clearance
+		}
+		for _, region := range clearance.pending {
+			area := growAxisRect(region, reach, reach)
+			tree.copyInto(clearance.tree, area)
+			world.inflateInto(clearance.tree, growAxisRect(area, reach, reach), agent)
+		}
+		clearance.pending = nil
+		chunks[chunk] = clearance.tree
+	}
+
+	view := world
+	view.chunks = chunks
+	return view
+}
+
+// Grows everything unwalkable in the area from every loaded chunk into one chunk's copy
+func (world TerrainWorld) inflateInto(other *QuadTreeTerrain, area shapes.AxisRect, agent AgentSize) {
+	for _, tree := range world.chunksTouching(area) {
+		tree.inflateInto(other, area, agent)
+	}
+}
+
+func (world TerrainWorld) subscribeClearance(chunk utils.IntPair, tree *QuadTreeTerrain) {
+	if _, ok := world.clearance_subscribers[chunk]; ok {
+		return
+	}
+	world.clearance_subscribers[chunk] = tree.Subscribe(world.queueClearance)
+}
+
+// Edits near a seam reach into the grown copies of the chunks on the other side too
+func (world TerrainWorld) queueClearance(region shapes.AxisRect) {
+	for agent, grown := range world.clearance {
+		reach := agent.reach()
+		area := growAxisRect(region, reach, reach)
+		for chunk, clearance := range grown {
+			if area.IntersectsAxisRect(world.ChunkSpace(chunk)) {
+				clearance.pending = append(clearance.pending, region)
+			}
+		}
+	}
+}
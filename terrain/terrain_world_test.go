@@ -0,0 +1,79 @@
+package terrain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Yarnsh/hippo/utils"
+	"github.com/Yarnsh/hippo/shapes"
+)
+
+// Two 64 pixel chunks side by side, with a wall across both that leaves a 14 pixel gap from x 50 right up to the seam at 64
+func seamWorld() *TerrainWorld {
+	world := NewTerrainWorld(64, nil)
+	world.SetChunk(utils.IntPair{X: 0, Y: 0}, NewQuadTreeTerrain(0, 0, 64))
+	world.SetChunk(utils.IntPair{X: 1, Y: 0}, NewQuadTreeTerrain(64, 0, 64))
+	world.SetShape(shapes.NewAxisRect(0, 30, 50, 4), 1)
+	world.SetShape(shapes.NewAxisRect(64, 30, 64, 4), 1)
+	return world
+}
+
+func TestTerrainWorldAgentPathsSeeAcrossSeams(t *testing.T) {
+	world := seamWorld()
+	s, e := utils.IntPair{X: 56, Y: 5}, utils.IntPair{X: 56, Y: 60}
+
+	// Only the wall on the other side of the seam stops an 8 radius agent fitting through
+	if path := world.FindPathForAgent(s, e, CircleAgent(8)); len(path) != 0 {
+		t.Errorf("agent too big for the gap found %v", path)
+	}
+	path := world.FindPathForAgent(s, e, CircleAgent(5))
+	if len(path) == 0 {
+		t.Fatalf("agent that fits found no path")
+	}
+	walls := []shapes.AxisRect{shapes.NewAxisRect(0, 30, 50, 4), shapes.NewAxisRect(64, 30, 64, 4)}
+	for _, p := range path {
+		for _, wall := range walls {
+			// Path points are leaf corners, so they can sit on the edge of the last pixel that's far enough away
+			dx := math.Max(math.Max(float64(wall.X() - p.X), float64(p.X - wall.X2())), 0)
+			dy := math.Max(math.Max(float64(wall.Y() - p.Y), float64(p.Y - wall.Y2())), 0)
+			if math.Hypot(dx, dy) < 4 {
+				t.Errorf("path point %v is too close to the wall %v", p, wall)
+			}
+		}
+	}
+
+	if world.HasClearance(60.5, 20.5, CircleAgent(5)) != true || world.HasClearance(60.5, 28.5, CircleAgent(5)) != false {
+		t.Errorf("expected clearance above the wall but not right next to it")
+	}
+}
+
+func TestTerrainWorldAgentPathsFollowEditsAndStreaming(t *testing.T) {
+	world := seamWorld()
+	s, e := utils.IntPair{X: 56, Y: 5}, utils.IntPair{X: 56, Y: 60}
+	big := CircleAgent(8)
+	if len(world.FindPathForAgent(s, e, big)) != 0 {
+		t.Fatalf("agent too big for the gap found a path")
+	}
+
+	// Knocking back the wall in the other chunk has to reach the grown copy of this one
+	world.SetShape(shapes.NewAxisRect(64, 30, 10, 4), 0)
+	if len(world.FindPathForAgent(s, e, big)) == 0 {
+		t.Errorf("no path after widening the gap")
+	}
+	world.SetShape(shapes.NewAxisRect(64, 30, 10, 4), 1)
+	if len(world.FindPathForAgent(s, e, big)) != 0 {
+		t.Errorf("found a path after putting the wall back")
+	}
+
+	// Unloaded chunks don't push the agent away, and loading one back in does again
+	second := utils.IntPair{X: 1, Y: 0}
+	tree, _ := world.Chunk(second)
+	world.UnloadChunk(second)
+	if len(world.FindPathForAgent(s, e, big)) == 0 {
+		t.Errorf("no path with the other chunk unloaded")
+	}
+	world.SetChunk(second, tree)
+	if len(world.FindPathForAgent(s, e, big)) != 0 {
+		t.Errorf("found a path after loading the other chunk back in")
+	}
+}
@@ -20,3 +20,17 @@ func TowardsByFloat64(val, target, by float64) float64 {
 		return math.Max(target, val - by)
 	}
 }
+
+func MinInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func MaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
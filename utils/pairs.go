@@ -80,3 +80,28 @@ func (pair IntPair) ToFloat() FloatPair {
 		Y: float64(pair.Y),
 	}
 }
+
+func (pair FloatPair) Dot(other FloatPair) float64 {
+	return (pair.X * other.X) + (pair.Y * other.Y)
+}
+
+func (pair FloatPair) Cross(other FloatPair) float64 {
+	return (pair.X * other.Y) - (pair.Y * other.X)
+}
+
+// Rotated by r radians around the origin
+func (pair FloatPair) Rotated(r float64) FloatPair {
+	sin, cos := math.Sincos(r)
+	return FloatPair {
+		X: (pair.X * cos) - (pair.Y * sin),
+		Y: (pair.X * sin) + (pair.Y * cos),
+	}
+}
+
+// Rotated by 90 degrees, so (1, 0) becomes (0, 1)
+func (pair FloatPair) Perpendicular() FloatPair {
+	return FloatPair {
+		X: -pair.Y,
+		Y: pair.X,
+	}
+}